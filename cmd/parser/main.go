@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"tx-parser/internal/app"
 )
 
@@ -19,8 +22,10 @@ func main() {
 		log.Fatalf("Failed to initialize application: %v", err)
 	}
 
-	// Run the application
-	if err := application.Run(); err != nil {
+	// Run the application until it is interrupted, letting in-flight work wind down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := application.Run(ctx); err != nil {
 		log.Fatalf("Application encountered an error: %v", err)
 	}
 }
@@ -1,59 +1,160 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	"tx-parser/internal/interfaces"
 	"tx-parser/pkg/logger"
+	"tx-parser/utils"
 )
 
+// shutdownTimeout bounds how long in-flight requests may take to finish once the server stops
+const shutdownTimeout = 10 * time.Second
+
 type Server struct {
-	parser  interfaces.Parser
-	log     *logger.Logger
-	storage interfaces.Storage
+	parser       interfaces.Parser
+	log          *logger.Logger
+	storage      interfaces.Storage
+	rpcPool      interfaces.RPCPool
+	webhooks     interfaces.Webhooks
+	events       interfaces.EventSource
+	heartbeat    time.Duration // How often streams send a comment so proxies keep idle connections open
+	streamBuffer int           // Events queued for a stream before it is ended for falling behind
+	wsBuffer     int           // Messages queued for a WebSocket client before it is disconnected
 }
 
 func NewServer(p interfaces.Parser, s interfaces.Storage, log *logger.Logger) *Server {
 	return &Server{
-		parser:  p,
-		log:     log,
-		storage: s,
+		parser:       p,
+		log:          log,
+		storage:      s,
+		heartbeat:    streamHeartbeat,
+		streamBuffer: streamBuffer,
+		wsBuffer:     wsSendBuffer,
 	}
 }
 
-func (s *Server) Start(address string) error {
-	// Attach routes to the default ServeMux
-	http.HandleFunc("/subscribe", s.subscribe)
-	http.HandleFunc("/transactions/", s.getTransactions) // Route parameter handled manually
-	http.HandleFunc("/current-block", s.getCurrentBlock)
+// WithRPCPool exposes the health of the pool's RPC endpoints on the admin API
+func (s *Server) WithRPCPool(pool interfaces.RPCPool) *Server {
+	s.rpcPool = pool
+	return s
+}
+
+// WithWebhooks lets subscribed addresses register a webhook and exposes its dead letters on the API
+func (s *Server) WithWebhooks(webhooks interfaces.Webhooks) *Server {
+	s.webhooks = webhooks
+	return s
+}
+
+// WithEvents streams the indexer's events as Server-Sent Events and over WebSocket connections
+func (s *Server) WithEvents(events interfaces.EventSource) *Server {
+	s.events = events
+	return s
+}
+
+// Start serves the API until ctx is cancelled. Request contexts derive from ctx, so cancelling it
+// also cancels the RPC calls of in-flight requests.
+func (s *Server) Start(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/subscribe", s.subscribe)
+	mux.HandleFunc("/transactions/", s.getTransactions) // Route parameter handled manually
+	mux.HandleFunc("/current-block", s.getCurrentBlock)
+	mux.HandleFunc("/backfill/", s.backfill) // Route parameter handled manually
+	mux.HandleFunc("/admin/rpc", s.getRPCStatus)
+	mux.HandleFunc("/webhooks/dead-letters", s.getDeadLetters)
+	mux.HandleFunc("/webhooks/replay", s.replayWebhooks)
+	mux.HandleFunc("/webhooks/", s.registerWebhook) // Route parameter handled manually
+	mux.HandleFunc("/stream", s.streamAddresses)
+	mux.HandleFunc("/stream/", s.streamAddress) // Route parameter handled manually
+	mux.HandleFunc("/ws", s.serveWS)
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.log.Error.Printf("Server failed to shut down: %v", err)
+		}
+	}()
 
 	// Start the server and return any error that occurs
-	err := http.ListenAndServe(address, nil)
-	if err != nil {
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.log.Error.Printf("Server failed to start: %v", err)
 		return err
 	}
+	s.log.Info.Println("Server stopped")
 	return nil
 }
 
 func (s *Server) getCurrentBlock(w http.ResponseWriter, r *http.Request) {
-	block := s.parser.GetCurrentBlock()
+	block := s.parser.GetCurrentBlock(r.Context())
 	s.log.Debug.Printf("Fetching current block: %d", block)
 	json.NewEncoder(w).Encode(map[string]int{"current_block": block})
 }
 
 func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Address string `json:"address"`
+		Address       string `json:"address"`
+		FromBlock     *int   `json:"from_block"`     // Optional start of a historical backfill
+		FromTimestamp *int64 `json:"from_timestamp"` // Optional start of a historical backfill as Unix seconds
+		WebhookURL    string `json:"webhook_url"`    // Optional URL notified of every stored record
+		WebhookSecret string `json:"webhook_secret"` // Signs webhook deliveries, generated when empty
 	}
 	json.NewDecoder(r.Body).Decode(&req)
+	if utils.NormalizeAddress(req.Address) == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+	if req.WebhookURL != "" {
+		if s.webhooks == nil {
+			http.Error(w, "Webhooks are not enabled", http.StatusBadRequest)
+			return
+		}
+		if !validWebhookURL(req.WebhookURL) {
+			http.Error(w, "Invalid webhook_url", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Resolve where the backfill starts before subscribing so invalid requests change nothing
+	fromBlock, ok := s.backfillStart(w, r, req.FromBlock, req.FromTimestamp)
+	if !ok {
+		return
+	}
 
 	// Call the Subscribe method of eth_parser to handle the logic
 	if s.parser.Subscribe(req.Address) {
 		// If address is newly subscribed, return success
 		s.log.Info.Printf("Successfully subscribed to address: %s", req.Address)
-		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		response := map[string]interface{}{"status": "success"}
+		if req.WebhookURL != "" {
+			// The secret is only ever returned here
+			response["webhook"] = s.webhooks.Register(req.Address, req.WebhookURL, req.WebhookSecret)
+		}
+		if fromBlock != nil {
+			// The subscription and webhook stand either way, so report the failure alongside them
+			// instead of failing a request whose retry would conflict and lose the webhook secret
+			if job, err := s.parser.Backfill(req.Address, *fromBlock); err != nil {
+				s.log.Error.Printf("Failed to start backfill for %s: %v", req.Address, err)
+				response["backfill_error"] = err.Error()
+			} else {
+				response["backfill"] = job
+			}
+		}
+		json.NewEncoder(w).Encode(response)
 	} else {
 		// If the address is already subscribed, return conflict
 		s.log.Warn.Printf("Address %s is already subscribed", req.Address)
@@ -72,8 +173,33 @@ func (s *Server) getTransactions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Optionally filter by confirmation or mempool status
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", interfaces.StatusUnconfirmed, interfaces.StatusConfirmed, interfaces.StatusFinalized,
+		interfaces.StatusPending, interfaces.StatusReplaced, interfaces.StatusDropped:
+	default:
+		http.Error(w, "Invalid status filter", http.StatusBadRequest)
+		return
+	}
+
+	// Optionally filter by kind of transfer
+	kind := r.URL.Query().Get("kind")
+	switch kind {
+	case "", interfaces.KindNative, interfaces.KindDeployment, interfaces.KindERC20, interfaces.KindERC721, interfaces.KindERC1155, interfaces.KindInternal, interfaces.KindWithdrawal:
+	default:
+		http.Error(w, "Invalid kind filter", http.StatusBadRequest)
+		return
+	}
+
 	// Fetch transactions from storage or the mockParser
 	transactions := s.parser.GetTransactions(address)
+	if status != "" {
+		transactions = filterByStatus(transactions, status)
+	}
+	if kind != "" {
+		transactions = filterByKind(transactions, kind)
+	}
 
 	// If no transactions found, return a 404
 	if transactions == nil {
@@ -81,6 +207,223 @@ func (s *Server) getTransactions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Respond with the transactions
+	// Respond with the transactions, rendering amounts in ether alongside wei
+	for i := range transactions {
+		transactions[i] = render(transactions[i])
+	}
 	json.NewEncoder(w).Encode(transactions)
 }
+
+// render fills in the amounts rendered for API output
+func render(tx interfaces.Transaction) interfaces.Transaction {
+	tx.ValueEther = utils.FormatEther(tx.Value)
+	tx.FeeEther = utils.FormatEther(tx.Fee)
+	if token := tx.Token; token != nil && token.Decimals != nil {
+		// Render into a copy, the token is shared with storage
+		rendered := *token
+		rendered.AmountDecimal = utils.FormatUnits(token.Amount, *token.Decimals)
+		tx.Token = &rendered
+	}
+	return tx
+}
+
+// backfillStart resolves the optional start of a backfill, given as a block or a Unix timestamp,
+// writing the error response and returning false when it is invalid
+func (s *Server) backfillStart(w http.ResponseWriter, r *http.Request, fromBlock *int, fromTimestamp *int64) (*int, bool) {
+	if fromBlock == nil && fromTimestamp != nil {
+		block, err := s.parser.BlockAtTimestamp(r.Context(), *fromTimestamp)
+		if errors.Is(err, interfaces.ErrTimestampAfterHead) {
+			http.Error(w, "Invalid from_timestamp", http.StatusBadRequest)
+			return nil, false
+		}
+		if err != nil {
+			// The node could not be asked, which says nothing about the request
+			s.log.Warn.Printf("Failed to resolve timestamp %d: %v", *fromTimestamp, err)
+			http.Error(w, "Failed to resolve from_timestamp", http.StatusBadGateway)
+			return nil, false
+		}
+		fromBlock = &block
+	}
+	if fromBlock != nil && *fromBlock < 0 {
+		http.Error(w, "Invalid from_block", http.StatusBadRequest)
+		return nil, false
+	}
+	return fromBlock, true
+}
+
+// backfill returns the backfill progress of an address on GET and starts a new backfill on POST
+func (s *Server) backfill(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getBackfill(w, r)
+	case http.MethodPost:
+		s.startBackfill(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// startBackfill starts a historical backfill for an address that is already subscribed
+func (s *Server) startBackfill(w http.ResponseWriter, r *http.Request) {
+	// Extract the address from the URL
+	address := utils.NormalizeAddress(r.URL.Path[len("/backfill/"):])
+	if address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		FromBlock     *int   `json:"from_block"`
+		FromTimestamp *int64 `json:"from_timestamp"` // Unix seconds
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.FromBlock == nil && req.FromTimestamp == nil {
+		http.Error(w, "from_block or from_timestamp is required", http.StatusBadRequest)
+		return
+	}
+	if !s.storage.IsSubscribed(address) {
+		http.Error(w, "Address is not subscribed", http.StatusNotFound)
+		return
+	}
+	fromBlock, ok := s.backfillStart(w, r, req.FromBlock, req.FromTimestamp)
+	if !ok {
+		return
+	}
+
+	job, err := s.parser.Backfill(address, *fromBlock)
+	switch {
+	case errors.Is(err, interfaces.ErrBackfillInProgress):
+		http.Error(w, "A backfill is already in progress for the given address", http.StatusConflict)
+		return
+	case errors.Is(err, interfaces.ErrChainHeadUnknown):
+		http.Error(w, "Chain head is not known yet", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		s.log.Error.Printf("Failed to start backfill for %s: %v", address, err)
+		http.Error(w, "Failed to start backfill", http.StatusInternalServerError)
+		return
+	}
+	s.log.Info.Printf("Started backfill for address: %s", address)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) getBackfill(w http.ResponseWriter, r *http.Request) {
+	// Extract the address from the URL
+	address := r.URL.Path[len("/backfill/"):]
+	if address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+
+	job, ok := s.parser.GetBackfill(address)
+	if !ok {
+		http.Error(w, "No backfill found for the given address", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) getRPCStatus(w http.ResponseWriter, r *http.Request) {
+	if s.rpcPool == nil {
+		http.Error(w, "RPC pool is not configured", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"endpoints": s.rpcPool.Status()})
+}
+
+// registerWebhook registers the webhook of a subscribed address, replacing any previous one so a
+// lost secret can be rotated
+func (s *Server) registerWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.webhooks == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract the address from the URL
+	address := utils.NormalizeAddress(r.URL.Path[len("/webhooks/"):])
+	if address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		URL    string `json:"url"`
+		Secret string `json:"secret"` // Signs webhook deliveries, generated when empty
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if !validWebhookURL(req.URL) {
+		http.Error(w, "Invalid url", http.StatusBadRequest)
+		return
+	}
+	if !s.storage.IsSubscribed(address) {
+		http.Error(w, "Address is not subscribed", http.StatusNotFound)
+		return
+	}
+
+	// The secret is only ever returned here and on subscribing
+	webhook := s.webhooks.Register(address, req.URL, req.Secret)
+	s.log.Info.Printf("Registered webhook for address: %s", address)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (s *Server) getDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s.webhooks == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+	// Optionally limited to a single address
+	deliveries := s.webhooks.DeadLetters(r.URL.Query().Get("address"))
+	json.NewEncoder(w).Encode(map[string]interface{}{"dead_letters": deliveries})
+}
+
+func (s *Server) replayWebhooks(w http.ResponseWriter, r *http.Request) {
+	if s.webhooks == nil {
+		http.Error(w, "Webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Without an id or address, every dead letter is replayed
+	var req struct {
+		Address string `json:"address"`
+		ID      string `json:"id"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	replayed := s.webhooks.Replay(req.Address, req.ID)
+	json.NewEncoder(w).Encode(map[string]int{"replayed": replayed})
+}
+
+// validWebhookURL reports whether a webhook URL is an absolute http or https URL
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// filterByStatus returns the transactions with the given confirmation or mempool status
+func filterByStatus(transactions []interfaces.Transaction, status string) []interfaces.Transaction {
+	var filtered []interfaces.Transaction
+	for _, tx := range transactions {
+		if tx.Status == status {
+			filtered = append(filtered, tx)
+		}
+	}
+	return filtered
+}
+
+// filterByKind returns the transfers of the given kind
+func filterByKind(transactions []interfaces.Transaction, kind string) []interfaces.Transaction {
+	var filtered []interfaces.Transaction
+	for _, tx := range transactions {
+		if tx.Kind == kind {
+			filtered = append(filtered, tx)
+		}
+	}
+	return filtered
+}
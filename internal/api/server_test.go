@@ -2,10 +2,14 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"tx-parser/internal/interfaces"
 	"tx-parser/internal/storage"
@@ -19,9 +23,12 @@ type mockParser struct {
 	currentBlock int
 	subscribed   map[string]bool
 	transactions map[string][]interfaces.Transaction
+	backfills    map[string]interfaces.BackfillJob
+	backfillErr  error // Returned by Backfill when set
+	rpcErr       error // Returned by BlockAtTimestamp when set, as if the node failed
 }
 
-func (m *mockParser) GetCurrentBlock() int {
+func (m *mockParser) GetCurrentBlock(ctx context.Context) int {
 	return m.currentBlock
 }
 
@@ -33,10 +40,42 @@ func (m *mockParser) Subscribe(address string) bool {
 	return true // Successfully subscribed
 }
 
+func (m *mockParser) Unsubscribe(address string) bool {
+	if _, exists := m.subscribed[address]; !exists {
+		return false
+	}
+	delete(m.subscribed, address)
+	return true
+}
+
 func (m *mockParser) GetTransactions(address string) []interfaces.Transaction {
 	return m.transactions[address]
 }
 
+func (m *mockParser) Backfill(address string, fromBlock int) (interfaces.BackfillJob, error) {
+	if m.backfillErr != nil {
+		return interfaces.BackfillJob{}, m.backfillErr
+	}
+	job := interfaces.BackfillJob{Address: address, FromBlock: fromBlock, ToBlock: m.currentBlock - 1, NextBlock: fromBlock, Status: interfaces.BackfillQueued}
+	m.backfills[address] = job
+	return job, nil
+}
+
+func (m *mockParser) GetBackfill(address string) (interfaces.BackfillJob, bool) {
+	job, ok := m.backfills[address]
+	return job, ok
+}
+
+func (m *mockParser) BlockAtTimestamp(ctx context.Context, timestamp int64) (int, error) {
+	switch {
+	case timestamp > int64(m.currentBlock)*12:
+		return 0, fmt.Errorf("%w: %d", interfaces.ErrTimestampAfterHead, timestamp)
+	case m.rpcErr != nil:
+		return 0, m.rpcErr
+	}
+	return int(timestamp / 12), nil
+}
+
 func TestGetCurrentBlock(t *testing.T) {
 	log := logger.GetLogger("debug")
 	parser := &mockParser{currentBlock: 123456}
@@ -94,6 +133,13 @@ func TestSubscribe(t *testing.T) {
 	}
 	assert.Equal(t, "error", response["status"], "Should return an error for already subscribed address")
 	assert.Equal(t, "Address already subscribed", response["message"], "Should return appropriate error message for already subscribed address")
+
+	// Test subscription without an address
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/subscribe", bytes.NewBuffer([]byte(`{"address": " "}`)))
+	req.Header.Set("Content-Type", "application/json")
+	server.subscribe(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400 without an address")
 }
 
 func TestGetTransactions(t *testing.T) {
@@ -101,8 +147,8 @@ func TestGetTransactions(t *testing.T) {
 	parser := &mockParser{
 		transactions: map[string][]interfaces.Transaction{
 			"0xTestAddress": {
-				{Hash: "0x1", From: "0xFrom1", To: "0xTestAddress", Value: "100"},
-				{Hash: "0x2", From: "0xTestAddress", To: "0xTo1", Value: "200"},
+				{Hash: "0x1", From: "0xFrom1", To: "0xTestAddress", Value: big.NewInt(100)},
+				{Hash: "0x2", From: "0xTestAddress", To: "0xTo1", Value: big.NewInt(200)},
 			},
 		},
 	}
@@ -121,7 +167,61 @@ func TestGetTransactions(t *testing.T) {
 	assert.Len(t, transactions, 2, "Should return 2 transactions")
 	assert.Equal(t, "0x1", transactions[0].Hash, "First transaction hash should match")
 	assert.Equal(t, "0xTestAddress", transactions[0].To, "First transaction 'To' address should match")
-	assert.Equal(t, "200", transactions[1].Value, "Second transaction value should match")
+	assert.Equal(t, big.NewInt(200), transactions[1].Value, "Second transaction value should match")
+	assert.Equal(t, "0.0000000000000002", transactions[1].ValueEther, "Value should also be rendered in ether")
+}
+
+// Test that wei amounts are rendered in ether without losing precision
+func TestGetTransactions_ValueEther(t *testing.T) {
+	log := logger.GetLogger("debug")
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	parser := &mockParser{
+		transactions: map[string][]interfaces.Transaction{
+			"0xTestAddress": {
+				{Hash: "0x1", Value: big.NewInt(1500000000000000000)},
+				{Hash: "0x2", Value: big.NewInt(0)},
+				{Hash: "0x3", Value: huge},
+			},
+		},
+	}
+	server := NewServer(parser, storage.NewMemoryStorage(), log)
+
+	req, _ := http.NewRequest("GET", "/transactions/0xTestAddress", nil)
+	rr := httptest.NewRecorder()
+	server.getTransactions(rr, req)
+
+	var transactions []interfaces.Transaction
+	json.Unmarshal(rr.Body.Bytes(), &transactions)
+	assert.Equal(t, "1.5", transactions[0].ValueEther, "1.5 ether should be rendered without trailing zeros")
+	assert.Equal(t, "0", transactions[1].ValueEther, "Zero should be rendered as 0")
+	assert.Equal(t, "123456789012.34567890123456789", transactions[2].ValueEther, "Large values should keep every digit")
+	assert.Equal(t, huge, transactions[2].Value, "Wei value should survive the JSON round trip")
+}
+
+// Test that token amounts are rendered with the token's decimals without touching the stored token
+func TestGetTransactions_TokenAmount(t *testing.T) {
+	log := logger.GetLogger("debug")
+	decimals := 6
+	token := &interfaces.TokenTransfer{Contract: "0xtoken", Decimals: &decimals, Amount: big.NewInt(1500000)}
+	parser := &mockParser{
+		transactions: map[string][]interfaces.Transaction{
+			"0xTestAddress": {
+				{Hash: "0x1", Kind: interfaces.KindERC20, Value: big.NewInt(0), Token: token},
+				{Hash: "0x2", Kind: interfaces.KindERC20, Value: big.NewInt(0), Token: &interfaces.TokenTransfer{Contract: "0xunknown", Amount: big.NewInt(7)}},
+			},
+		},
+	}
+	server := NewServer(parser, storage.NewMemoryStorage(), log)
+
+	req, _ := http.NewRequest("GET", "/transactions/0xTestAddress", nil)
+	rr := httptest.NewRecorder()
+	server.getTransactions(rr, req)
+
+	var transactions []interfaces.Transaction
+	json.Unmarshal(rr.Body.Bytes(), &transactions)
+	assert.Equal(t, "1.5", transactions[0].Token.AmountDecimal, "Amount should be rendered with the token's decimals")
+	assert.Empty(t, transactions[1].Token.AmountDecimal, "Amount should not be rendered without decimals")
+	assert.Empty(t, token.AmountDecimal, "The stored token should not be modified")
 }
 
 func TestGetTransactions_NoTransactions(t *testing.T) {
@@ -141,3 +241,425 @@ func TestGetTransactions_NoTransactions(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
 	assert.Equal(t, "No transactions found for the given address\n", rr.Body.String())
 }
+
+func TestGetTransactions_StatusFilter(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := &mockParser{
+		transactions: map[string][]interfaces.Transaction{
+			"0xTestAddress": {
+				{Hash: "0x1", From: "0xFrom1", To: "0xTestAddress", Value: big.NewInt(100), Status: interfaces.StatusFinalized},
+				{Hash: "0x2", From: "0xTestAddress", To: "0xTo1", Value: big.NewInt(200), Status: interfaces.StatusUnconfirmed},
+			},
+		},
+	}
+	s := storage.NewMemoryStorage()
+	server := NewServer(parser, s, log)
+
+	// Filter by a known status
+	req, _ := http.NewRequest("GET", "/transactions/0xTestAddress?status=unconfirmed", nil)
+	rr := httptest.NewRecorder()
+	server.getTransactions(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var transactions []interfaces.Transaction
+	json.Unmarshal(rr.Body.Bytes(), &transactions)
+	assert.Len(t, transactions, 1, "Should return 1 transaction")
+	assert.Equal(t, "0x2", transactions[0].Hash, "Only the unconfirmed transaction should be returned")
+
+	// No transactions with the requested status
+	req, _ = http.NewRequest("GET", "/transactions/0xTestAddress?status=confirmed", nil)
+	rr = httptest.NewRecorder()
+	server.getTransactions(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+
+	// Unknown status
+	req, _ = http.NewRequest("GET", "/transactions/0xTestAddress?status=mined", nil)
+	rr = httptest.NewRecorder()
+	server.getTransactions(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestGetTransactions_KindFilter(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := &mockParser{
+		transactions: map[string][]interfaces.Transaction{
+			"0xTestAddress": {
+				{Hash: "0x1", Kind: interfaces.KindNative, Value: big.NewInt(100)},
+				{Hash: "0x2", Kind: interfaces.KindERC721, Value: big.NewInt(0), Token: &interfaces.TokenTransfer{Contract: "0xcollection", TokenIDs: []*big.Int{big.NewInt(42)}, Quantities: []*big.Int{big.NewInt(1)}}},
+			},
+		},
+	}
+	server := NewServer(parser, storage.NewMemoryStorage(), log)
+
+	// Filter by a known kind
+	req, _ := http.NewRequest("GET", "/transactions/0xTestAddress?kind=erc721", nil)
+	rr := httptest.NewRecorder()
+	server.getTransactions(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var transactions []interfaces.Transaction
+	json.Unmarshal(rr.Body.Bytes(), &transactions)
+	assert.Len(t, transactions, 1, "Should return 1 transfer")
+	assert.Equal(t, "42", transactions[0].Token.TokenIDs[0].String(), "Token ids should be returned")
+
+	// No transfers of the requested kind
+	req, _ = http.NewRequest("GET", "/transactions/0xTestAddress?kind=erc1155", nil)
+	rr = httptest.NewRecorder()
+	server.getTransactions(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+
+	// Unknown kind
+	req, _ = http.NewRequest("GET", "/transactions/0xTestAddress?kind=erc777", nil)
+	rr = httptest.NewRecorder()
+	server.getTransactions(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+}
+
+func TestSubscribe_Backfill(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := &mockParser{
+		currentBlock: 100,
+		subscribed:   make(map[string]bool),
+		backfills:    make(map[string]interfaces.BackfillJob),
+	}
+	s := storage.NewMemoryStorage()
+	server := NewServer(parser, s, log)
+
+	// Subscribe with a backfill start block
+	reqBody := []byte(`{"address": "0xNewAddress", "from_block": 10}`)
+	req, _ := http.NewRequest("POST", "/subscribe", bytes.NewBuffer(reqBody))
+	rr := httptest.NewRecorder()
+	server.subscribe(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response struct {
+		Status   string                 `json:"status"`
+		Backfill interfaces.BackfillJob `json:"backfill"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, "success", response.Status, "Should subscribe new address successfully")
+	assert.Equal(t, 10, response.Backfill.FromBlock, "Backfill should start at the requested block")
+	assert.Equal(t, 99, response.Backfill.ToBlock, "Backfill should end before the live indexer")
+
+	// Subscribe with a backfill start timestamp
+	reqBody = []byte(`{"address": "0xOtherAddress", "from_timestamp": 120}`)
+	req, _ = http.NewRequest("POST", "/subscribe", bytes.NewBuffer(reqBody))
+	rr = httptest.NewRecorder()
+	server.subscribe(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, 10, response.Backfill.FromBlock, "Backfill should start at the block of the timestamp")
+
+	// Invalid start block is rejected without subscribing
+	reqBody = []byte(`{"address": "0xThirdAddress", "from_block": -1}`)
+	req, _ = http.NewRequest("POST", "/subscribe", bytes.NewBuffer(reqBody))
+	rr = httptest.NewRecorder()
+	server.subscribe(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400")
+	assert.False(t, parser.subscribed["0xThirdAddress"], "Address should not be subscribed")
+
+	// A backfill that cannot start is reported without failing the subscription
+	parser.backfillErr = fmt.Errorf("chain head is not known yet")
+	reqBody = []byte(`{"address": "0xFourthAddress", "from_block": 10}`)
+	req, _ = http.NewRequest("POST", "/subscribe", bytes.NewBuffer(reqBody))
+	rr = httptest.NewRecorder()
+	server.subscribe(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var failed map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &failed)
+	assert.Equal(t, "success", failed["status"], "Address should still be subscribed")
+	assert.Equal(t, "chain head is not known yet", failed["backfill_error"], "Response should carry the backfill error")
+	assert.NotContains(t, failed, "backfill", "Response should not carry a backfill job")
+	assert.True(t, parser.subscribed["0xFourthAddress"], "Address should stay subscribed")
+}
+
+// Test that a backfill can be started for an address that is already subscribed
+func TestStartBackfill(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := &mockParser{
+		currentBlock: 100,
+		subscribed:   make(map[string]bool),
+		backfills:    make(map[string]interfaces.BackfillJob),
+	}
+	s := storage.NewMemoryStorage()
+	s.AddAddress("0xtestaddress")
+	server := NewServer(parser, s, log)
+
+	post := func(address, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/backfill/"+address, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		server.backfill(rr, req)
+		return rr
+	}
+
+	rr := post("0xTestAddress", `{"from_block": 10}`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var job interfaces.BackfillJob
+	json.Unmarshal(rr.Body.Bytes(), &job)
+	assert.Equal(t, "0xtestaddress", job.Address, "Backfill should be started for the normalized address")
+	assert.Equal(t, 10, job.FromBlock, "Backfill should start at the requested block")
+
+	rr = post("0xtestaddress", `{"from_timestamp": 120}`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	json.Unmarshal(rr.Body.Bytes(), &job)
+	assert.Equal(t, 10, job.FromBlock, "Backfill should start at the block of the timestamp")
+
+	assert.Equal(t, http.StatusBadRequest, post("0xtestaddress", `{"from_timestamp": 2000}`).Code, "Timestamp after the head should be rejected")
+	parser.rpcErr = fmt.Errorf("connection refused")
+	assert.Equal(t, http.StatusBadGateway, post("0xtestaddress", `{"from_timestamp": 120}`).Code, "Node failure should not be reported as an invalid timestamp")
+	parser.rpcErr = nil
+
+	assert.Equal(t, http.StatusBadRequest, post("0xtestaddress", `{}`).Code, "A start is required")
+	assert.Equal(t, http.StatusBadRequest, post("0xtestaddress", `{"from_block": -1}`).Code, "Invalid start block should be rejected")
+	assert.Equal(t, http.StatusNotFound, post("0xunknown", `{"from_block": 10}`).Code, "Address that is not subscribed should not be backfilled")
+
+	parser.backfillErr = fmt.Errorf("%w for address 0xtestaddress", interfaces.ErrBackfillInProgress)
+	assert.Equal(t, http.StatusConflict, post("0xtestaddress", `{"from_block": 10}`).Code, "Status code should be 409 while a backfill runs")
+	parser.backfillErr = interfaces.ErrChainHeadUnknown
+	assert.Equal(t, http.StatusServiceUnavailable, post("0xtestaddress", `{"from_block": 10}`).Code, "Status code should be 503 before the chain head is known")
+
+	req, _ := http.NewRequest("DELETE", "/backfill/0xtestaddress", nil)
+	rr = httptest.NewRecorder()
+	server.backfill(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code, "Status code should be 405 for other methods")
+}
+
+func TestGetBackfill(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := &mockParser{
+		backfills: map[string]interfaces.BackfillJob{
+			"0xTestAddress": {Address: "0xTestAddress", FromBlock: 1, ToBlock: 10, NextBlock: 4, Status: interfaces.BackfillRunning},
+		},
+	}
+	s := storage.NewMemoryStorage()
+	server := NewServer(parser, s, log)
+
+	req, _ := http.NewRequest("GET", "/backfill/0xTestAddress", nil)
+	rr := httptest.NewRecorder()
+	server.getBackfill(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var job interfaces.BackfillJob
+	json.Unmarshal(rr.Body.Bytes(), &job)
+	assert.Equal(t, 4, job.NextBlock, "Backfill progress should match")
+	assert.Equal(t, interfaces.BackfillRunning, job.Status, "Backfill status should match")
+
+	// Unknown address
+	req, _ = http.NewRequest("GET", "/backfill/0xUnknown", nil)
+	rr = httptest.NewRecorder()
+	server.getBackfill(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+}
+
+// mockRPCPool is a mock implementation of interfaces.RPCPool
+type mockRPCPool struct {
+	statuses []interfaces.EndpointStatus
+}
+
+func (m *mockRPCPool) Status() []interfaces.EndpointStatus {
+	return m.statuses
+}
+
+func TestGetRPCStatus(t *testing.T) {
+	log := logger.GetLogger("debug")
+	s := storage.NewMemoryStorage()
+
+	// Without a pool there is nothing to report
+	server := NewServer(&mockParser{}, s, log)
+	req, _ := http.NewRequest("GET", "/admin/rpc", nil)
+	rr := httptest.NewRecorder()
+	server.getRPCStatus(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+
+	pool := &mockRPCPool{statuses: []interfaces.EndpointStatus{
+		{URL: "https://node1.example", Healthy: true, Head: 100},
+		{URL: "https://node2.example", Healthy: true, Lagging: true, Head: 90, HeadLag: 10},
+	}}
+	server = NewServer(&mockParser{}, s, log).WithRPCPool(pool)
+	rr = httptest.NewRecorder()
+	server.getRPCStatus(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response struct {
+		Endpoints []interfaces.EndpointStatus `json:"endpoints"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Len(t, response.Endpoints, 2, "Should report every endpoint")
+	assert.True(t, response.Endpoints[1].Lagging, "Lagging endpoint should be reported")
+	assert.Equal(t, 10, response.Endpoints[1].HeadLag, "Head lag should be reported")
+}
+
+// mockWebhooks is a mock implementation of the Webhooks interface
+type mockWebhooks struct {
+	registered  map[string]interfaces.Webhook
+	deadLetters []interfaces.WebhookDelivery
+	replayed    []string // Address and id of each replay request
+}
+
+func (m *mockWebhooks) Register(address, url, secret string) interfaces.Webhook {
+	if secret == "" {
+		secret = "generated"
+	}
+	webhook := interfaces.Webhook{Address: address, URL: url, Secret: secret}
+	m.registered[address] = webhook
+	return webhook
+}
+
+func (m *mockWebhooks) DeadLetters(address string) []interfaces.WebhookDelivery {
+	return m.deadLetters
+}
+
+func (m *mockWebhooks) Replay(address, id string) int {
+	m.replayed = append(m.replayed, address, id)
+	return len(m.deadLetters)
+}
+
+func TestSubscribe_Webhook(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := &mockParser{subscribed: make(map[string]bool)}
+	s := storage.NewMemoryStorage()
+
+	// Webhooks are rejected when the server does not deliver them
+	server := NewServer(parser, s, log)
+	req, _ := http.NewRequest("POST", "/subscribe", bytes.NewBuffer([]byte(`{"address": "0xNewAddress", "webhook_url": "http://localhost/hook"}`)))
+	rr := httptest.NewRecorder()
+	server.subscribe(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400 without webhooks")
+
+	webhooks := &mockWebhooks{registered: make(map[string]interfaces.Webhook)}
+	server = NewServer(parser, s, log).WithWebhooks(webhooks)
+
+	// Invalid URLs are rejected before subscribing
+	req, _ = http.NewRequest("POST", "/subscribe", bytes.NewBuffer([]byte(`{"address": "0xNewAddress", "webhook_url": "localhost/hook"}`)))
+	rr = httptest.NewRecorder()
+	server.subscribe(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400 for an invalid webhook URL")
+	assert.Len(t, parser.subscribed, 0, "Address should not be subscribed after an invalid request")
+
+	// The webhook and its secret are returned with the subscription
+	req, _ = http.NewRequest("POST", "/subscribe", bytes.NewBuffer([]byte(`{"address": "0xNewAddress", "webhook_url": "https://example.com/hook"}`)))
+	rr = httptest.NewRecorder()
+	server.subscribe(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var response struct {
+		Status  string             `json:"status"`
+		Webhook interfaces.Webhook `json:"webhook"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, "https://example.com/hook", response.Webhook.URL, "Response should include the webhook URL")
+	assert.Equal(t, "generated", response.Webhook.Secret, "Response should include the webhook secret")
+	assert.Contains(t, webhooks.registered, "0xNewAddress", "Webhook should be registered")
+}
+
+func TestRegisterWebhook(t *testing.T) {
+	log := logger.GetLogger("debug")
+	s := storage.NewMemoryStorage()
+	s.AddAddress("0xtestaddress")
+
+	// Webhooks cannot be registered when the server does not deliver them
+	server := NewServer(&mockParser{}, s, log)
+	req, _ := http.NewRequest("PUT", "/webhooks/0xtestaddress", bytes.NewBuffer([]byte(`{"url": "https://example.com/hook"}`)))
+	rr := httptest.NewRecorder()
+	server.registerWebhook(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404 without webhooks")
+
+	webhooks := &mockWebhooks{registered: make(map[string]interfaces.Webhook)}
+	server = NewServer(&mockParser{}, s, log).WithWebhooks(webhooks)
+
+	// An already subscribed address gets a webhook, with its secret returned
+	req, _ = http.NewRequest("PUT", "/webhooks/0xTestAddress", bytes.NewBuffer([]byte(`{"url": "https://example.com/hook"}`)))
+	rr = httptest.NewRecorder()
+	server.registerWebhook(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var webhook interfaces.Webhook
+	json.Unmarshal(rr.Body.Bytes(), &webhook)
+	assert.Equal(t, "https://example.com/hook", webhook.URL, "Response should include the webhook URL")
+	assert.Equal(t, "generated", webhook.Secret, "Response should include the webhook secret")
+	assert.Contains(t, webhooks.registered, "0xtestaddress", "Webhook should be registered for the normalized address")
+
+	// Registering again replaces the webhook, such as to rotate its secret
+	req, _ = http.NewRequest("PUT", "/webhooks/0xtestaddress", bytes.NewBuffer([]byte(`{"url": "https://example.com/hook", "secret": "rotated"}`)))
+	rr = httptest.NewRecorder()
+	server.registerWebhook(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	assert.Equal(t, "rotated", webhooks.registered["0xtestaddress"].Secret, "Webhook secret should be replaced")
+
+	req, _ = http.NewRequest("PUT", "/webhooks/0xother", bytes.NewBuffer([]byte(`{"url": "https://example.com/hook"}`)))
+	rr = httptest.NewRecorder()
+	server.registerWebhook(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404 for an address that is not subscribed")
+
+	req, _ = http.NewRequest("PUT", "/webhooks/0xtestaddress", bytes.NewBuffer([]byte(`{"url": "localhost/hook"}`)))
+	rr = httptest.NewRecorder()
+	server.registerWebhook(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Status code should be 400 for an invalid webhook URL")
+
+	req, _ = http.NewRequest("POST", "/webhooks/0xtestaddress", bytes.NewBuffer([]byte(`{"url": "https://example.com/hook"}`)))
+	rr = httptest.NewRecorder()
+	server.registerWebhook(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code, "Status code should be 405")
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	log := logger.GetLogger("debug")
+	s := storage.NewMemoryStorage()
+
+	// Without webhooks there is nothing to replay
+	server := NewServer(&mockParser{}, s, log)
+	req, _ := http.NewRequest("POST", "/webhooks/replay", nil)
+	rr := httptest.NewRecorder()
+	server.replayWebhooks(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Status code should be 404")
+
+	webhooks := &mockWebhooks{deadLetters: []interfaces.WebhookDelivery{
+		{ID: "a", Address: "0xtestaddress", Status: interfaces.DeliveryDead, Attempts: 10, LastError: "unexpected status code 500"},
+	}}
+	server = NewServer(&mockParser{}, s, log).WithWebhooks(webhooks)
+
+	req, _ = http.NewRequest("GET", "/webhooks/dead-letters?address=0xtestaddress", nil)
+	rr = httptest.NewRecorder()
+	server.getDeadLetters(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var deadLetters struct {
+		DeadLetters []interfaces.WebhookDelivery `json:"dead_letters"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &deadLetters)
+	assert.Len(t, deadLetters.DeadLetters, 1, "Should list the dead letters")
+	assert.Equal(t, 10, deadLetters.DeadLetters[0].Attempts, "Dead letter attempts should be reported")
+
+	// Replay only accepts POST
+	req, _ = http.NewRequest("GET", "/webhooks/replay", nil)
+	rr = httptest.NewRecorder()
+	server.replayWebhooks(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code, "Status code should be 405")
+
+	req, _ = http.NewRequest("POST", "/webhooks/replay", bytes.NewBuffer([]byte(`{"id": "a"}`)))
+	rr = httptest.NewRecorder()
+	server.replayWebhooks(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Status code should be 200")
+	var replayed map[string]int
+	json.Unmarshal(rr.Body.Bytes(), &replayed)
+	assert.Equal(t, 1, replayed["replayed"], "Should report the number of replayed deliveries")
+	assert.Equal(t, []string{"", "a"}, webhooks.replayed, "Replay should be limited to the requested id")
+}
+
+// Test that the server shuts down once its context is cancelled
+func TestStart_Shutdown(t *testing.T) {
+	log := logger.GetLogger("debug")
+	server := NewServer(&mockParser{}, storage.NewMemoryStorage(), log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Start(ctx, "127.0.0.1:0") }()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err, "Expected a clean shutdown")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not shut down")
+	}
+}
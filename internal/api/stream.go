@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+)
+
+const (
+	// streamHeartbeat is the default interval between heartbeat comments on idle streams
+	streamHeartbeat = 15 * time.Second
+	// streamBuffer is the default number of events queued for a stream while it writes to a slow
+	// client or replays stored records
+	streamBuffer = 256
+)
+
+// streamAddress streams the records stored for a single address
+func (s *Server) streamAddress(w http.ResponseWriter, r *http.Request) {
+	// Extract the address from the URL
+	address := r.URL.Path[len("/stream/"):]
+	s.stream(w, r, []string{address})
+}
+
+// streamAddresses streams the records stored for a comma separated list of addresses
+func (s *Server) streamAddresses(w http.ResponseWriter, r *http.Request) {
+	s.stream(w, r, strings.Split(r.URL.Query().Get("addresses"), ","))
+}
+
+// stream sends the records stored for the addresses as Server-Sent Events until the client goes
+// away. Records of mined transactions carry an id; a client reconnecting with the last id it
+// received in Last-Event-ID is first sent the stored records from that id's block onwards, so
+// records of that block may be sent twice. A stream that falls so far behind that events are
+// dropped is ended, so the client reconnects and resumes from the last record it received.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, addresses []string) {
+	if s.events == nil {
+		http.Error(w, "Streaming is not enabled", http.StatusNotFound)
+		return
+	}
+
+	watched := make(map[string]bool)
+	for _, address := range addresses {
+		address = utils.NormalizeAddress(address)
+		if address == "" {
+			continue
+		}
+		if !s.storage.IsSubscribed(address) {
+			http.Error(w, fmt.Sprintf("Address %s is not subscribed", address), http.StatusNotFound)
+			return
+		}
+		watched[address] = true
+	}
+	if len(watched) == 0 {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+
+	fromBlock := -1
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		block, ok := parseEventID(lastID)
+		if !ok {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		fromBlock = block
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before replaying so records stored in between are not missed
+	events, cancel := s.events.SubscribeEvents(s.streamBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Keeps nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	// Replay the stored records the client missed, skipping them when they also arrive live
+	replayed := make(map[string]bool)
+	if fromBlock >= 0 {
+		for _, event := range s.storedEvents(watched, fromBlock) {
+			id := eventID(event)
+			replayed[id] = true
+			if err := writeEvent(w, interfaces.EventTransaction, id, event); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+	s.log.Debug.Printf("Streaming %d addresses from block %d", len(watched), fromBlock)
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				// Events were dropped, let the client resume after the last one it received
+				s.log.Warn.Printf("Ending stream that fell behind the indexer")
+				return
+			}
+			switch {
+			case event.Transaction != nil && watched[event.Transaction.Address]:
+				// Records that are not mined cannot be resumed from, so they carry no id
+				id := ""
+				if mined(event.Transaction.Transaction) {
+					id = eventID(*event.Transaction)
+				}
+				if replayed[id] {
+					continue
+				}
+				tx := *event.Transaction
+				tx.Transaction = render(tx.Transaction)
+				err = writeEvent(w, interfaces.EventTransaction, id, tx)
+			case event.Reorg != nil && watchesAny(watched, event.Reorg.Addresses):
+				err = writeEvent(w, interfaces.EventReorg, "", event.Reorg)
+			default:
+				continue
+			}
+		}
+		if err != nil {
+			s.log.Debug.Printf("Stream closed: %v", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// storedEvents returns the stored records of mined transactions of the addresses from fromBlock
+// onwards, in block order
+func (s *Server) storedEvents(addresses map[string]bool, fromBlock int) []interfaces.TransactionEvent {
+	var events []interfaces.TransactionEvent
+	for address := range addresses {
+		for _, tx := range s.parser.GetTransactions(address) {
+			if tx.BlockNumber >= fromBlock && mined(tx) {
+				events = append(events, interfaces.TransactionEvent{Address: address, Transaction: render(tx)})
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Transaction.BlockNumber < events[j].Transaction.BlockNumber
+	})
+	return events
+}
+
+// mined reports whether a record is of a mined transaction rather than one seen in the mempool
+func mined(tx interfaces.Transaction) bool {
+	switch tx.Status {
+	case interfaces.StatusPending, interfaces.StatusReplaced, interfaces.StatusDropped:
+		return false
+	default:
+		return true
+	}
+}
+
+// eventID identifies a record sent on a stream by its block, address and record id
+func eventID(event interfaces.TransactionEvent) string {
+	return fmt.Sprintf("%d:%s:%s", event.Transaction.BlockNumber, event.Address, event.Transaction.RecordID())
+}
+
+// parseEventID returns the block of an event id
+func parseEventID(id string) (int, bool) {
+	block, _, ok := strings.Cut(id, ":")
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.Atoi(block)
+	if err != nil || number < 0 {
+		return 0, false
+	}
+	return number, true
+}
+
+// watchesAny reports whether any of the addresses is watched
+func watchesAny(watched map[string]bool, addresses []string) bool {
+	for _, address := range addresses {
+		if watched[address] {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON encoded payload. The id is left out
+// when empty, so the client keeps the last one it received.
+func writeEvent(w http.ResponseWriter, name, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		_, err = fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", name, id, payload)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+	}
+	return err
+}
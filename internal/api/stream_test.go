@@ -0,0 +1,290 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tx-parser/internal/events"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/storage"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sseFrame is a single Server-Sent Event, or a comment when only comment is set
+type sseFrame struct {
+	event   string
+	id      string
+	data    string
+	comment string
+}
+
+// readFrame reads the next frame of a Server-Sent Events stream
+func readFrame(t *testing.T, reader *bufio.Reader) sseFrame {
+	var frame sseFrame
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal("Error reading the stream:", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return frame
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "event":
+			frame.event = value
+		case "id":
+			frame.id = value
+		case "data":
+			frame.data = value
+		case "":
+			frame.comment = value
+		}
+	}
+}
+
+// readEvent reads frames until the next event, skipping heartbeats
+func readEvent(t *testing.T, reader *bufio.Reader) sseFrame {
+	for {
+		if frame := readFrame(t, reader); frame.event != "" {
+			return frame
+		}
+	}
+}
+
+// mockEventSource publishes the events of a bus
+type mockEventSource struct {
+	bus *events.Bus
+}
+
+func (m *mockEventSource) SubscribeEvents(buffer int) (<-chan interfaces.Event, func()) {
+	return m.bus.Subscribe(buffer)
+}
+
+// newStreamServer starts a server streaming the bus's events for the subscribed addresses
+func newStreamServer(t *testing.T, parser *mockParser, bus *events.Bus, addresses ...string) *httptest.Server {
+	s := storage.NewMemoryStorage()
+	for _, address := range addresses {
+		s.AddAddress(address)
+	}
+	return serveStreams(t, NewServer(parser, s, logger.GetLogger("debug")).WithEvents(&mockEventSource{bus: bus}))
+}
+
+// serveStreams starts serving the server's streams with a short heartbeat
+func serveStreams(t *testing.T, server *Server) *httptest.Server {
+	server.heartbeat = 20 * time.Millisecond
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", server.streamAddresses)
+	mux.HandleFunc("/stream/", server.streamAddress)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// openStream connects to a stream, resuming after lastID when set
+func openStream(t *testing.T, url, lastID string) (*http.Response, *bufio.Reader) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error opening the stream:", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// transactionEvent returns the event of a record stored for address
+func transactionEvent(address string, tx interfaces.Transaction) interfaces.Event {
+	return interfaces.Event{
+		Type:        interfaces.EventTransaction,
+		Transaction: &interfaces.TransactionEvent{Address: address, Transaction: tx},
+	}
+}
+
+// waitForSubscriber waits until the stream has subscribed to the bus, so published events reach it
+func waitForSubscriber(t *testing.T, reader *bufio.Reader) {
+	// The first heartbeat is only sent once the stream is subscribed
+	for readFrame(t, reader).comment != "heartbeat" {
+	}
+}
+
+func TestStream(t *testing.T) {
+	bus := events.NewBus()
+	ts := newStreamServer(t, &mockParser{}, bus, "0xtestaddress")
+	resp, reader := openStream(t, ts.URL+"/stream/0xTestAddress", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Status code should be 200")
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"), "Response should be an event stream")
+	waitForSubscriber(t, reader)
+
+	// Only records of the streamed address are sent, with amounts rendered
+	bus.Publish(transactionEvent("0xother", interfaces.Transaction{Hash: "0x1", BlockNumber: 5, Value: big.NewInt(1)}))
+	bus.Publish(transactionEvent("0xtestaddress", interfaces.Transaction{Hash: "0x2", BlockNumber: 5, Value: big.NewInt(1e18), Status: interfaces.StatusUnconfirmed}))
+	frame := readEvent(t, reader)
+	assert.Equal(t, interfaces.EventTransaction, frame.event, "Event should be a transaction")
+	assert.Equal(t, "5:0xtestaddress:0x2", frame.id, "Event id should locate the record")
+	var event interfaces.TransactionEvent
+	json.Unmarshal([]byte(frame.data), &event)
+	assert.Equal(t, "0x2", event.Transaction.Hash, "Event should carry the record")
+	assert.Equal(t, "1", event.Transaction.ValueEther, "Event should render the value in ether")
+
+	// Records from the mempool cannot be resumed from, so they have no id
+	bus.Publish(transactionEvent("0xtestaddress", interfaces.Transaction{Hash: "0x3", Status: interfaces.StatusPending}))
+	frame = readEvent(t, reader)
+	assert.Empty(t, frame.id, "Pending record should have no event id")
+
+	// Reorgs touching the address are forwarded
+	bus.Publish(interfaces.Event{Type: interfaces.EventReorg, Reorg: &interfaces.ReorgEvent{Depth: 1, FromBlock: 5, ToBlock: 5, Addresses: []string{"0xtestaddress"}}})
+	frame = readEvent(t, reader)
+	assert.Equal(t, interfaces.EventReorg, frame.event, "Event should be a reorg")
+}
+
+func TestStream_Resume(t *testing.T) {
+	bus := events.NewBus()
+	parser := &mockParser{transactions: map[string][]interfaces.Transaction{
+		"0xtestaddress": {
+			{Hash: "0x1", BlockNumber: 4, Value: big.NewInt(1)},
+			{Hash: "0x2", BlockNumber: 5, Value: big.NewInt(1)},
+			{Hash: "0x3", BlockNumber: 6, Value: big.NewInt(1)},
+			{Hash: "0x4", Status: interfaces.StatusPending, Value: big.NewInt(1)},
+		},
+	}}
+	ts := newStreamServer(t, parser, bus, "0xtestaddress")
+
+	// Records from the last event's block onwards are replayed, leaving out pending ones
+	_, reader := openStream(t, ts.URL+"/stream/0xtestaddress", "5:0xtestaddress:0x2")
+	assert.Equal(t, "5:0xtestaddress:0x2", readEvent(t, reader).id, "Records of the last event's block should be replayed")
+	assert.Equal(t, "6:0xtestaddress:0x3", readEvent(t, reader).id, "Later records should be replayed")
+
+	// A replayed record arriving live is not sent again
+	waitForSubscriber(t, reader)
+	bus.Publish(transactionEvent("0xtestaddress", interfaces.Transaction{Hash: "0x3", BlockNumber: 6, Value: big.NewInt(1)}))
+	bus.Publish(transactionEvent("0xtestaddress", interfaces.Transaction{Hash: "0x5", BlockNumber: 7, Value: big.NewInt(1)}))
+	assert.Equal(t, "7:0xtestaddress:0x5", readEvent(t, reader).id, "Only new records should be sent live")
+
+	resp, _ := openStream(t, ts.URL+"/stream/0xtestaddress", "not-an-id")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code should be 400 for an invalid Last-Event-ID")
+}
+
+func TestStream_MultipleAddresses(t *testing.T) {
+	bus := events.NewBus()
+	ts := newStreamServer(t, &mockParser{}, bus, "0xalice", "0xbob")
+
+	resp, _ := openStream(t, ts.URL+"/stream?addresses=0xalice,0xcarol", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Status code should be 404 for an address that is not subscribed")
+	resp, _ = openStream(t, ts.URL+"/stream?addresses=", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Status code should be 400 without addresses")
+
+	_, reader := openStream(t, ts.URL+"/stream?addresses=0xAlice,0xbob", "")
+	waitForSubscriber(t, reader)
+	bus.Publish(transactionEvent("0xalice", interfaces.Transaction{Hash: "0x1", BlockNumber: 5}))
+	bus.Publish(transactionEvent("0xcarol", interfaces.Transaction{Hash: "0x2", BlockNumber: 5}))
+	bus.Publish(transactionEvent("0xbob", interfaces.Transaction{Hash: "0x1", BlockNumber: 5}))
+	assert.Equal(t, "5:0xalice:0x1", readEvent(t, reader).id, "Records of the first address should be sent")
+	assert.Equal(t, "5:0xbob:0x1", readEvent(t, reader).id, "Records of the second address should be sent")
+}
+
+// slowParser serves the stored transactions as of each call, then holds the call until released
+type slowParser struct {
+	mockParser
+	mu      sync.Mutex
+	called  chan struct{} // Signalled when a call is held
+	release chan struct{} // Closed to let calls return
+}
+
+func (p *slowParser) store(address string, tx interfaces.Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transactions[address] = append(p.transactions[address], tx)
+}
+
+func (p *slowParser) GetTransactions(address string) []interfaces.Transaction {
+	p.mu.Lock()
+	transactions := append([]interfaces.Transaction(nil), p.transactions[address]...)
+	p.mu.Unlock()
+
+	select {
+	case p.called <- struct{}{}:
+	default:
+	}
+	<-p.release
+	return transactions
+}
+
+// readIDs reads a stream until it ends, or until a heartbeat when untilHeartbeat is set, and
+// returns the ids of its events
+func readIDs(t *testing.T, reader *bufio.Reader, untilHeartbeat bool) []string {
+	var ids []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return ids
+		}
+		if err != nil {
+			t.Fatal("Error reading the stream:", err)
+		}
+		if id, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "id: "); ok {
+			ids = append(ids, id)
+		}
+		if untilHeartbeat && line == ": heartbeat\n" {
+			return ids
+		}
+	}
+}
+
+// Test that records published while a stream cannot keep up are not skipped once it resumes
+func TestStream_ResumeAfterOverflow(t *testing.T) {
+	bus := events.NewBus()
+	parser := &slowParser{
+		mockParser: mockParser{transactions: map[string][]interfaces.Transaction{
+			"0xtestaddress": {{Hash: "0x1", BlockNumber: 4}},
+		}},
+		called:  make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	s := storage.NewMemoryStorage()
+	s.AddAddress("0xtestaddress")
+	server := NewServer(parser, s, logger.GetLogger("debug")).WithEvents(&mockEventSource{bus: bus})
+	server.streamBuffer = 2
+	ts := serveStreams(t, server)
+
+	// Records keep being stored while the stream replays, overflowing its buffer
+	readers := make(chan *bufio.Reader)
+	go func() {
+		_, reader := openStream(t, ts.URL+"/stream/0xtestaddress", "4:0xtestaddress:0x1")
+		readers <- reader
+	}()
+	<-parser.called
+	var want []string
+	for i := 2; i <= 6; i++ {
+		tx := interfaces.Transaction{Hash: fmt.Sprintf("0x%d", i), BlockNumber: 3 + i}
+		parser.store("0xtestaddress", tx)
+		bus.Publish(transactionEvent("0xtestaddress", tx))
+		want = append(want, fmt.Sprintf("%d:0xtestaddress:0x%d", tx.BlockNumber, i))
+	}
+	close(parser.release)
+
+	// The stream ends after the records it could queue, instead of silently skipping the rest
+	ids := readIDs(t, <-readers, false)
+	assert.Equal(t, []string{"4:0xtestaddress:0x1", "5:0xtestaddress:0x2", "6:0xtestaddress:0x3"}, ids, "Stream should end after the queued records")
+
+	// Resuming from the last received id sends the records the stream dropped
+	_, reader := openStream(t, ts.URL+"/stream/0xtestaddress", ids[len(ids)-1])
+	ids = append(ids, readIDs(t, reader, true)...)
+	for _, id := range want {
+		assert.Contains(t, ids, id, "No record should be skipped after resuming")
+	}
+}
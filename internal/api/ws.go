@@ -0,0 +1,276 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsSendBuffer is the number of messages queued for a client before it is disconnected as too slow
+	wsSendBuffer = 256
+	// wsPingInterval is how often clients are pinged to detect dead connections
+	wsPingInterval = 30 * time.Second
+	// wsReadTimeout is how long a client may stay silent, pongs included, before it is dropped
+	wsReadTimeout = 2 * wsPingInterval
+	// wsWriteTimeout bounds every write to a client
+	wsWriteTimeout = 10 * time.Second
+	// wsMaxMessageSize bounds the size of a client's requests
+	wsMaxMessageSize = 64 * 1024
+)
+
+// WebSocket request actions
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+)
+
+// WebSocket message types sent besides the indexer's events
+const (
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsError        = "error"
+)
+
+// wsRequest is a message sent by a client
+type wsRequest struct {
+	ID        string   `json:"id,omitempty"` // Echoed in the reply
+	Action    string   `json:"action"`
+	Addresses []string `json:"addresses"`
+}
+
+// wsMessage is a message sent to a client: the reply to a request or an indexer event
+type wsMessage struct {
+	Type         string                        `json:"type"`
+	ID           string                        `json:"id,omitempty"`
+	Addresses    []string                      `json:"addresses,omitempty"` // Addresses watched after a request
+	Error        string                        `json:"error,omitempty"`
+	Transaction  *interfaces.TransactionEvent  `json:"transaction,omitempty"`
+	Confirmation *interfaces.ConfirmationEvent `json:"confirmation,omitempty"`
+	Reorg        *interfaces.ReorgEvent        `json:"reorg,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// wsClient is a WebSocket connection and the addresses it watches. Only its write loop writes to
+// the connection.
+type wsClient struct {
+	conn *websocket.Conn
+	send chan wsMessage
+
+	mu        sync.Mutex
+	addresses map[string]bool
+
+	closeOnce   sync.Once
+	done        chan struct{} // Closed once the connection is shutting down
+	closeCode   int           // Sent in a close frame when set
+	closeReason string
+}
+
+// closeWith shuts the connection down, telling the client why when code is set. Only the first
+// call has an effect.
+func (c *wsClient) closeWith(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeCode, c.closeReason = code, reason
+		close(c.done)
+	})
+}
+
+// enqueue queues a message without blocking, disconnecting a client that does not keep up
+func (c *wsClient) enqueue(msg wsMessage) {
+	select {
+	case c.send <- msg:
+	default:
+		c.closeWith(websocket.ClosePolicyViolation, "slow consumer")
+	}
+}
+
+// watch adds or removes addresses and returns the addresses watched afterwards
+func (c *wsClient) watch(addresses []string, watched bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, address := range addresses {
+		if watched {
+			c.addresses[address] = true
+		} else {
+			delete(c.addresses, address)
+		}
+	}
+
+	all := make([]string, 0, len(c.addresses))
+	for address := range c.addresses {
+		all = append(all, address)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// watches reports whether any of the addresses is watched
+func (c *wsClient) watches(addresses ...string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, address := range addresses {
+		if c.addresses[address] {
+			return true
+		}
+	}
+	return false
+}
+
+// serveWS upgrades the request to a WebSocket connection where the client subscribes to addresses
+// and is sent their transaction, confirmation and reorg events. A client whose queue of unsent
+// messages fills up is disconnected rather than slowing down the others.
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		http.Error(w, "Streaming is not enabled", http.StatusNotFound)
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already answered the request
+		s.log.Debug.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	client := &wsClient{
+		conn:      conn,
+		send:      make(chan wsMessage, s.wsBuffer),
+		addresses: make(map[string]bool),
+		done:      make(chan struct{}),
+	}
+	events, cancel := s.events.SubscribeEvents(s.streamBuffer)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.writeWS(client)
+	}()
+	go func() {
+		defer wg.Done()
+		s.readWS(client)
+	}()
+	defer wg.Wait()
+	defer client.closeWith(0, "")
+
+	s.log.Debug.Printf("WebSocket client %s connected", r.RemoteAddr)
+	for {
+		select {
+		case <-r.Context().Done():
+			client.closeWith(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-client.done:
+			if client.closeCode == websocket.ClosePolicyViolation {
+				s.log.Warn.Printf("Disconnecting slow WebSocket client %s", r.RemoteAddr)
+			}
+			return
+		case event, ok := <-events:
+			if !ok {
+				// Events were dropped, the client has to catch up from the stored transactions
+				client.closeWith(websocket.CloseTryAgainLater, "events dropped")
+				return
+			}
+			switch {
+			case event.Transaction != nil && client.watches(event.Transaction.Address):
+				tx := *event.Transaction
+				tx.Transaction = render(tx.Transaction)
+				client.enqueue(wsMessage{Type: interfaces.EventTransaction, Transaction: &tx})
+			case event.Confirmation != nil && client.watches(event.Confirmation.Address):
+				client.enqueue(wsMessage{Type: interfaces.EventConfirmation, Confirmation: event.Confirmation})
+			case event.Reorg != nil && client.watches(event.Reorg.Addresses...):
+				client.enqueue(wsMessage{Type: interfaces.EventReorg, Reorg: event.Reorg})
+			}
+		}
+	}
+}
+
+// readWS handles a client's requests until the connection fails or is closed
+func (s *Server) readWS(client *wsClient) {
+	defer client.closeWith(0, "")
+
+	client.conn.SetReadLimit(wsMaxMessageSize)
+	client.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	})
+	for {
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		client.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			client.enqueue(wsMessage{Type: wsError, Error: "Invalid request"})
+			continue
+		}
+		client.enqueue(s.handleWSRequest(client, req))
+	}
+}
+
+// handleWSRequest subscribes or unsubscribes a client and returns the reply. Only addresses
+// subscribed through /subscribe can be watched, as a connection never changes what is indexed.
+func (s *Server) handleWSRequest(client *wsClient, req wsRequest) wsMessage {
+	var addresses []string
+	for _, address := range req.Addresses {
+		if address = utils.NormalizeAddress(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		return wsMessage{Type: wsError, ID: req.ID, Error: "Addresses are required"}
+	}
+
+	switch req.Action {
+	case wsSubscribe:
+		for _, address := range addresses {
+			if !s.storage.IsSubscribed(address) {
+				return wsMessage{Type: wsError, ID: req.ID, Error: fmt.Sprintf("Address %s is not subscribed", address)}
+			}
+		}
+		return wsMessage{Type: wsSubscribed, ID: req.ID, Addresses: client.watch(addresses, true)}
+	case wsUnsubscribe:
+		return wsMessage{Type: wsUnsubscribed, ID: req.ID, Addresses: client.watch(addresses, false)}
+	default:
+		return wsMessage{Type: wsError, ID: req.ID, Error: fmt.Sprintf("Unknown action %q", req.Action)}
+	}
+}
+
+// writeWS sends queued messages and pings to a client until the connection shuts down, then
+// closes it
+func (s *Server) writeWS(client *wsClient) {
+	defer client.conn.Close()
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-client.done:
+			if client.closeCode != 0 {
+				message := websocket.FormatCloseMessage(client.closeCode, client.closeReason)
+				client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteTimeout))
+			}
+			return
+		case msg := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err = client.conn.WriteJSON(msg)
+		case <-ping.C:
+			err = client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		}
+		if err != nil {
+			client.closeWith(0, "")
+			return
+		}
+	}
+}
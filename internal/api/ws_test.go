@@ -0,0 +1,143 @@
+package api
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tx-parser/internal/events"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/storage"
+	"tx-parser/pkg/logger"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newWSServer starts a server sending the bus's events over WebSocket connections, with 0xalice
+// and 0xbob subscribed
+func newWSServer(t *testing.T, bus *events.Bus, buffer int) *httptest.Server {
+	parser := &mockParser{subscribed: make(map[string]bool)}
+	s := storage.NewMemoryStorage()
+	s.AddAddress("0xalice")
+	s.AddAddress("0xbob")
+	server := NewServer(parser, s, logger.GetLogger("debug")).WithEvents(&mockEventSource{bus: bus})
+	server.wsBuffer = buffer
+	ts := httptest.NewServer(http.HandlerFunc(server.serveWS))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// dialWS connects to the server's WebSocket endpoint
+func dialWS(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal("Error connecting:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// request sends a request and returns the reply
+func request(t *testing.T, conn *websocket.Conn, req wsRequest) wsMessage {
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatal("Error sending request:", err)
+	}
+	return readMessage(t, conn)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal("Error reading message:", err)
+	}
+	return msg
+}
+
+func TestWS_Subscriptions(t *testing.T) {
+	bus := events.NewBus()
+	ts := newWSServer(t, bus, wsSendBuffer)
+	conn := dialWS(t, ts)
+
+	// Subscribing replies with every watched address
+	reply := request(t, conn, wsRequest{ID: "1", Action: wsSubscribe, Addresses: []string{"0xBob", " 0xalice "}})
+	assert.Equal(t, wsSubscribed, reply.Type, "Reply should confirm the subscription")
+	assert.Equal(t, "1", reply.ID, "Reply should echo the request id")
+	assert.Equal(t, []string{"0xalice", "0xbob"}, reply.Addresses, "Reply should list the normalized addresses")
+
+	// Only events of watched addresses are sent
+	bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xcarol", Transaction: interfaces.Transaction{Hash: "0x1"}}})
+	bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xalice", Transaction: interfaces.Transaction{Hash: "0x2", Value: big.NewInt(1e18)}}})
+	bus.Publish(interfaces.Event{Type: interfaces.EventConfirmation, Confirmation: &interfaces.ConfirmationEvent{Address: "0xbob", BlockNumber: 5, Status: interfaces.StatusConfirmed, Hashes: []string{"0x2"}}})
+	bus.Publish(interfaces.Event{Type: interfaces.EventReorg, Reorg: &interfaces.ReorgEvent{Depth: 1, FromBlock: 5, ToBlock: 5, Addresses: []string{"0xcarol", "0xbob"}}})
+
+	msg := readMessage(t, conn)
+	assert.Equal(t, interfaces.EventTransaction, msg.Type, "Should send the watched transaction")
+	assert.Equal(t, "0x2", msg.Transaction.Transaction.Hash, "Should send the record")
+	assert.Equal(t, "1", msg.Transaction.Transaction.ValueEther, "Should render the value in ether")
+	msg = readMessage(t, conn)
+	assert.Equal(t, interfaces.EventConfirmation, msg.Type, "Should send the confirmation")
+	assert.Equal(t, interfaces.StatusConfirmed, msg.Confirmation.Status, "Confirmation should carry the new status")
+	msg = readMessage(t, conn)
+	assert.Equal(t, interfaces.EventReorg, msg.Type, "Should send reorgs affecting a watched address")
+
+	// Unsubscribed addresses are no longer sent
+	reply = request(t, conn, wsRequest{Action: wsUnsubscribe, Addresses: []string{"0xalice"}})
+	assert.Equal(t, wsUnsubscribed, reply.Type, "Reply should confirm the unsubscription")
+	assert.Equal(t, []string{"0xbob"}, reply.Addresses, "Reply should list the remaining addresses")
+	bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xalice", Transaction: interfaces.Transaction{Hash: "0x3"}}})
+	bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xbob", Transaction: interfaces.Transaction{Hash: "0x4"}}})
+	msg = readMessage(t, conn)
+	assert.Equal(t, "0x4", msg.Transaction.Transaction.Hash, "Should only send events of watched addresses")
+
+	// Invalid requests are answered with an error and keep the connection open
+	reply = request(t, conn, wsRequest{ID: "2", Action: "watch", Addresses: []string{"0xalice"}})
+	assert.Equal(t, wsError, reply.Type, "Unknown actions should be rejected")
+	assert.Equal(t, "2", reply.ID, "Error should echo the request id")
+	reply = request(t, conn, wsRequest{Action: wsSubscribe, Addresses: []string{" "}})
+	assert.Equal(t, "Addresses are required", reply.Error, "Requests without addresses should be rejected")
+
+	// Addresses that are not subscribed cannot be watched, and are not subscribed by the request
+	reply = request(t, conn, wsRequest{ID: "3", Action: wsSubscribe, Addresses: []string{"0xalice", "0xCarol"}})
+	assert.Equal(t, wsError, reply.Type, "Addresses that are not subscribed should be rejected")
+	assert.Equal(t, "Address 0xcarol is not subscribed", reply.Error, "Error should name the address")
+	reply = request(t, conn, wsRequest{Action: wsUnsubscribe, Addresses: []string{"0xcarol"}})
+	assert.Equal(t, []string{"0xbob"}, reply.Addresses, "A rejected request should not change the watched addresses")
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	assert.Equal(t, "Invalid request", readMessage(t, conn).Error, "Malformed requests should be rejected")
+}
+
+// Test that a client that does not read its messages is disconnected instead of queueing without bound
+func TestWS_SlowConsumer(t *testing.T) {
+	bus := events.NewBus()
+	ts := newWSServer(t, bus, 1)
+	conn := dialWS(t, ts)
+	request(t, conn, wsRequest{Action: wsSubscribe, Addresses: []string{"0xalice"}})
+
+	// Large messages fill the socket buffers while the client does not read
+	input := "0x" + strings.Repeat("ab", 64*1024)
+	for i := 0; i < 1000; i++ {
+		bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xalice", Transaction: interfaces.Transaction{Hash: "0x1", Input: input}}})
+		time.Sleep(100 * time.Microsecond)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) {
+			t.Fatal("Expected a close frame, got:", err)
+		}
+		assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code, "Slow client should be disconnected with a policy violation")
+		assert.Equal(t, "slow consumer", closeErr.Text, "Close frame should give the reason")
+		return
+	}
+}
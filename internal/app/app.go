@@ -1,22 +1,32 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"sync"
 	"tx-parser/internal/api"
 	"tx-parser/internal/config"
+	"tx-parser/internal/grpcapi"
 	"tx-parser/internal/interfaces"
 	"tx-parser/internal/parser"
 	"tx-parser/internal/rpc"
 	"tx-parser/internal/storage"
+	"tx-parser/internal/webhook"
 	"tx-parser/pkg/logger"
 )
 
 type App struct {
-	apiServer *api.Server
-	parser    interfaces.Parser
-	config    *config.Config
-	log       *logger.Logger
+	apiServer  *api.Server
+	grpcServer *grpcapi.Server // Nil unless a gRPC port is configured
+	rpcPool    *rpc.Pool
+	webhooks   *webhook.Dispatcher
+	parser     interfaces.Parser
+	indexer    interfaces.Indexer
+	storage    interfaces.Storage
+	config     *config.Config
+	log        *logger.Logger
 }
 
 func NewApp(configPath string) (*App, error) {
@@ -31,27 +41,119 @@ func NewApp(configPath string) (*App, error) {
 	log := logger.GetLogger(cfg.Logging.Level)
 
 	// Initialize storage
-	storage := storage.NewMemoryStorage()
+	storage, err := newStorage(cfg.Storage, log)
+	if err != nil {
+		log.Error.Printf("Failed to initialize storage: %v", err)
+		return nil, err
+	}
+
+	// Initialize the Ethereum RPC endpoint pool, falling back to the single configured endpoint
+	rpcConfig := cfg.RPC
+	if len(rpcConfig.Endpoints) == 0 {
+		rpcConfig.Endpoints = []string{cfg.Server.Ethrpc}
+	}
+	rpcPool, err := rpc.NewPool(rpcConfig, log)
+	if err != nil {
+		log.Error.Printf("Failed to initialize RPC pool: %v", err)
+		return nil, err
+	}
 
-	// Initialize Ethereum RPC client
-	rpcClient := rpc.NewClient(cfg.Server.Ethrpc, log)
+	// Initialize the webhook dispatcher, which queues deliveries for every record the parser stores
+	webhooks := webhook.NewDispatcher(storage, cfg.Webhooks, log)
 
 	// Initialize parser
-	ethParser := parser.NewEthParser(rpcClient, storage, log)
+	ethParser := parser.NewEthParser(rpcPool, storage, log, cfg.Parser).WithNotifier(webhooks)
+	if cfg.RPC.WSEndpoint != "" {
+		ethParser.WithHeadSubscriber(rpc.NewWSClient(cfg.RPC.WSEndpoint, cfg.RPC.ConnectTimeout, log))
+	}
+	if cfg.Parser.Mempool {
+		ethParser.WithPendingSubscriber(rpc.NewWSClient(cfg.RPC.WSEndpoint, cfg.RPC.ConnectTimeout, log), cfg.Parser.PendingTimeout)
+	}
 
 	// Initialize API server
-	apiServer := api.NewServer(ethParser, storage, log)
+	apiServer := api.NewServer(ethParser, storage, log).WithRPCPool(rpcPool).WithWebhooks(webhooks).WithEvents(ethParser)
+
+	// Initialize the gRPC server, sharing the parser and storage with the API server
+	var grpcServer *grpcapi.Server
+	if cfg.Server.GRPCPort != "" {
+		grpcServer = grpcapi.NewServer(ethParser, storage, log).WithEvents(ethParser)
+	}
 
 	return &App{
-		apiServer: apiServer,
-		parser:    ethParser,
-		config:    cfg,
-		log:       log,
+		apiServer:  apiServer,
+		grpcServer: grpcServer,
+		rpcPool:    rpcPool,
+		webhooks:   webhooks,
+		parser:     ethParser,
+		indexer:    ethParser,
+		storage:    storage,
+		config:     cfg,
+		log:        log,
 	}, nil
 }
 
-func (a *App) Run() error {
+// Run serves the API and indexes new blocks until ctx is cancelled or the server fails
+func (a *App) Run(ctx context.Context) error {
+	// Index new blocks in the background for as long as the API server runs
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if a.rpcPool != nil {
+		go a.rpcPool.Run(ctx)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.indexer.Run(ctx, a.config.Parser.PollInterval)
+	}()
+	if a.webhooks != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.webhooks.Run(ctx)
+		}()
+	}
+
+	var grpcErr error
+	if a.grpcServer != nil {
+		grpcAddr := fmt.Sprintf("%s%s", a.config.Server.Host, a.config.Server.GRPCPort)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.log.Info.Printf("Starting gRPC server on %s...", grpcAddr)
+			if grpcErr = a.grpcServer.Start(ctx, grpcAddr); grpcErr != nil {
+				// Stop the API server too rather than running without the gRPC API
+				cancel()
+			}
+		}()
+	}
+
 	serverAddr := fmt.Sprintf("%s%s", a.config.Server.Host, a.config.Server.Port)
 	a.log.Info.Printf("Starting API server on %s...", serverAddr)
-	return a.apiServer.Start(serverAddr) // Start the API server with the configured address
+	err := a.apiServer.Start(ctx, serverAddr) // Start the API server with the configured address
+
+	// Stop indexing, webhook deliveries and the gRPC server before flushing persistent storage
+	cancel()
+	wg.Wait()
+	if err == nil {
+		err = grpcErr
+	}
+	if closer, ok := a.storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			a.log.Error.Printf("Failed to close storage: %v", err)
+		}
+	}
+	return err
+}
+
+// newStorage creates the storage backend selected in the configuration
+func newStorage(cfg config.StorageConfig, log *logger.Logger) (interfaces.Storage, error) {
+	switch cfg.Type {
+	case "", "memory":
+		return storage.NewMemoryStorage(), nil
+	case "file":
+		return storage.NewFileStorage(cfg.Path, cfg.SnapshotEvery, log)
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", cfg.Type)
+	}
 }
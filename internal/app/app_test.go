@@ -1,11 +1,11 @@
 package app
 
 import (
+	"context"
 	"testing"
 
 	"tx-parser/internal/api"
 	"tx-parser/internal/config"
-	"tx-parser/internal/interfaces"
 	"tx-parser/internal/parser"
 	"tx-parser/internal/rpc"
 	"tx-parser/internal/storage"
@@ -31,18 +31,34 @@ func mockConfig() *config.Config {
 // mockRPCClient is a mock implementation of the RPC client
 type mockRPCClient struct{}
 
-func (m *mockRPCClient) FetchCurrentBlock() (int, error) {
+func (m *mockRPCClient) FetchCurrentBlock(ctx context.Context) (int, error) {
 	return 123456, nil
 }
 
-func (m *mockRPCClient) FetchBlockByNumber(blockNumber int) (*rpc.Block, error) {
+func (m *mockRPCClient) FetchBlockByNumber(ctx context.Context, blockNumber int) (*rpc.Block, error) {
 	return &rpc.Block{
-		Transactions: []interfaces.Transaction{
-			{From: "0xFrom", To: "0xTo", Value: "100", Hash: "0x123"},
+		Transactions: []rpc.Transaction{
+			{From: "0xFrom", To: "0xTo", Value: "0x64", Hash: "0x123"},
 		},
 	}, nil
 }
 
+func (m *mockRPCClient) FetchBlockByTag(ctx context.Context, tag string) (*rpc.Block, error) {
+	return &rpc.Block{Number: "0x1e240"}, nil
+}
+
+func (m *mockRPCClient) FetchTransactionReceipt(ctx context.Context, txHash string) (*rpc.Receipt, error) {
+	return &rpc.Receipt{TransactionHash: txHash, Status: "0x1", GasUsed: "0x5208"}, nil
+}
+
+func (m *mockRPCClient) FetchLogs(ctx context.Context, filter rpc.LogFilter) ([]rpc.Log, error) {
+	return nil, nil
+}
+
+func (m *mockRPCClient) CallContract(ctx context.Context, to, data string) (string, error) {
+	return "0x", nil
+}
+
 func TestNewApp(t *testing.T) {
 	// Mock the configuration
 	cfg := mockConfig()
@@ -57,7 +73,7 @@ func TestNewApp(t *testing.T) {
 	rpcClient := &mockRPCClient{}
 
 	// Initialize the parser
-	ethParser := parser.NewEthParser(rpcClient, storage, log)
+	ethParser := parser.NewEthParser(rpcClient, storage, log, cfg.Parser)
 
 	// Initialize API server
 	apiServer := api.NewServer(ethParser, storage, log)
@@ -66,6 +82,8 @@ func TestNewApp(t *testing.T) {
 	app := &App{
 		apiServer: apiServer,
 		parser:    ethParser,
+		indexer:   ethParser,
+		storage:   storage,
 		config:    cfg,
 		log:       log,
 	}
@@ -74,6 +92,27 @@ func TestNewApp(t *testing.T) {
 	assert.NotNil(t, app, "App should be initialized")
 	assert.NotNil(t, app.apiServer, "API server should be initialized")
 	assert.NotNil(t, app.parser, "Parser should be initialized")
+	assert.NotNil(t, app.indexer, "Indexer should be initialized")
+	assert.NotNil(t, app.storage, "Storage should be initialized")
 	assert.NotNil(t, app.config, "Config should be initialized")
 	assert.NotNil(t, app.log, "Logger should be initialized")
 }
+
+func TestNewStorage(t *testing.T) {
+	log := logger.GetLogger("debug")
+
+	// Memory storage is the default
+	s, err := newStorage(config.StorageConfig{}, log)
+	assert.Nil(t, err, "Expected no error for the default storage")
+	assert.IsType(t, &storage.MemoryStorage{}, s, "Default storage should be in memory")
+
+	// File storage is created in the configured directory
+	s, err = newStorage(config.StorageConfig{Type: "file", Path: t.TempDir()}, log)
+	assert.Nil(t, err, "Expected no error for file storage")
+	assert.IsType(t, &storage.FileStorage{}, s, "Storage should be file backed")
+	s.(*storage.FileStorage).Close()
+
+	// Unknown storage types are rejected
+	_, err = newStorage(config.StorageConfig{Type: "redis"}, log)
+	assert.NotNil(t, err, "Expected an error for an unknown storage type")
+}
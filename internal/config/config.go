@@ -1,20 +1,93 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
+// Parser start modes
+const (
+	StartResume = "resume" // Resume after the last checkpoint, or from the chain head if there is none
+	StartHead   = "head"   // Start from the chain head, ignoring any checkpoint
+	StartBlock  = "block"  // Start from ParserConfig.StartBlock
+)
+
+// Tracing APIs used to find internal transfers
+const (
+	TracesOff   = "off"   // Do not trace blocks
+	TracesDebug = "debug" // debug_traceBlockByNumber with the callTracer, as served by geth
+	TracesTrace = "trace" // trace_block, as served by Erigon and Nethermind
+)
+
 type Config struct {
-	Server  ServerConfig  `yaml:"server"`
-	Logging LoggingConfig `yaml:"logging"`
+	Server   ServerConfig  `yaml:"server"`
+	RPC      RPCConfig     `yaml:"rpc"`
+	Parser   ParserConfig  `yaml:"parser"`
+	Storage  StorageConfig `yaml:"storage"`
+	Webhooks WebhookConfig `yaml:"webhooks"`
+	Logging  LoggingConfig `yaml:"logging"`
 }
 
 type ServerConfig struct {
-	Port   string `yaml:"port"`
-	Host   string `yaml:"host"`
-	Ethrpc string `yaml:"ethrpc"`
+	Port     string `yaml:"port"`
+	Host     string `yaml:"host"`
+	Ethrpc   string `yaml:"ethrpc"`
+	GRPCPort string `yaml:"grpc_port"` // Serves the gRPC API alongside the HTTP API when set
+}
+
+type RPCConfig struct {
+	Endpoints           []string      `yaml:"endpoints"`   // Defaults to server.ethrpc when empty
+	WSEndpoint          string        `yaml:"ws_endpoint"` // Optional, subscribes to new heads instead of only polling
+	ConnectTimeout      time.Duration `yaml:"connect_timeout"`
+	RequestTimeout      time.Duration `yaml:"request_timeout"`
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	MaxHeadLag          int           `yaml:"max_head_lag"`
+	Retry               RetryConfig   `yaml:"retry"`
+}
+
+type RetryConfig struct {
+	MaxAttempts      int           `yaml:"max_attempts"`
+	InitialBackoff   time.Duration `yaml:"initial_backoff"`
+	MaxBackoff       time.Duration `yaml:"max_backoff"`
+	Jitter           *float64      `yaml:"jitter"`             // Unset uses the default, 0 disables jitter
+	RetryStatusCodes []int         `yaml:"retry_status_codes"` // Unset uses the defaults, empty retries no status
+	RetryRPCCodes    []int         `yaml:"retry_rpc_codes"`    // Unset uses the defaults, empty retries no code
+}
+
+type ParserConfig struct {
+	PollInterval  time.Duration `yaml:"poll_interval"`
+	ReorgDepth    int           `yaml:"reorg_depth"`
+	Confirmations int           `yaml:"confirmations"`
+	Start         string        `yaml:"start"`
+	StartBlock    int           `yaml:"start_block"`
+
+	FetchWorkers        int `yaml:"fetch_workers"`
+	BatchSize           int `yaml:"batch_size"`
+	BackfillConcurrency int `yaml:"backfill_concurrency"`
+
+	Traces string `yaml:"traces"` // Tracing API used to find internal transfers, off when empty
+
+	Mempool        bool          `yaml:"mempool"`         // Watch pending transactions, requires rpc.ws_endpoint
+	PendingTimeout time.Duration `yaml:"pending_timeout"` // Pending transactions unknown to the node for this long are dropped
+}
+
+type StorageConfig struct {
+	Type          string `yaml:"type"` // "memory" or "file"
+	Path          string `yaml:"path"`
+	SnapshotEvery int    `yaml:"snapshot_every"`
+}
+
+type WebhookConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"` // Attempts before a delivery becomes a dead letter
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Timeout        time.Duration `yaml:"timeout"`       // Bounds a single delivery attempt
+	Workers        int           `yaml:"workers"`       // Deliveries sent concurrently
+	SkipBackfill   bool          `yaml:"skip_backfill"` // Do not deliver records found by backfills
+	SkipPending    bool          `yaml:"skip_pending"`  // Do not deliver pending, replaced or dropped mempool records
 }
 
 type LoggingConfig struct {
@@ -36,5 +109,37 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
+
+// validate checks configuration values that cannot be defaulted
+func (c *Config) validate() error {
+	switch c.Parser.Start {
+	case "", StartResume, StartHead:
+	case StartBlock:
+		if c.Parser.StartBlock < 0 {
+			return fmt.Errorf("parser.start_block must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown parser.start %q", c.Parser.Start)
+	}
+	switch c.Parser.Traces {
+	case "", TracesOff, TracesDebug, TracesTrace:
+	default:
+		return fmt.Errorf("unknown parser.traces %q", c.Parser.Traces)
+	}
+	if jitter := c.RPC.Retry.Jitter; jitter != nil && (*jitter < 0 || *jitter > 1) {
+		return fmt.Errorf("rpc.retry.jitter must be between 0 and 1")
+	}
+	if c.Parser.Mempool && c.RPC.WSEndpoint == "" {
+		return fmt.Errorf("parser.mempool requires rpc.ws_endpoint")
+	}
+	if len(c.RPC.Endpoints) == 0 && c.Server.Ethrpc == "" {
+		return fmt.Errorf("either server.ethrpc or rpc.endpoints must be set")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfig writes a config file to a temporary directory and returns its path
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal("Error writing config file:", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: ":8088"
+  host: "localhost"
+  ethrpc: "http://localhost:8545"
+parser:
+  poll_interval: 5s
+  start: block
+  start_block: 100
+logging:
+  level: info
+`)
+
+	cfg, err := LoadConfig(path)
+	assert.Nil(t, err, "Expected no error when loading a valid config")
+	assert.Equal(t, ":8088", cfg.Server.Port, "Server port should match")
+	assert.Equal(t, 5*time.Second, cfg.Parser.PollInterval, "Poll interval should be parsed as a duration")
+	assert.Equal(t, StartBlock, cfg.Parser.Start, "Start mode should match")
+	assert.Equal(t, 100, cfg.Parser.StartBlock, "Start block should match")
+}
+
+func TestLoadConfig_InvalidStart(t *testing.T) {
+	path := writeConfig(t, `
+parser:
+  start: genesis
+`)
+
+	_, err := LoadConfig(path)
+	assert.NotNil(t, err, "Expected an error for an unknown start mode")
+}
+
+func TestLoadConfig_Endpoints(t *testing.T) {
+	path := writeConfig(t, `
+rpc:
+  endpoints:
+    - "http://node1:8545"
+    - "http://node2:8545"
+  health_check_interval: 5s
+  max_head_lag: 3
+`)
+
+	cfg, err := LoadConfig(path)
+	assert.Nil(t, err, "Expected no error when endpoints replace server.ethrpc")
+	assert.Equal(t, []string{"http://node1:8545", "http://node2:8545"}, cfg.RPC.Endpoints, "Endpoints should match")
+	assert.Equal(t, 5*time.Second, cfg.RPC.HealthCheckInterval, "Health check interval should be parsed as a duration")
+	assert.Equal(t, 3, cfg.RPC.MaxHeadLag, "Max head lag should match")
+
+	// At least one endpoint is required
+	path = writeConfig(t, `
+logging:
+  level: info
+`)
+	_, err = LoadConfig(path)
+	assert.NotNil(t, err, "Expected an error without any RPC endpoint")
+}
+
+func TestLoadConfig_InvalidTraces(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  ethrpc: "http://localhost:8545"
+parser:
+  traces: parity
+`)
+
+	_, err := LoadConfig(path)
+	assert.NotNil(t, err, "Expected an error for an unknown tracing API")
+}
+
+func TestLoadConfig_MempoolWithoutWS(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  ethrpc: "http://localhost:8545"
+parser:
+  mempool: true
+`)
+
+	_, err := LoadConfig(path)
+	assert.NotNil(t, err, "Expected an error when watching the mempool without a WebSocket endpoint")
+}
+
+func TestLoadConfig_Retry(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  ethrpc: "http://localhost:8545"
+rpc:
+  retry:
+    jitter: 0
+    retry_status_codes: []
+`)
+
+	cfg, err := LoadConfig(path)
+	assert.Nil(t, err, "Expected no error for a valid retry config")
+	assert.NotNil(t, cfg.RPC.Retry.Jitter, "Zero jitter should be distinguishable from unset")
+	assert.Equal(t, 0.0, *cfg.RPC.Retry.Jitter, "Jitter should match")
+	assert.Equal(t, []int{}, cfg.RPC.Retry.RetryStatusCodes, "Empty status codes should be distinguishable from unset")
+	assert.Nil(t, cfg.RPC.Retry.RetryRPCCodes, "Unset RPC codes should be nil")
+
+	path = writeConfig(t, `
+server:
+  ethrpc: "http://localhost:8545"
+rpc:
+  retry:
+    jitter: 1.5
+`)
+	_, err = LoadConfig(path)
+	assert.NotNil(t, err, "Expected an error for jitter above 1")
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"sync"
+	"tx-parser/internal/interfaces"
+)
+
+// Bus fans out parser events to any number of subscribers
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[int]chan interfaces.Event
+	nextID      int
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[int]chan interfaces.Event),
+	}
+}
+
+// Subscribe registers a new subscriber and returns its event channel and a function to unsubscribe.
+// The channel is closed when the subscriber unsubscribes or falls behind, see Publish.
+func (b *Bus) Subscribe(buffer int) (<-chan interfaces.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan interfaces.Event, buffer)
+	b.subscribers[id] = ch
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(id)
+	}
+	return ch, cancel
+}
+
+// Publish delivers an event to every subscriber without blocking. A subscriber whose buffer is
+// full is unsubscribed and its channel closed, so it learns that it missed events rather than
+// silently skipping them. Returns the number of subscribers dropped.
+func (b *Bus) Publish(event interfaces.Event) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dropped := 0
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.remove(id)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// remove unsubscribes a subscriber and closes its channel, if it is still subscribed. The caller
+// must hold the lock.
+func (b *Bus) remove(id int) {
+	if ch, ok := b.subscribers[id]; ok {
+		delete(b.subscribers, id)
+		close(ch)
+	}
+}
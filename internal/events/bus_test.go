@@ -0,0 +1,36 @@
+package events
+
+import (
+	"testing"
+	"tx-parser/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishAndSubscribe(t *testing.T) {
+	bus := NewBus()
+
+	first, cancelFirst := bus.Subscribe(1)
+	second, cancelSecond := bus.Subscribe(1)
+	defer cancelSecond()
+
+	// Every subscriber receives the event
+	dropped := bus.Publish(interfaces.Event{Type: interfaces.EventReorg})
+	assert.Equal(t, 0, dropped, "No events should be dropped")
+	assert.Equal(t, interfaces.EventReorg, (<-first).Type, "First subscriber should receive the event")
+	assert.Equal(t, interfaces.EventReorg, (<-second).Type, "Second subscriber should receive the event")
+
+	// Unsubscribing closes the channel and stops delivery
+	cancelFirst()
+	_, open := <-first
+	assert.False(t, open, "Channel should be closed after unsubscribing")
+
+	// A full subscriber does not block publishing, and is dropped so it knows it missed events
+	bus.Publish(interfaces.Event{Type: interfaces.EventReorg})
+	dropped = bus.Publish(interfaces.Event{Type: interfaces.EventTransaction})
+	assert.Equal(t, 1, dropped, "Full subscriber should be dropped")
+	assert.Equal(t, interfaces.EventReorg, (<-second).Type, "Events queued before the overflow should be kept")
+	_, open = <-second
+	assert.False(t, open, "Channel should be closed after the overflow")
+	assert.Equal(t, 0, bus.Publish(interfaces.Event{Type: interfaces.EventReorg}), "Dropped subscriber should no longer receive events")
+}
@@ -0,0 +1,80 @@
+package grpcapi
+
+import (
+	"math/big"
+
+	"tx-parser/internal/grpcapi/pb"
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+)
+
+// toTransaction converts a stored record to its message, rendering amounts in ether as the HTTP
+// API does
+func toTransaction(tx interfaces.Transaction) *pb.Transaction {
+	msg := &pb.Transaction{
+		Kind:                 tx.Kind,
+		Hash:                 tx.Hash,
+		From:                 tx.From,
+		To:                   tx.To,
+		Value:                bigString(tx.Value),
+		ValueEther:           utils.FormatEther(tx.Value),
+		Incoming:             tx.Incoming,
+		Outgoing:             tx.Outgoing,
+		BlockNumber:          int64(tx.BlockNumber),
+		BlockHash:            tx.BlockHash,
+		TransactionIndex:     int32(tx.TransactionIndex),
+		Timestamp:            tx.Timestamp,
+		Nonce:                tx.Nonce,
+		Gas:                  tx.Gas,
+		GasPrice:             bigString(tx.GasPrice),
+		MaxFeePerGas:         bigString(tx.MaxFeePerGas),
+		MaxPriorityFeePerGas: bigString(tx.MaxPriorityFeePerGas),
+		Type:                 int32(tx.Type),
+		ChainId:              bigString(tx.ChainID),
+		Input:                tx.Input,
+		Status:               tx.Status,
+		ReplacedBy:           tx.ReplacedBy,
+		ReceiptStatus:        tx.ReceiptStatus,
+		GasUsed:              tx.GasUsed,
+		EffectiveGasPrice:    bigString(tx.EffectiveGasPrice),
+		Fee:                  bigString(tx.Fee),
+		FeeEther:             utils.FormatEther(tx.Fee),
+		ContractAddress:      tx.ContractAddress,
+		CallType:             tx.CallType,
+	}
+	for _, position := range tx.TracePath {
+		msg.TracePath = append(msg.TracePath, int32(position))
+	}
+	if token := tx.Token; token != nil {
+		msg.Token = &pb.TokenTransfer{
+			Contract: token.Contract,
+			Symbol:   token.Symbol,
+			Amount:   bigString(token.Amount),
+			Operator: token.Operator,
+			LogIndex: int32(token.LogIndex),
+		}
+		if token.Decimals != nil {
+			decimals := int32(*token.Decimals)
+			msg.Token.Decimals = &decimals
+			msg.Token.AmountDecimal = utils.FormatUnits(token.Amount, *token.Decimals)
+		}
+		for _, id := range token.TokenIDs {
+			msg.Token.TokenIds = append(msg.Token.TokenIds, bigString(id))
+		}
+		for _, quantity := range token.Quantities {
+			msg.Token.Quantities = append(msg.Token.Quantities, bigString(quantity))
+		}
+	}
+	if withdrawal := tx.Withdrawal; withdrawal != nil {
+		msg.Withdrawal = &pb.Withdrawal{Index: withdrawal.Index, ValidatorIndex: withdrawal.ValidatorIndex}
+	}
+	return msg
+}
+
+// bigString renders an amount as a decimal string, or an empty one when it is unknown
+func bigString(amount *big.Int) string {
+	if amount == nil {
+		return ""
+	}
+	return amount.String()
+}
@@ -0,0 +1,68 @@
+package grpcapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"tx-parser/internal/interfaces"
+)
+
+// cursor is the position of a record in the order transactions are listed in: by block, with
+// records that are not mined last, then by position in the block and record id. Unlike an offset,
+// it still points after the same record when records are added to or removed from earlier blocks.
+type cursor struct {
+	block int
+	index int
+	id    string
+}
+
+// cursorOf returns the position of a record
+func cursorOf(tx interfaces.Transaction) cursor {
+	block := tx.BlockNumber
+	switch tx.Status {
+	case interfaces.StatusPending, interfaces.StatusReplaced, interfaces.StatusDropped:
+		block = math.MaxInt
+	}
+	return cursor{block: block, index: tx.TransactionIndex, id: tx.RecordID()}
+}
+
+// before reports whether c comes before other
+func (c cursor) before(other cursor) bool {
+	if c.block != other.block {
+		return c.block < other.block
+	}
+	if c.index != other.index {
+		return c.index < other.index
+	}
+	return c.id < other.id
+}
+
+// token encodes the cursor as an opaque page token
+func (c cursor) token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%s", c.block, c.index, c.id)))
+}
+
+// parseCursor decodes a page token
+func parseCursor(token string) (cursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor{}, false
+	}
+	// Record ids may contain colons, so the id is everything after the second one
+	parts := strings.SplitN(string(data), ":", 3)
+	if len(parts) != 3 {
+		return cursor{}, false
+	}
+	block, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return cursor{}, false
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return cursor{}, false
+	}
+	return cursor{block: block, index: index, id: parts[2]}, true
+}
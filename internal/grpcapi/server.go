@@ -0,0 +1,294 @@
+// Package grpcapi serves the parser over gRPC, alongside the HTTP API
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative parser.proto
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"tx-parser/internal/grpcapi/pb"
+	"tx-parser/internal/interfaces"
+	"tx-parser/pkg/logger"
+	"tx-parser/utils"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// shutdownTimeout bounds how long in-flight calls may take to finish once the server stops
+	shutdownTimeout = 10 * time.Second
+	// defaultPageSize is the number of transactions listed per page when the request sets none
+	defaultPageSize = 100
+	// maxPageSize caps the number of transactions listed per page
+	maxPageSize = 1000
+	// watchBuffer is the default number of events queued for a watch while it sends to a slow client
+	watchBuffer = 256
+)
+
+// Server implements the Parser gRPC service on top of the same parser and storage as the HTTP API
+type Server struct {
+	pb.UnimplementedParserServer
+	parser      interfaces.Parser
+	storage     interfaces.Storage
+	events      interfaces.EventSource
+	log         *logger.Logger
+	watchBuffer int // Events queued for a watch before it is ended for falling behind
+}
+
+func NewServer(p interfaces.Parser, s interfaces.Storage, log *logger.Logger) *Server {
+	return &Server{
+		parser:      p,
+		storage:     s,
+		log:         log,
+		watchBuffer: watchBuffer,
+	}
+}
+
+// WithEvents streams the transactions the indexer stores to WatchTransactions calls
+func (s *Server) WithEvents(events interfaces.EventSource) *Server {
+	s.events = events
+	return s
+}
+
+// Start serves the gRPC API on address until ctx is cancelled
+func (s *Server) Start(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		s.log.Error.Printf("gRPC server failed to start: %v", err)
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves the gRPC API on listener until ctx is cancelled. Call contexts derive from ctx, so
+// cancelling it also ends open watches and the RPC calls of in-flight requests.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(callCtx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			callCtx, cancel := withBase(ctx, callCtx)
+			defer cancel()
+			return handler(callCtx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			callCtx, cancel := withBase(ctx, stream.Context())
+			defer cancel()
+			return handler(srv, &contextStream{ServerStream: stream, ctx: callCtx})
+		}),
+	)
+	pb.RegisterParserServer(server, s)
+
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			s.log.Error.Printf("gRPC server failed to shut down in time, closing open calls")
+			server.Stop()
+		}
+	}()
+
+	if err := server.Serve(listener); err != nil {
+		s.log.Error.Printf("gRPC server failed: %v", err)
+		return err
+	}
+	s.log.Info.Println("gRPC server stopped")
+	return nil
+}
+
+// withBase returns a copy of a call's context that is also cancelled when base is
+func withBase(base, ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-base.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// contextStream is a server stream with a replaced context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *Server) GetCurrentBlock(ctx context.Context, req *pb.GetCurrentBlockRequest) (*pb.GetCurrentBlockResponse, error) {
+	block := s.parser.GetCurrentBlock(ctx)
+	s.log.Debug.Printf("Fetching current block: %d", block)
+	return &pb.GetCurrentBlockResponse{BlockNumber: int64(block)}, nil
+}
+
+func (s *Server) Subscribe(ctx context.Context, req *pb.SubscribeRequest) (*pb.SubscribeResponse, error) {
+	address := utils.NormalizeAddress(req.Address)
+	if address == "" {
+		return nil, status.Error(codes.InvalidArgument, "address is required")
+	}
+	if !s.parser.Subscribe(address) {
+		return nil, status.Errorf(codes.AlreadyExists, "address %s is already subscribed", address)
+	}
+	s.log.Info.Printf("Successfully subscribed to address: %s", address)
+	return &pb.SubscribeResponse{Address: address}, nil
+}
+
+func (s *Server) Unsubscribe(ctx context.Context, req *pb.UnsubscribeRequest) (*pb.UnsubscribeResponse, error) {
+	address := utils.NormalizeAddress(req.Address)
+	if address == "" {
+		return nil, status.Error(codes.InvalidArgument, "address is required")
+	}
+	if !s.parser.Unsubscribe(address) {
+		return nil, status.Errorf(codes.NotFound, "address %s is not subscribed", address)
+	}
+	s.log.Info.Printf("Successfully unsubscribed from address: %s", address)
+	return &pb.UnsubscribeResponse{Address: address}, nil
+}
+
+// ListTransactions returns a page of an address's transactions in block order, with transactions
+// that are not mined last. The page token is the position of the page's last transaction, so pages
+// neither skip nor repeat transactions when others are stored or rolled back in between; only
+// transactions stored before the position after paging started are left out.
+func (s *Server) ListTransactions(ctx context.Context, req *pb.ListTransactionsRequest) (*pb.ListTransactionsResponse, error) {
+	address := utils.NormalizeAddress(req.Address)
+	if address == "" {
+		return nil, status.Error(codes.InvalidArgument, "address is required")
+	}
+	if !validStatus(req.Status) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid status filter %q", req.Status)
+	}
+	if !validKind(req.Kind) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid kind filter %q", req.Kind)
+	}
+
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+	var after *cursor
+	if req.PageToken != "" {
+		position, ok := parseCursor(req.PageToken)
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = &position
+	}
+
+	if !s.storage.IsSubscribed(address) {
+		return nil, status.Errorf(codes.NotFound, "address %s is not subscribed", address)
+	}
+
+	var matching []interfaces.Transaction
+	for _, tx := range s.parser.GetTransactions(address) {
+		if (req.Status == "" || tx.Status == req.Status) && (req.Kind == "" || tx.Kind == req.Kind) &&
+			(after == nil || after.before(cursorOf(tx))) {
+			matching = append(matching, tx)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return cursorOf(matching[i]).before(cursorOf(matching[j]))
+	})
+
+	resp := &pb.ListTransactionsResponse{}
+	if len(matching) > pageSize {
+		matching = matching[:pageSize]
+		resp.NextPageToken = cursorOf(matching[pageSize-1]).token()
+	}
+	for _, tx := range matching {
+		resp.Transactions = append(resp.Transactions, toTransaction(tx))
+	}
+	return resp, nil
+}
+
+// WatchTransactions sends every record stored for the requested addresses until the client goes
+// away. A watch that falls so far behind that events are dropped ends with RESOURCE_EXHAUSTED, so
+// the client can catch up with ListTransactions before watching again.
+func (s *Server) WatchTransactions(req *pb.WatchTransactionsRequest, stream pb.Parser_WatchTransactionsServer) error {
+	if s.events == nil {
+		return status.Error(codes.Unimplemented, "streaming is not enabled")
+	}
+
+	watched := make(map[string]bool)
+	for _, address := range req.Addresses {
+		address = utils.NormalizeAddress(address)
+		if address == "" {
+			continue
+		}
+		if !s.storage.IsSubscribed(address) {
+			return status.Errorf(codes.NotFound, "address %s is not subscribed", address)
+		}
+		watched[address] = true
+	}
+	if len(watched) == 0 {
+		return status.Error(codes.InvalidArgument, "addresses are required")
+	}
+
+	events, cancel := s.events.SubscribeEvents(s.watchBuffer)
+	defer cancel()
+	// Tell the client the watch is established, so records stored from now on reach it
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	s.log.Debug.Printf("Watching %d addresses", len(watched))
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				s.log.Warn.Printf("Ending watch that fell behind the indexer")
+				return status.Error(codes.ResourceExhausted, "watch fell behind the indexer and events were dropped")
+			}
+			if event.Transaction == nil || !watched[event.Transaction.Address] {
+				continue
+			}
+			err := stream.Send(&pb.TransactionEvent{
+				Address:     event.Transaction.Address,
+				Transaction: toTransaction(event.Transaction.Transaction),
+				Backfill:    event.Transaction.Backfill,
+			})
+			if err != nil {
+				s.log.Debug.Printf("Watch closed: %v", err)
+				return err
+			}
+		}
+	}
+}
+
+// validStatus reports whether status is empty or a confirmation or mempool status
+func validStatus(status string) bool {
+	switch status {
+	case "", interfaces.StatusUnconfirmed, interfaces.StatusConfirmed, interfaces.StatusFinalized,
+		interfaces.StatusPending, interfaces.StatusReplaced, interfaces.StatusDropped:
+		return true
+	}
+	return false
+}
+
+// validKind reports whether kind is empty or a record kind
+func validKind(kind string) bool {
+	switch kind {
+	case "", interfaces.KindNative, interfaces.KindDeployment, interfaces.KindERC20, interfaces.KindERC721, interfaces.KindERC1155, interfaces.KindInternal, interfaces.KindWithdrawal:
+		return true
+	}
+	return false
+}
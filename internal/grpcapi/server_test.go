@@ -0,0 +1,253 @@
+package grpcapi
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+
+	"tx-parser/internal/events"
+	"tx-parser/internal/grpcapi/pb"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/storage"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// mockParser subscribes addresses in the shared storage and serves canned transactions
+type mockParser struct {
+	storage      interfaces.Storage
+	currentBlock int
+	transactions map[string][]interfaces.Transaction
+}
+
+func (m *mockParser) GetCurrentBlock(ctx context.Context) int {
+	return m.currentBlock
+}
+
+func (m *mockParser) Subscribe(address string) bool {
+	return m.storage.AddAddress(address)
+}
+
+func (m *mockParser) Unsubscribe(address string) bool {
+	return m.storage.RemoveAddress(address)
+}
+
+func (m *mockParser) GetTransactions(address string) []interfaces.Transaction {
+	return m.transactions[address]
+}
+
+func (m *mockParser) Backfill(address string, fromBlock int) (interfaces.BackfillJob, error) {
+	return interfaces.BackfillJob{}, nil
+}
+
+func (m *mockParser) GetBackfill(address string) (interfaces.BackfillJob, bool) {
+	return interfaces.BackfillJob{}, false
+}
+
+func (m *mockParser) BlockAtTimestamp(ctx context.Context, timestamp int64) (int, error) {
+	return 0, nil
+}
+
+// mockEventSource publishes the events of a bus
+type mockEventSource struct {
+	bus *events.Bus
+}
+
+func (m *mockEventSource) SubscribeEvents(buffer int) (<-chan interfaces.Event, func()) {
+	return m.bus.Subscribe(buffer)
+}
+
+// newClient serves server over an in-memory connection and returns a client calling it
+func newClient(t *testing.T, server *Server) pb.ParserClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(ctx, listener)
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal("Error connecting:", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+	})
+	return pb.NewParserClient(conn)
+}
+
+func newTestServer(parser *mockParser) *Server {
+	if parser.storage == nil {
+		parser.storage = storage.NewMemoryStorage()
+	}
+	return NewServer(parser, parser.storage, logger.GetLogger("debug"))
+}
+
+func TestGetCurrentBlock(t *testing.T) {
+	client := newClient(t, newTestServer(&mockParser{currentBlock: 12345}))
+
+	resp, err := client.GetCurrentBlock(context.Background(), &pb.GetCurrentBlockRequest{})
+	assert.NoError(t, err, "GetCurrentBlock should succeed")
+	assert.Equal(t, int64(12345), resp.BlockNumber, "Block number should match the parser's")
+}
+
+func TestSubscribe(t *testing.T) {
+	parser := &mockParser{}
+	client := newClient(t, newTestServer(parser))
+	ctx := context.Background()
+
+	resp, err := client.Subscribe(ctx, &pb.SubscribeRequest{Address: " 0xTestAddress"})
+	assert.NoError(t, err, "Subscribe should succeed")
+	assert.Equal(t, "0xtestaddress", resp.Address, "Response should carry the normalized address")
+	assert.True(t, parser.storage.IsSubscribed("0xtestaddress"), "Address should be subscribed in the shared storage")
+
+	_, err = client.Subscribe(ctx, &pb.SubscribeRequest{Address: "0xtestaddress"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err), "Subscribing twice should fail")
+	_, err = client.Subscribe(ctx, &pb.SubscribeRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Subscribing without an address should fail")
+
+	_, err = client.Unsubscribe(ctx, &pb.UnsubscribeRequest{Address: "0xTestAddress"})
+	assert.NoError(t, err, "Unsubscribe should succeed")
+	assert.False(t, parser.storage.IsSubscribed("0xtestaddress"), "Address should no longer be subscribed")
+	_, err = client.Unsubscribe(ctx, &pb.UnsubscribeRequest{Address: "0xtestaddress"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "Unsubscribing an address that is not subscribed should fail")
+}
+
+func TestListTransactions(t *testing.T) {
+	decimals := 6
+	parser := &mockParser{transactions: map[string][]interfaces.Transaction{
+		"0xtestaddress": {
+			{Kind: interfaces.KindNative, Hash: "0x1", BlockNumber: 5, Value: big.NewInt(1e18), Status: interfaces.StatusFinalized},
+			{Kind: interfaces.KindERC20, Hash: "0x1", BlockNumber: 5, Value: big.NewInt(0), Status: interfaces.StatusFinalized,
+				Token: &interfaces.TokenTransfer{Contract: "0xtoken", Decimals: &decimals, Amount: big.NewInt(1500000), LogIndex: 3}},
+			{Kind: interfaces.KindNative, Hash: "0x2", BlockNumber: 6, Value: big.NewInt(2), Status: interfaces.StatusConfirmed},
+			{Kind: interfaces.KindNative, Hash: "0x3", BlockNumber: 7, TransactionIndex: 1, Value: big.NewInt(3), Status: interfaces.StatusUnconfirmed},
+			{Kind: interfaces.KindWithdrawal, BlockNumber: 7, Value: big.NewInt(4), Status: interfaces.StatusUnconfirmed,
+				Withdrawal: &interfaces.Withdrawal{Index: 7, ValidatorIndex: 8}},
+		},
+	}}
+	server := newTestServer(parser)
+	parser.storage.AddAddress("0xtestaddress")
+	client := newClient(t, server)
+	ctx := context.Background()
+
+	// Pages follow each other until the last one, which has no next token
+	var hashes []string
+	req := &pb.ListTransactionsRequest{Address: "0xTestAddress", PageSize: 2}
+	for {
+		resp, err := client.ListTransactions(ctx, req)
+		assert.NoError(t, err, "ListTransactions should succeed")
+		assert.LessOrEqual(t, len(resp.Transactions), 2, "Page should not exceed the page size")
+		for _, tx := range resp.Transactions {
+			hashes = append(hashes, tx.Hash)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	assert.Equal(t, []string{"0x1", "0x1", "0x2", "", "0x3"}, hashes, "Every transaction should be listed once, in block order")
+
+	// Records stored in earlier blocks between pages do not shift the next page
+	resp, err := client.ListTransactions(ctx, &pb.ListTransactionsRequest{Address: "0xtestaddress", PageSize: 2})
+	assert.NoError(t, err, "ListTransactions should succeed")
+	stored := parser.transactions["0xtestaddress"]
+	parser.transactions["0xtestaddress"] = append([]interfaces.Transaction{{Kind: interfaces.KindNative, Hash: "0x0", BlockNumber: 4}}, stored...)
+	resp, err = client.ListTransactions(ctx, &pb.ListTransactionsRequest{Address: "0xtestaddress", PageSize: 2, PageToken: resp.NextPageToken})
+	assert.NoError(t, err, "ListTransactions should succeed")
+	assert.Equal(t, "0x2", resp.Transactions[0].Hash, "Next page should continue after the last listed transaction")
+	parser.transactions["0xtestaddress"] = stored
+
+	// Records are converted with their amounts rendered
+	resp, err = client.ListTransactions(ctx, &pb.ListTransactionsRequest{Address: "0xtestaddress"})
+	assert.NoError(t, err, "ListTransactions should succeed")
+	assert.Len(t, resp.Transactions, 5, "A single page should hold every transaction by default")
+	assert.Equal(t, "1000000000000000000", resp.Transactions[0].Value, "Value should be in wei")
+	assert.Equal(t, "1", resp.Transactions[0].ValueEther, "Value should be rendered in ether")
+	token := resp.Transactions[1].Token
+	assert.Equal(t, int32(6), token.GetDecimals(), "Token decimals should be set")
+	assert.Equal(t, "1.5", token.AmountDecimal, "Token amount should be rendered with its decimals")
+	assert.Equal(t, int32(3), token.LogIndex, "Token log index should match")
+	assert.Equal(t, uint64(8), resp.Transactions[3].Withdrawal.ValidatorIndex, "Withdrawal should be converted")
+
+	// Filters apply before paging
+	resp, err = client.ListTransactions(ctx, &pb.ListTransactionsRequest{Address: "0xtestaddress", Status: interfaces.StatusUnconfirmed, Kind: interfaces.KindNative})
+	assert.NoError(t, err, "ListTransactions should succeed")
+	assert.Len(t, resp.Transactions, 1, "Only transactions matching both filters should be listed")
+	assert.Equal(t, "0x3", resp.Transactions[0].Hash, "Filtered transaction should match")
+
+	_, err = client.ListTransactions(ctx, &pb.ListTransactionsRequest{Address: "0xtestaddress", PageToken: "abc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Invalid page token should be rejected")
+	_, err = client.ListTransactions(ctx, &pb.ListTransactionsRequest{Address: "0xtestaddress", Status: "mined"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "Invalid status filter should be rejected")
+	_, err = client.ListTransactions(ctx, &pb.ListTransactionsRequest{Address: "0xother"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "Address that is not subscribed should not be found")
+}
+
+func TestWatchTransactions(t *testing.T) {
+	bus := events.NewBus()
+	parser := &mockParser{}
+	server := newTestServer(parser).WithEvents(&mockEventSource{bus: bus})
+	parser.storage.AddAddress("0xalice")
+	parser.storage.AddAddress("0xbob")
+	client := newClient(t, server)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.WatchTransactions(ctx, &pb.WatchTransactionsRequest{Addresses: []string{"0xcarol"}})
+	assert.NoError(t, err, "WatchTransactions should start")
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err), "Address that is not subscribed should not be watched")
+
+	stream, err = client.WatchTransactions(ctx, &pb.WatchTransactionsRequest{Addresses: []string{"0xAlice"}})
+	assert.NoError(t, err, "WatchTransactions should start")
+	// The header is sent once the watch is subscribed to the indexer's events
+	_, err = stream.Header()
+	assert.NoError(t, err, "Watch should send its header")
+
+	bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xbob", Transaction: interfaces.Transaction{Hash: "0x1"}}})
+	bus.Publish(interfaces.Event{Type: interfaces.EventReorg, Reorg: &interfaces.ReorgEvent{Addresses: []string{"0xalice"}}})
+	bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xalice", Transaction: interfaces.Transaction{Hash: "0x2", Value: big.NewInt(1e18)}}})
+
+	event, err := stream.Recv()
+	assert.NoError(t, err, "Watch should receive the transaction")
+	assert.Equal(t, "0xalice", event.Address, "Only transactions of watched addresses should be sent")
+	assert.Equal(t, "0x2", event.Transaction.Hash, "Event should carry the record")
+	assert.Equal(t, "1", event.Transaction.ValueEther, "Event should render the value in ether")
+}
+
+// Test that a watch that cannot keep up ends with an error instead of silently skipping records
+func TestWatchTransactions_FallsBehind(t *testing.T) {
+	bus := events.NewBus()
+	parser := &mockParser{}
+	server := newTestServer(parser).WithEvents(&mockEventSource{bus: bus})
+	server.watchBuffer = 1
+	parser.storage.AddAddress("0xalice")
+	client := newClient(t, server)
+
+	stream, err := client.WatchTransactions(context.Background(), &pb.WatchTransactionsRequest{Addresses: []string{"0xalice"}})
+	assert.NoError(t, err, "WatchTransactions should start")
+	_, err = stream.Header()
+	assert.NoError(t, err, "Watch should send its header")
+
+	// Large records fill the flow control window while the client does not read
+	input := "0x" + strings.Repeat("ab", 64*1024)
+	for i := 0; i < 1000; i++ {
+		bus.Publish(interfaces.Event{Type: interfaces.EventTransaction, Transaction: &interfaces.TransactionEvent{Address: "0xalice", Transaction: interfaces.Transaction{Hash: "0x1", Input: input}}})
+	}
+
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "Watch should end once events are dropped")
+}
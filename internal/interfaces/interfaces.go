@@ -1,22 +1,286 @@
 // internal/interfaces/interfaces.go
 package interfaces
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Errors returned by Parser.Backfill and Parser.BlockAtTimestamp that callers tell apart
+var (
+	ErrBackfillInProgress = errors.New("a backfill is already in progress")
+	ErrChainHeadUnknown   = errors.New("chain head is not known yet")
+	ErrTimestampAfterHead = errors.New("timestamp is after the chain head")
+)
+
 type Parser interface {
-	GetCurrentBlock() int
+	GetCurrentBlock(ctx context.Context) int
 	Subscribe(address string) bool
+	Unsubscribe(address string) bool
 	GetTransactions(address string) []Transaction
+	Backfill(address string, fromBlock int) (BackfillJob, error)
+	GetBackfill(address string) (BackfillJob, bool)
+	BlockAtTimestamp(ctx context.Context, timestamp int64) (int, error)
+}
+
+type Indexer interface {
+	Run(ctx context.Context, interval time.Duration)
+	EventSource
+}
+
+// EventSource publishes the indexer's events to any number of subscribers
+type EventSource interface {
+	SubscribeEvents(buffer int) (<-chan Event, func())
 }
 
 type Storage interface {
 	AddAddress(address string) bool
+	RemoveAddress(address string) bool
+	IsSubscribed(address string) bool
 	GetTransactions(address string) []Transaction
 	AddTransaction(address string, tx Transaction)
+	RemoveTransaction(address string, txHash string) bool
+	RemoveTransactionsFrom(blockNumber int) []string
+	SaveCheckpoint(checkpoint Checkpoint)
+	GetCheckpoint() (Checkpoint, bool)
+	SaveBackfill(job BackfillJob)
+	GetBackfill(address string) (BackfillJob, bool)
+	GetBackfills() []BackfillJob
+	SaveWebhook(webhook Webhook)
+	GetWebhook(address string) (Webhook, bool)
+	SaveDelivery(delivery WebhookDelivery)
+	RemoveDelivery(id string)
+	GetDeliveries() []WebhookDelivery
+}
+
+// Notifier is told about every record the indexer stores for a subscribed address. It is called
+// synchronously, so it must not block for long.
+type Notifier interface {
+	Notify(event Event)
+}
+
+// Webhooks manages the webhook notifications of subscribed addresses
+type Webhooks interface {
+	Register(address, url, secret string) Webhook
+	DeadLetters(address string) []WebhookDelivery
+	Replay(address, id string) int
+}
+
+// RPCPool reports the health of the RPC endpoints the indexer reads from
+type RPCPool interface {
+	Status() []EndpointStatus
 }
 
+// Checkpoint is the last block fully processed by the indexer
+type Checkpoint struct {
+	BlockNumber int                `json:"block_number"`
+	BlockHash   string             `json:"block_hash"`
+	Records     []CheckpointRecord `json:"records,omitempty"` // Records stored from the block, removed if a reorg orphans it
+}
+
+// CheckpointRecord identifies a record stored from the checkpoint block
+type CheckpointRecord struct {
+	Address string `json:"address"`
+	Hash    string `json:"hash"` // Record id for records without a transaction hash
+}
+
+// Backfill job statuses
+const (
+	BackfillQueued    = "queued"
+	BackfillRunning   = "running"
+	BackfillCompleted = "completed"
+)
+
+// BackfillJob scans a historical block range for a single address
+type BackfillJob struct {
+	Address   string `json:"address"`
+	FromBlock int    `json:"from_block"`
+	ToBlock   int    `json:"to_block"`
+	NextBlock int    `json:"next_block"`
+	Status    string `json:"status"`
+}
+
+// Webhook is the URL notified of every record stored for a subscribed address
+type Webhook struct {
+	Address string `json:"address"`
+	URL     string `json:"url"`
+	Secret  string `json:"secret"` // Key of the HMAC-SHA256 signature sent with each delivery
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryQueued = "queued"
+	DeliveryDead   = "dead" // Attempts ran out, kept as a dead letter until replayed
+)
+
+// WebhookDelivery is a notification queued for a webhook, or a dead letter once every attempt failed
+type WebhookDelivery struct {
+	ID          string          `json:"id"`
+	Address     string          `json:"address"`
+	Payload     json.RawMessage `json:"payload"` // Sent as is, so retries are signed over the same body
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Transaction statuses based on the number of blocks built on top of the transaction's block
+const (
+	StatusUnconfirmed = "unconfirmed"
+	StatusConfirmed   = "confirmed"
+	StatusFinalized   = "finalized"
+)
+
+// Statuses of transactions seen in the mempool that are not mined
+const (
+	StatusPending  = "pending"
+	StatusReplaced = "replaced" // Another transaction with the same sender and nonce was mined or broadcast
+	StatusDropped  = "dropped"  // The node no longer knows the transaction
+)
+
+// Receipt statuses reporting whether a transaction's execution succeeded or was reverted
+const (
+	ReceiptSuccess = "success"
+	ReceiptFailed  = "failed"
+)
+
+// Record kinds: the native ether transfer of a transaction or a token transfer it emitted
+const (
+	KindNative     = "native"
+	KindDeployment = "deployment" // Transaction without a recipient, creating the contract in ContractAddress
+	KindERC20      = "erc20"
+	KindERC721     = "erc721"
+	KindERC1155    = "erc1155"
+	KindInternal   = "internal"   // Ether moved by a contract call within a transaction
+	KindWithdrawal = "withdrawal" // Beacon chain withdrawal paid to an address, not a transaction
+)
+
+// Transaction is a transaction stored for a subscribed address. Amounts are in wei.
 type Transaction struct {
-	Hash     string `json:"hash"`
-	From     string `json:"from"`
-	To       string `json:"to"`
-	Value    string `json:"value"`
-	Incoming bool   `json:"incoming"`
+	Kind                 string         `json:"kind"`
+	Hash                 string         `json:"hash"`
+	From                 string         `json:"from"`
+	To                   string         `json:"to"`
+	Value                *big.Int       `json:"value"`
+	ValueEther           string         `json:"value_ether,omitempty"` // Rendered for API output, never stored
+	Incoming             bool           `json:"incoming"`
+	Outgoing             bool           `json:"outgoing"` // Both directions are set for self-transfers
+	BlockNumber          int            `json:"block_number"`
+	BlockHash            string         `json:"block_hash,omitempty"`
+	TransactionIndex     int            `json:"transaction_index"`
+	Timestamp            int64          `json:"timestamp,omitempty"` // Unix seconds of the including block
+	Nonce                uint64         `json:"nonce"`
+	Gas                  uint64         `json:"gas"`
+	GasPrice             *big.Int       `json:"gas_price,omitempty"`
+	MaxFeePerGas         *big.Int       `json:"max_fee_per_gas,omitempty"`          // Type 2 transactions only
+	MaxPriorityFeePerGas *big.Int       `json:"max_priority_fee_per_gas,omitempty"` // Type 2 transactions only
+	Type                 int            `json:"type"`
+	ChainID              *big.Int       `json:"chain_id,omitempty"` // Absent for legacy transactions without replay protection
+	Input                string         `json:"input,omitempty"`
+	Status               string         `json:"status,omitempty"`      // Only stored for transactions that are not mined
+	ReplacedBy           string         `json:"replaced_by,omitempty"` // Hash of the transaction that replaced a pending one
+	ReceiptStatus        string         `json:"receipt_status,omitempty"`
+	GasUsed              uint64         `json:"gas_used"`
+	EffectiveGasPrice    *big.Int       `json:"effective_gas_price,omitempty"`
+	Fee                  *big.Int       `json:"fee,omitempty"`              // Gas used times effective gas price
+	FeeEther             string         `json:"fee_ether,omitempty"`        // Rendered for API output, never stored
+	ContractAddress      string         `json:"contract_address,omitempty"` // Set when the transaction deployed a contract
+	Token                *TokenTransfer `json:"token,omitempty"`            // Set for token transfers
+	TracePath            []int          `json:"trace_path,omitempty"`       // Position of an internal transfer in the call tree
+	CallType             string         `json:"call_type,omitempty"`        // call, create or selfdestruct for internal transfers
+	Withdrawal           *Withdrawal    `json:"withdrawal,omitempty"`       // Set for withdrawals
+}
+
+// RecordID identifies a record among those stored for an address. The native record of a
+// transaction shares its hash with the token and internal transfers the transaction made.
+func (tx Transaction) RecordID() string {
+	switch {
+	case tx.Token != nil:
+		return fmt.Sprintf("%s:log:%d", tx.Hash, tx.Token.LogIndex)
+	case tx.Kind == KindInternal:
+		return fmt.Sprintf("%s:trace:%v", tx.Hash, tx.TracePath)
+	case tx.Withdrawal != nil:
+		// Withdrawals have no transaction hash, but their index is unique across the chain
+		return fmt.Sprintf("withdrawal:%d", tx.Withdrawal.Index)
+	default:
+		return tx.Hash
+	}
+}
+
+// TokenTransfer is the token moved by a token transfer record. Amounts are in the token's base
+// units. Fungible transfers carry an amount, NFT transfers the ids and quantities of the tokens
+// moved from the collection.
+type TokenTransfer struct {
+	Contract      string     `json:"contract"` // Token or NFT collection
+	Symbol        string     `json:"symbol,omitempty"`
+	Decimals      *int       `json:"decimals,omitempty"` // Nil when the token does not report its decimals
+	Amount        *big.Int   `json:"amount,omitempty"`
+	AmountDecimal string     `json:"amount_decimal,omitempty"` // Rendered for API output, never stored
+	TokenIDs      []*big.Int `json:"token_ids,omitempty"`
+	Quantities    []*big.Int `json:"quantities,omitempty"` // Quantity of each token id, always 1 for ERC-721
+	Operator      string     `json:"operator,omitempty"`   // Account that moved ERC-1155 tokens
+	LogIndex      int        `json:"log_index"`
+}
+
+// Withdrawal identifies a beacon chain withdrawal. Its amount, converted from gwei, is the record's value.
+type Withdrawal struct {
+	Index          uint64 `json:"index"`
+	ValidatorIndex uint64 `json:"validator_index"`
+}
+
+const (
+	EventReorg        = "reorg"
+	EventTransaction  = "transaction"
+	EventConfirmation = "confirmation"
+)
+
+// Event is published by the indexer so downstream consumers can react to chain changes
+type Event struct {
+	Type         string             `json:"type"`
+	Reorg        *ReorgEvent        `json:"reorg,omitempty"`
+	Transaction  *TransactionEvent  `json:"transaction,omitempty"`
+	Confirmation *ConfirmationEvent `json:"confirmation,omitempty"`
+}
+
+// TransactionEvent reports a record stored for a subscribed address, such as a transaction seen
+// in the mempool, the same transaction once mined, or its replacement
+type TransactionEvent struct {
+	Address     string      `json:"address"`
+	Transaction Transaction `json:"transaction"`
+	Backfill    bool        `json:"backfill,omitempty"` // Whether a backfill found the record rather than the live indexer
+}
+
+// ConfirmationEvent reports that the transactions stored for an address in a block reached a new
+// confirmation status
+type ConfirmationEvent struct {
+	Address     string   `json:"address"`
+	BlockNumber int      `json:"block_number"`
+	BlockHash   string   `json:"block_hash"`
+	Status      string   `json:"status"`
+	Hashes      []string `json:"hashes"` // Transaction hashes, or record ids of records without one
+}
+
+// ReorgEvent describes blocks that were rolled back after a chain reorganization
+type ReorgEvent struct {
+	Depth     int      `json:"depth"`
+	FromBlock int      `json:"from_block"`
+	ToBlock   int      `json:"to_block"`
+	Addresses []string `json:"addresses"`
+}
+
+// EndpointStatus is the last observed health of a single RPC endpoint
+type EndpointStatus struct {
+	URL         string    `json:"url"` // Redacted, as provider URLs often carry API keys
+	Healthy     bool      `json:"healthy"`
+	Lagging     bool      `json:"lagging"`
+	Head        int       `json:"head"`
+	HeadLag     int       `json:"head_lag"`
+	LatencyMs   float64   `json:"latency_ms"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastChecked time.Time `json:"last_checked"`
 }
@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+	"tx-parser/utils"
+)
+
+// Backfill queues a job that scans blocks from fromBlock up to the block before the live indexer's
+// position for transactions of a single subscribed address
+func (p *EthParser) Backfill(address string, fromBlock int) (interfaces.BackfillJob, error) {
+	address = utils.NormalizeAddress(address)
+
+	if !p.storage.IsSubscribed(address) {
+		return interfaces.BackfillJob{}, fmt.Errorf("address %s is not subscribed", address)
+	}
+	if fromBlock < 0 {
+		return interfaces.BackfillJob{}, fmt.Errorf("invalid start block %d", fromBlock)
+	}
+	job, err := p.queueBackfill(address, fromBlock)
+	if err != nil {
+		return interfaces.BackfillJob{}, err
+	}
+
+	p.log.Info.Printf("Backfill for address %s queued for blocks %d-%d", address, job.FromBlock, job.ToBlock)
+	if job.Status == interfaces.BackfillQueued {
+		p.startBackfill(job)
+	}
+	return job, nil
+}
+
+// queueBackfill saves a new job for address unless one is still unfinished. The check and the save
+// happen under the parser's lock, so concurrent requests cannot both queue a job.
+func (p *EthParser) queueBackfill(address string, fromBlock int) (interfaces.BackfillJob, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if existing, ok := p.storage.GetBackfill(address); ok && existing.Status != interfaces.BackfillCompleted {
+		return interfaces.BackfillJob{}, fmt.Errorf("%w for address %s", interfaces.ErrBackfillInProgress, address)
+	}
+
+	// Everything from the live indexer's position onwards is covered by live indexing
+	if p.nextBlock == unknownBlock {
+		return interfaces.BackfillJob{}, interfaces.ErrChainHeadUnknown
+	}
+
+	job := interfaces.BackfillJob{
+		Address:   address,
+		FromBlock: fromBlock,
+		ToBlock:   p.nextBlock - 1,
+		NextBlock: fromBlock,
+		Status:    interfaces.BackfillQueued,
+	}
+	if job.FromBlock > job.ToBlock {
+		job.Status = interfaces.BackfillCompleted
+	}
+	p.storage.SaveBackfill(job)
+	return job, nil
+}
+
+// GetBackfill returns the backfill job of an address
+func (p *EthParser) GetBackfill(address string) (interfaces.BackfillJob, bool) {
+	return p.storage.GetBackfill(utils.NormalizeAddress(address))
+}
+
+// BlockAtTimestamp finds the first block mined at or after the given Unix timestamp
+func (p *EthParser) BlockAtTimestamp(ctx context.Context, timestamp int64) (int, error) {
+	head, err := p.rpcClient.FetchCurrentBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	headTime, err := p.blockTimestamp(ctx, head)
+	if err != nil {
+		return 0, err
+	}
+	if timestamp > headTime {
+		return 0, fmt.Errorf("%w: %d", interfaces.ErrTimestampAfterHead, timestamp)
+	}
+
+	// Binary search for the first block whose timestamp is not before the requested one
+	low, high := 0, head
+	for low < high {
+		mid := low + (high-low)/2
+		midTime, err := p.blockTimestamp(ctx, mid)
+		if err != nil {
+			return 0, err
+		}
+		if midTime < timestamp {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
+
+// blockTimestamp returns the timestamp of a block, only fetching its header when the client can
+func (p *EthParser) blockTimestamp(ctx context.Context, number int) (int64, error) {
+	headers, ok := p.rpcClient.(rpc.HeaderClient)
+	if !ok {
+		block, err := p.fetchBlock(ctx, number)
+		if err != nil {
+			return 0, err
+		}
+		return rpc.ParseBlockTimestamp(block)
+	}
+
+	header, err := headers.FetchHeaderByNumber(ctx, number)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, errBlockNotAvailable(number)
+	}
+	return rpc.ParseBlockTimestamp(header)
+}
+
+// resumeBackfills makes jobs available to run under ctx and restarts the unfinished ones
+func (p *EthParser) resumeBackfills(ctx context.Context) {
+	p.mu.Lock()
+	p.runCtx = ctx
+	p.mu.Unlock()
+
+	for _, job := range p.storage.GetBackfills() {
+		if job.Status != interfaces.BackfillCompleted {
+			p.log.Info.Printf("Resuming backfill for address %s at block %d", job.Address, job.NextBlock)
+			p.startBackfill(job)
+		}
+	}
+}
+
+// startBackfill runs a job in the background once a backfill slot is free.
+// Jobs queued before the indexer runs are started by resumeBackfills.
+func (p *EthParser) startBackfill(job interfaces.BackfillJob) {
+	p.mu.Lock()
+	ctx := p.runCtx
+	p.mu.Unlock()
+	if ctx == nil {
+		return
+	}
+
+	go func() {
+		select {
+		case p.backfillSlots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-p.backfillSlots }()
+
+		p.runBackfill(ctx, job)
+	}()
+}
+
+// runBackfill scans the job's remaining blocks, saving progress after each one so it can resume
+func (p *EthParser) runBackfill(ctx context.Context, job interfaces.BackfillJob) {
+	job.Status = interfaces.BackfillRunning
+	p.storage.SaveBackfill(job)
+
+	for job.NextBlock <= job.ToBlock {
+		if ctx.Err() != nil {
+			p.log.Info.Printf("Backfill for address %s paused at block %d", job.Address, job.NextBlock)
+			return
+		}
+
+		if err := p.backfillRange(ctx, &job); err != nil {
+			// Retry from the failed block so the backfill never skips one
+			p.log.Error.Printf("Error indexing block %d for backfill of %s: %v", job.NextBlock, job.Address, err)
+			select {
+			case <-time.After(p.backfillRetryDelay):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	job.Status = interfaces.BackfillCompleted
+	p.storage.SaveBackfill(job)
+	p.log.Info.Printf("Backfill for address %s completed for blocks %d-%d", job.Address, job.FromBlock, job.ToBlock)
+}
+
+// backfillRange scans the job's remaining blocks through the fetch pipeline, advancing its progress
+func (p *EthParser) backfillRange(ctx context.Context, job *interfaces.BackfillJob) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for result := range p.fetchRange(ctx, job.NextBlock, job.ToBlock) {
+		if result.err != nil {
+			return result.err
+		}
+		if err := p.backfillBlock(ctx, job.Address, result); err != nil {
+			return err
+		}
+		job.NextBlock++
+		p.storage.SaveBackfill(*job)
+	}
+	return nil
+}
+
+// backfillBlock stores the block's transactions, token transfers and internal transfers involving
+// address, storing nothing when the receipts of the transactions cannot be fetched. Records of a
+// block the live indexer tracks for reorgs are registered with it, so a reorg removes them too.
+func (p *EthParser) backfillBlock(ctx context.Context, address string, result fetchResult) error {
+	number, block := result.number, result.block
+	var txs []*interfaces.Transaction
+	for _, raw := range block.Transactions {
+		if utils.NormalizeAddress(raw.From) != address && utils.NormalizeAddress(raw.To) != address {
+			continue
+		}
+
+		tx, err := newTransaction(raw, block, number)
+		if err != nil {
+			p.log.Error.Printf("Skipping transaction in block %d: %v", number, err)
+			continue
+		}
+		tx = forAddress(tx, address)
+		txs = append(txs, &tx)
+	}
+
+	if err := p.addReceipts(ctx, number, block, txs); err != nil {
+		return err
+	}
+	var records []interfaces.Transaction
+	for _, tx := range txs {
+		records = append(records, *tx)
+	}
+
+	for _, tx := range p.transfers(result) {
+		if tx.From != address && tx.To != address {
+			continue
+		}
+		if tx.Token != nil {
+			p.addTokenMetadata(ctx, &tx)
+		}
+		records = append(records, tx)
+	}
+
+	// Hold recentMu while storing, so a rollback either sees the registered records or already
+	// dropped the block
+	p.recentMu.Lock()
+	defer p.recentMu.Unlock()
+	indexed := p.indexedAt(number)
+	switch {
+	case indexed != nil && indexed.hash != block.Hash:
+		// Retried once the live indexer has handled the reorg
+		return fmt.Errorf("block %d does not match the indexed block %s", number, indexed.hash)
+	case indexed == nil && number >= p.getNextBlock():
+		// A reorg rolled the live indexer back past this block, which it stores again once re-indexed
+		return nil
+	}
+
+	for _, tx := range records {
+		p.storeBackfilled(address, tx)
+		if indexed != nil {
+			indexed.txns = append(indexed.txns, storedTx{address: address, hash: removalKey(tx)})
+		}
+	}
+	// The checkpoint carries the records of its block, which now include these
+	if indexed != nil && indexed == p.lastIndexed() && len(records) > 0 {
+		p.storage.SaveCheckpoint(checkpointOf(*indexed))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+	"tx-parser/internal/storage"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newBackfillChain returns a chain of 5 blocks with transactions for 0xtestaddress in blocks 1, 2 and 5
+func newBackfillChain() *mockChain {
+	chain := newMockChain()
+	chain.addBlock(1, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"})
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x3", From: "0xfrom2", To: "0xanotheraddress", Value: "0x12c"})
+	chain.addBlock(4, "a")
+	chain.addBlock(5, "a", rpc.Transaction{Hash: "0x5", From: "0xfrom3", To: "0xtestaddress", Value: "0x1f4"})
+	return chain
+}
+
+// Test that a backfill scans history up to the live indexer's position
+func TestBackfill(t *testing.T) {
+	log := logger.GetLogger("debug")
+	mockStorage := storage.NewMemoryStorage()
+	parser := NewEthParser(newBackfillChain(), mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 4})
+
+	// Only subscribed addresses can be backfilled
+	_, err := parser.Backfill("0xtestaddress", 1)
+	assert.NotNil(t, err, "Expected an error for an unsubscribed address")
+
+	parser.Subscribe("0xTestAddress")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	parser.resumeBackfills(ctx)
+
+	job, err := parser.Backfill("0xTestAddress", 1)
+	assert.Nil(t, err, "Expected no error when starting a backfill")
+	assert.Equal(t, 1, job.FromBlock, "Backfill should start at the requested block")
+	assert.Equal(t, 3, job.ToBlock, "Backfill should stop before the live indexer's position")
+
+	assert.Eventually(t, func() bool {
+		job, _ := parser.GetBackfill("0xtestaddress")
+		return job.Status == interfaces.BackfillCompleted
+	}, time.Second, 10*time.Millisecond, "Backfill should complete")
+
+	job, _ = parser.GetBackfill("0xtestaddress")
+	assert.Equal(t, 4, job.NextBlock, "Backfill should have processed every block in its range")
+
+	// The live indexer covers the rest, and results are ordered by block
+	parser.poll(context.Background())
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 3, "Should return backfilled and live transactions")
+	assert.Equal(t, "0x1", transactions[0].Hash, "First transaction should come from the backfill")
+	assert.False(t, transactions[1].Incoming, "Second transaction should be outgoing")
+	assert.Equal(t, "0x5", transactions[2].Hash, "Last transaction should come from live indexing")
+}
+
+// Test that backfills queued before the indexer runs are resumed from their saved progress
+func TestBackfill_Resume(t *testing.T) {
+	log := logger.GetLogger("debug")
+	mockStorage := storage.NewMemoryStorage()
+	mockStorage.AddAddress("0xtestaddress")
+
+	// A job interrupted after processing block 1
+	mockStorage.SaveBackfill(interfaces.BackfillJob{Address: "0xtestaddress", FromBlock: 1, ToBlock: 3, NextBlock: 2, Status: interfaces.BackfillRunning})
+
+	parser := NewEthParser(newBackfillChain(), mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 4})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	parser.resumeBackfills(ctx)
+
+	assert.Eventually(t, func() bool {
+		job, _ := parser.GetBackfill("0xtestaddress")
+		return job.Status == interfaces.BackfillCompleted
+	}, time.Second, 10*time.Millisecond, "Backfill should complete")
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "Only blocks after the saved progress should be scanned")
+	assert.Equal(t, "0x2", transactions[0].Hash, "Transaction hash should match")
+
+	// A new backfill is rejected while one is in progress, but allowed once it completes
+	_, err := parser.Backfill("0xtestaddress", 1)
+	assert.Nil(t, err, "Expected no error once the previous backfill completed")
+}
+
+// Test that concurrent requests cannot queue two backfills for the same address
+func TestBackfill_Concurrent(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(newBackfillChain(), storage.NewMemoryStorage(), log, config.ParserConfig{Start: config.StartBlock, StartBlock: 4})
+	parser.Subscribe("0xtestaddress")
+
+	// Jobs stay queued since the indexer is not running
+	var queued atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := parser.Backfill("0xtestaddress", 1); err == nil {
+				queued.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), queued.Load(), "Only one backfill should be queued")
+}
+
+// Test that records backfilled into blocks tracked for reorgs are rolled back with them
+func TestBackfill_Reorg(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"})
+	parser := NewEthParser(chain, storage.NewMemoryStorage(), log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+
+	// Blocks are indexed before the address is subscribed, so only the backfill stores its records
+	parser.poll(context.Background())
+	parser.Subscribe("0xtestaddress")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	parser.resumeBackfills(ctx)
+	_, err := parser.Backfill("0xtestaddress", 1)
+	assert.Nil(t, err, "Expected no error when starting a backfill")
+	assert.Eventually(t, func() bool {
+		job, _ := parser.GetBackfill("0xtestaddress")
+		return job.Status == interfaces.BackfillCompleted
+	}, time.Second, 10*time.Millisecond, "Backfill should complete")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 2, "Backfill should store both transactions")
+
+	// Replace block 3 with a competing branch that drops 0x2
+	chain.addBlock(3, "b")
+	chain.addBlock(4, "b")
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "Backfilled transaction of the orphaned block should be removed")
+	assert.Equal(t, "0x1", transactions[0].Hash, "Backfilled transaction of the canonical block should be kept")
+}
+
+// Test resolving a timestamp to the first block at or after it
+func TestBlockAtTimestamp(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(newBackfillChain(), storage.NewMemoryStorage(), log, config.ParserConfig{})
+
+	// Blocks are mined every 12 seconds in the mock chain
+	block, err := parser.BlockAtTimestamp(context.Background(), 24)
+	assert.Nil(t, err, "Expected no error for an exact block timestamp")
+	assert.Equal(t, 2, block, "Should return the block mined at the timestamp")
+
+	block, err = parser.BlockAtTimestamp(context.Background(), 25)
+	assert.Nil(t, err, "Expected no error for a timestamp between blocks")
+	assert.Equal(t, 3, block, "Should return the first block mined after the timestamp")
+
+	_, err = parser.BlockAtTimestamp(context.Background(), 1000)
+	assert.ErrorIs(t, err, interfaces.ErrTimestampAfterHead, "Expected an error for a timestamp after the head")
+	assert.NotZero(t, parser.rpcClient.(*mockChain).headers.Load(), "Should search block headers rather than full blocks")
+}
@@ -0,0 +1,81 @@
+package parser
+
+import "tx-parser/internal/interfaces"
+
+// settlingBlock is an indexed block with stored records whose confirmation status may still change
+type settlingBlock struct {
+	number int
+	hash   string
+	txns   []storedTx
+	status string // Confirmation status last announced for the block's records
+}
+
+// trackConfirmations starts following the confirmation status of an indexed block's records
+func (p *EthParser) trackConfirmations(block indexedBlock) {
+	if len(block.txns) == 0 {
+		return
+	}
+	p.mu.Lock()
+	status := p.status(block.number, p.currentBlock, p.finalizedBlock)
+	p.mu.Unlock()
+	p.settling = append(p.settling, settlingBlock{number: block.number, hash: block.hash, txns: block.txns, status: status})
+}
+
+// publishConfirmations publishes a confirmation event for the records of every block whose status
+// changed since it was last announced. Blocks are no longer followed once finalized, or once
+// confirmed when the node reports no finalized block.
+func (p *EthParser) publishConfirmations() {
+	p.mu.Lock()
+	head, finalized := p.currentBlock, p.finalizedBlock
+	p.mu.Unlock()
+
+	kept := p.settling[:0]
+	for _, block := range p.settling {
+		status := p.status(block.number, head, finalized)
+		if status != block.status {
+			block.status = status
+			for _, event := range confirmationEvents(block) {
+				p.events.Publish(interfaces.Event{Type: interfaces.EventConfirmation, Confirmation: event})
+			}
+		}
+		if status == interfaces.StatusFinalized || (status == interfaces.StatusConfirmed && finalized == 0) {
+			continue
+		}
+		kept = append(kept, block)
+	}
+	p.settling = kept
+}
+
+// forgetConfirmations stops following the blocks from number onwards, such as after a reorg
+func (p *EthParser) forgetConfirmations(number int) {
+	kept := p.settling[:0]
+	for _, block := range p.settling {
+		if block.number < number {
+			kept = append(kept, block)
+		}
+	}
+	p.settling = kept
+}
+
+// confirmationEvents groups the transactions of a block by address, each listed once
+func confirmationEvents(block settlingBlock) []*interfaces.ConfirmationEvent {
+	var events []*interfaces.ConfirmationEvent
+	byAddress := make(map[string]*interfaces.ConfirmationEvent)
+	seen := make(map[storedTx]bool)
+	for _, tx := range block.txns {
+		if seen[tx] {
+			// The transaction's native record and its transfers share a hash
+			continue
+		}
+		seen[tx] = true
+
+		event, ok := byAddress[tx.address]
+		if !ok {
+			event = &interfaces.ConfirmationEvent{Address: tx.address, BlockNumber: block.number, BlockHash: block.hash, Status: block.status}
+			byAddress[tx.address] = event
+			events = append(events, event)
+		}
+		event.Hashes = append(event.Hashes, tx.hash)
+	}
+	return events
+}
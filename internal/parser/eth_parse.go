@@ -1,25 +1,108 @@
 package parser
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/internal/events"
 	"tx-parser/internal/interfaces"
 	"tx-parser/internal/rpc"
 	"tx-parser/pkg/logger"
 	"tx-parser/utils"
 )
 
+const (
+	// DefaultPollInterval is used when no poll interval is configured
+	DefaultPollInterval = 12 * time.Second
+	// DefaultReorgDepth is used when no reorg depth is configured
+	DefaultReorgDepth = 64
+	// DefaultConfirmations is used when no confirmation depth is configured
+	DefaultConfirmations = 12
+
+	// DefaultFetchWorkers is used when no fetch worker count is configured
+	DefaultFetchWorkers = 4
+	// DefaultBatchSize is used when no batch size is configured
+	DefaultBatchSize = 10
+	// DefaultBackfillConcurrency is used when no backfill concurrency is configured
+	DefaultBackfillConcurrency = 2
+	// DefaultPendingTimeout is used when no pending timeout is configured
+	DefaultPendingTimeout = 15 * time.Minute
+
+	// headBuffer is the number of pushed heads queued while a previous one is being indexed
+	headBuffer = 16
+	// pendingBuffer is the number of pushed pending transactions queued while others are being
+	// handled. The subscriber drops the ones pushed while it is full.
+	pendingBuffer = 256
+	// pendingLookupBatch caps the number of announced hashes looked up with a single batch request
+	pendingLookupBatch = 100
+
+	// unknownBlock marks a start block that is resolved to the chain head on the first poll
+	unknownBlock = -1
+)
+
 type EthParser struct {
-	currentBlock int
-	rpcClient    rpc.Client
-	storage      interfaces.Storage
-	log          *logger.Logger
-	recordedTxns map[string]bool // Tracks recorded transactions (transaction hash as key)
-	mu           sync.Mutex      // Protects concurrent access to memory
+	currentBlock             int
+	finalizedBlock           int // Latest block reported under the "finalized" tag
+	nextBlock                int // Next block to be indexed by the background loop
+	reorgDepth               int
+	confirmations            int
+	fetchWorkers             int
+	batchSize                int             // Blocks fetched per JSON-RPC batch request, 1 disables batching
+	batchUnsupported         atomic.Bool     // Set once the node rejects batch requests
+	blockReceiptsUnsupported atomic.Bool     // Set once the node rejects eth_getBlockReceipts
+	traces                   string          // Tracing API used to find internal transfers, empty when off
+	tracingUnsupported       atomic.Bool     // Set once the node rejects the tracing API
+	recent                   []indexedBlock  // Recently indexed blocks, oldest first, used for reorg detection
+	recentMu                 sync.Mutex      // Protects recent against backfill jobs registering their records
+	settling                 []settlingBlock // Indexed blocks whose records are not finalized yet, oldest first
+	rpcClient                rpc.Client
+	heads                    rpc.HeadSubscriber    // Optional source of pushed heads, polling only when nil
+	pending                  rpc.PendingSubscriber // Optional source of pending transactions, no mempool watch when nil
+	pendingTimeout           time.Duration
+	mempool                  *mempool
+	storage                  interfaces.Storage
+	events                   *events.Bus
+	notifier                 interfaces.Notifier // Optional, told about every stored record
+	log                      *logger.Logger
+	mu                       sync.Mutex               // Protects concurrent access to memory
+	tokens                   map[string]tokenMetadata // Metadata of token contracts seen so far, by address
+	tokensMu                 sync.Mutex
+
+	runCtx             context.Context // Context of the running indexer, nil until Run is called
+	backfillSlots      chan struct{}   // Bounds the number of backfill jobs running at once
+	backfillRetryDelay time.Duration
+}
+
+// indexedBlock remembers what was stored for a block so it can be rolled back on a reorg
+type indexedBlock struct {
+	number     int
+	hash       string
+	parentHash string
+	txns       []storedTx
 }
 
-func NewEthParser(client rpc.Client, storage interfaces.Storage, log *logger.Logger) *EthParser {
+// storedTx identifies a transaction stored for a subscribed address
+type storedTx struct {
+	address string
+	hash    string // Record id for records without a transaction hash
+}
+
+// removalKey returns what identifies a record's transaction to storage.RemoveTransaction
+func removalKey(tx interfaces.Transaction) string {
+	if tx.Hash == "" {
+		return tx.RecordID()
+	}
+	return tx.Hash
+}
+
+func NewEthParser(client rpc.Client, storage interfaces.Storage, log *logger.Logger, cfg config.ParserConfig) *EthParser {
 	// Fetch the current block from the RPC client
-	blockNumber, err := client.FetchCurrentBlock()
+	blockNumber, err := client.FetchCurrentBlock(context.Background())
 	if err != nil {
 		log.Error.Printf("Error fetching current block during initialization: %v", err)
 		blockNumber = 0 // Fallback to 0 in case of error
@@ -27,31 +110,126 @@ func NewEthParser(client rpc.Client, storage interfaces.Storage, log *logger.Log
 		log.Info.Printf("Fetched current block: %d during initialization", blockNumber)
 	}
 
-	return &EthParser{
-		currentBlock: blockNumber,
-		rpcClient:    client,
-		storage:      storage,
-		log:          log,
-		recordedTxns: make(map[string]bool), // Initialize the recorded transactions map
+	// Without a known head, starting from it is deferred to the first successful poll
+	startAtHead := blockNumber
+	if err != nil {
+		startAtHead = unknownBlock
+	}
+
+	reorgDepth := cfg.ReorgDepth
+	if reorgDepth <= 0 {
+		reorgDepth = DefaultReorgDepth
+	}
+
+	confirmations := cfg.Confirmations
+	if confirmations <= 0 {
+		confirmations = DefaultConfirmations
+	}
+
+	fetchWorkers := cfg.FetchWorkers
+	if fetchWorkers <= 0 {
+		fetchWorkers = DefaultFetchWorkers
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
 	}
+
+	backfillConcurrency := cfg.BackfillConcurrency
+	if backfillConcurrency <= 0 {
+		backfillConcurrency = DefaultBackfillConcurrency
+	}
+
+	p := &EthParser{
+		currentBlock:       blockNumber,
+		nextBlock:          startAtHead,
+		reorgDepth:         reorgDepth,
+		confirmations:      confirmations,
+		fetchWorkers:       fetchWorkers,
+		batchSize:          batchSize,
+		rpcClient:          client,
+		storage:            storage,
+		events:             events.NewBus(),
+		log:                log,
+		tokens:             make(map[string]tokenMetadata),
+		mempool:            newMempool(),
+		backfillSlots:      make(chan struct{}, backfillConcurrency),
+		backfillRetryDelay: DefaultPollInterval,
+	}
+
+	switch cfg.Traces {
+	case config.TracesDebug, config.TracesTrace:
+		if _, ok := client.(rpc.TraceClient); !ok {
+			log.Error.Printf("RPC client cannot trace blocks, internal transfers will not be indexed")
+			break
+		}
+		p.traces = cfg.Traces
+		log.Info.Printf("Tracing blocks with the %s API to find internal transfers", cfg.Traces)
+	}
+
+	switch cfg.Start {
+	case config.StartHead:
+		log.Info.Println("Starting from the chain head")
+	case config.StartBlock:
+		p.nextBlock = cfg.StartBlock
+		log.Info.Printf("Starting from configured block %d", cfg.StartBlock)
+	default:
+		checkpoint, ok := storage.GetCheckpoint()
+		if !ok {
+			log.Info.Println("No checkpoint found, starting from the chain head")
+			break
+		}
+		p.nextBlock = checkpoint.BlockNumber + 1
+		if checkpoint.BlockHash != "" {
+			// Seed reorg detection so the next block must build on the checkpointed one
+			seeded := indexedBlock{number: checkpoint.BlockNumber, hash: checkpoint.BlockHash}
+			for _, record := range checkpoint.Records {
+				seeded.txns = append(seeded.txns, storedTx{address: record.Address, hash: record.Hash})
+			}
+			p.recent = []indexedBlock{seeded}
+		}
+		log.Info.Printf("Resuming after checkpoint block %d", checkpoint.BlockNumber)
+	}
+
+	return p
+}
+
+// WithHeadSubscriber indexes new blocks as soon as the subscriber pushes their heads, falling back
+// to polling whenever no heads arrive within the poll interval
+func (p *EthParser) WithHeadSubscriber(heads rpc.HeadSubscriber) *EthParser {
+	p.heads = heads
+	return p
+}
+
+// WithNotifier tells the notifier about every record stored for a subscribed address, such as to
+// queue webhook deliveries
+func (p *EthParser) WithNotifier(notifier interfaces.Notifier) *EthParser {
+	p.notifier = notifier
+	return p
 }
 
 // GetCurrentBlock fetches and updates the current block number
-func (p *EthParser) GetCurrentBlock() int {
-	blockNumber, err := p.rpcClient.FetchCurrentBlock()
+func (p *EthParser) GetCurrentBlock(ctx context.Context) int {
+	blockNumber, err := p.rpcClient.FetchCurrentBlock(ctx)
 	if err != nil {
 		p.log.Error.Printf("Error fetching current block: %v", err)
-		return p.currentBlock
+		return p.getCurrentBlock()
 	}
-	p.currentBlock = blockNumber
-	p.log.Info.Printf("Current block updated to %d", p.currentBlock)
-	return p.currentBlock
+	p.setCurrentBlock(blockNumber)
+	p.log.Info.Printf("Current block updated to %d", blockNumber)
+	return blockNumber
 }
 
 // Subscribe adds an address to the storage (if not already subscribed)
 func (p *EthParser) Subscribe(address string) bool {
 	// Normalize the address before subscribing
 	address = utils.NormalizeAddress(address)
+	if address == "" {
+		// Deployments have no recipient, so an empty address would match all of them
+		p.log.Warn.Printf("Refusing to subscribe an empty address")
+		return false
+	}
 
 	if p.storage.AddAddress(address) {
 		p.log.Info.Printf("Address %s successfully subscribed", address)
@@ -61,80 +239,594 @@ func (p *EthParser) Subscribe(address string) bool {
 	return false
 }
 
-// Subscribe adds an address to the storage (if not already subscribed)
+// Unsubscribe stops indexing an address. Its stored transactions are kept, but blocks indexed
+// until it is subscribed again are not scanned for it.
+func (p *EthParser) Unsubscribe(address string) bool {
+	address = utils.NormalizeAddress(address)
+	if p.storage.RemoveAddress(address) {
+		p.log.Info.Printf("Address %s successfully unsubscribed", address)
+		return true
+	}
+	p.log.Warn.Printf("Address %s is not subscribed", address)
+	return false
+}
+
+// GetTransactions returns the transactions indexed so far for an address along with their confirmation status
 func (p *EthParser) GetTransactions(address string) []interfaces.Transaction {
 	// Normalize the address
 	address = utils.NormalizeAddress(address)
 
-	// Fetch the latest block number
-	blockNumber, err := p.rpcClient.FetchCurrentBlock()
-	if err != nil || blockNumber == 0 {
-		p.log.Error.Println("Error fetching block number")
+	stored := p.storage.GetTransactions(address)
+	if stored == nil {
+		p.log.Debug.Printf("Found no transactions for address: %s", address)
 		return nil
 	}
 
-	var newTransactions []interfaces.Transaction
+	// Work on a copy so the status is never written back into storage
+	transactions := make([]interfaces.Transaction, len(stored))
+	copy(transactions, stored)
+
+	// Backfilled transactions are stored after live ones, so order by block, with transactions that
+	// are not mined last
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return blockOrder(transactions[i]) < blockOrder(transactions[j])
+	})
+
+	p.mu.Lock()
+	head, finalized := p.currentBlock, p.finalizedBlock
+	p.mu.Unlock()
+	for i := range transactions {
+		// Transactions that are not mined keep the mempool status they were stored with
+		if transactions[i].Status == "" {
+			transactions[i].Status = p.status(transactions[i].BlockNumber, head, finalized)
+		}
+		if transactions[i].Kind == "" {
+			// Stored before token transfers were tracked
+			transactions[i].Kind = interfaces.KindNative
+		}
+		if transactions[i].Kind == interfaces.KindNative && transactions[i].To == "" {
+			// Stored before deployments were classified
+			transactions[i].Kind = interfaces.KindDeployment
+		}
+		if !transactions[i].Incoming && !transactions[i].Outgoing {
+			// Stored before directions were recorded separately, when only incoming was flagged
+			transactions[i].Outgoing = true
+		}
+	}
+
+	p.log.Debug.Printf("Found %d transactions for address: %s", len(transactions), address)
+	return transactions
+}
+
+// blockOrder returns the block number a stored record sorts by. Only records from the mempool are
+// stored with a status.
+func blockOrder(tx interfaces.Transaction) int {
+	if tx.Status != "" {
+		return math.MaxInt
+	}
+	return tx.BlockNumber
+}
+
+// status derives a transaction's confirmation status from its block number
+func (p *EthParser) status(blockNumber, head, finalized int) string {
+	switch {
+	case blockNumber <= finalized:
+		return interfaces.StatusFinalized
+	case head-blockNumber >= p.confirmations:
+		return interfaces.StatusConfirmed
+	default:
+		return interfaces.StatusUnconfirmed
+	}
+}
+
+// Run polls the chain head every interval and indexes new blocks until ctx is cancelled
+func (p *EthParser) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Heads pushed by the node are indexed right away, polling remains as the fallback
+	var heads chan *rpc.Block
+	if p.heads != nil {
+		heads = make(chan *rpc.Block, headBuffer)
+		go p.heads.SubscribeNewHeads(ctx, heads)
+	}
+
+	// Pending transactions are recorded alongside indexing
+	if p.pending != nil {
+		go p.watchMempool(ctx)
+	}
+
+	p.log.Info.Printf("Indexer started at block %d, polling every %s", p.nextBlock, interval)
+	p.resumeBackfills(ctx)
+
+	p.poll(ctx)
+	var lastHead time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			p.log.Info.Println("Indexer stopped")
+			return
+		case head := <-heads:
+			lastHead = time.Now()
+			p.handleHead(ctx, head)
+		case <-ticker.C:
+			// Only poll while no heads arrive, e.g. when the subscription is down
+			if time.Since(lastHead) >= interval {
+				p.poll(ctx)
+			}
+		}
+	}
+}
+
+// SubscribeEvents returns a channel of indexer events and a function to stop receiving them
+func (p *EthParser) SubscribeEvents(buffer int) (<-chan interfaces.Event, func()) {
+	return p.events.Subscribe(buffer)
+}
+
+// poll indexes every block between the last indexed block and the chain head
+func (p *EthParser) poll(ctx context.Context) {
+	head, err := p.rpcClient.FetchCurrentBlock(ctx)
+	if err != nil {
+		p.log.Error.Printf("Error fetching current block: %v", err)
+		return
+	}
+	p.indexTo(ctx, head)
+}
+
+// handleHead indexes up to a head pushed by the node. Blocks between the last indexed block and
+// the head, such as heads missed while the subscription was down, are fetched by number.
+func (p *EthParser) handleHead(ctx context.Context, head *rpc.Block) {
+	number, err := rpc.ParseBlockNumber(head)
+	if err != nil {
+		p.log.Error.Printf("Error parsing pushed head number: %v", err)
+		return
+	}
+
+	if next := p.getNextBlock(); next != unknownBlock && number > next {
+		p.log.Info.Printf("Head %d skips past block %d, fetching %d missed blocks", number, next, number-next)
+	}
+	p.indexTo(ctx, number)
+}
+
+// indexTo indexes every block between the last indexed block and head
+func (p *EthParser) indexTo(ctx context.Context, head int) {
+	p.setCurrentBlock(head)
+	p.updateFinalizedBlock(ctx)
+	defer p.publishConfirmations()
+
+	if p.nextBlock == unknownBlock {
+		p.setNextBlock(head)
+		p.log.Info.Printf("Starting from chain head %d", head)
+	}
+
+	for p.nextBlock <= head {
+		if !p.indexRange(ctx, p.nextBlock, head) {
+			return
+		}
+	}
+}
+
+// indexRange indexes blocks from..to in order using the fetch pipeline. It returns false when
+// indexing has to stop until the next poll, and true once the range is done or was cut short by a reorg.
+func (p *EthParser) indexRange(ctx context.Context, from, to int) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for result := range p.fetchRange(ctx, from, to) {
+		if result.err != nil {
+			// Stop here so the block is retried on the next poll instead of being skipped
+			p.log.Error.Printf("Error indexing block %d: %v", result.number, result.err)
+			return false
+		}
+		block := result.block
+
+		// The new block must build on the last block we indexed, otherwise the chain has reorganized
+		if last := p.lastIndexed(); last != nil && block.ParentHash != last.hash {
+			p.log.Warn.Printf("Block %d parent %s does not match indexed block %d hash %s", result.number, block.ParentHash, last.number, last.hash)
+			if err := p.rollback(ctx); err != nil {
+				p.log.Error.Printf("Error handling reorg at block %d: %v", result.number, err)
+				return false
+			}
+			// Blocks already fetched may belong to the orphaned branch, so start over from the ancestor
+			return true
+		}
+
+		if err := p.indexBlock(ctx, result); err != nil {
+			p.log.Error.Printf("Error indexing block %d: %v", result.number, err)
+			return false
+		}
+		p.saveCheckpoint()
+		p.setNextBlock(result.number + 1)
+	}
+
+	// The pipeline also stops early when ctx is cancelled
+	return ctx.Err() == nil
+}
+
+// updateFinalizedBlock refreshes the finalized block number, keeping the previous value on error
+func (p *EthParser) updateFinalizedBlock(ctx context.Context) {
+	block, err := p.rpcClient.FetchBlockByTag(ctx, "finalized")
+	if err != nil || block == nil {
+		// Nodes without finality support report an error here, in which case nothing is finalized
+		p.log.Debug.Printf("Error fetching finalized block: %v", err)
+		return
+	}
+
+	number, err := rpc.ParseBlockNumber(block)
+	if err != nil {
+		p.log.Error.Printf("Error parsing finalized block number: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finalizedBlock = number
+}
 
-	// Iterate through the blocks and filter transactions for the address
-	for i := p.currentBlock; i <= blockNumber; i++ {
-		block, err := p.rpcClient.FetchBlockByNumber(i)
+// fetchBlock fetches a block by number, treating a missing block as an error
+func (p *EthParser) fetchBlock(ctx context.Context, number int) (*rpc.Block, error) {
+	block, err := p.rpcClient.FetchBlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errBlockNotAvailable(number)
+	}
+	return block, nil
+}
+
+// errBlockNotAvailable is returned for blocks the node does not have yet
+func errBlockNotAvailable(number int) error {
+	return fmt.Errorf("block %d not available yet", number)
+}
+
+// indexBlock stores the block's transactions, token transfers and internal transfers for every
+// subscribed address involved. Nothing is stored when the receipts of the matched transactions
+// cannot be fetched, so the block can be retried.
+func (p *EthParser) indexBlock(ctx context.Context, result fetchResult) error {
+	number, block := result.number, result.block
+	indexed := indexedBlock{
+		number:     number,
+		hash:       block.Hash,
+		parentHash: block.ParentHash,
+	}
+
+	// matchedTx is a record involving at least one subscribed address
+	type matchedTx struct {
+		tx        interfaces.Transaction
+		addresses []string
+	}
+	var matched []*matchedTx
+	for _, raw := range block.Transactions {
+		addresses := p.involved(utils.NormalizeAddress(raw.From), utils.NormalizeAddress(raw.To))
+		if len(addresses) == 0 {
+			continue
+		}
+
+		tx, err := newTransaction(raw, block, number)
 		if err != nil {
-			p.log.Error.Printf("Error fetching block %d: %v", i, err)
+			p.log.Error.Printf("Skipping transaction in block %d: %v", number, err)
+			continue
+		}
+		matched = append(matched, &matchedTx{tx: tx, addresses: addresses})
+	}
+	for _, tx := range p.transfers(result) {
+		addresses := p.involved(tx.From, tx.To)
+		if len(addresses) == 0 {
 			continue
 		}
+		if tx.Token != nil {
+			p.addTokenMetadata(ctx, &tx)
+		}
+		matched = append(matched, &matchedTx{tx: tx, addresses: addresses})
+	}
 
-		// Filter transactions for the address (inbound or outbound)
-		for _, tx := range block.Transactions {
-			from := utils.NormalizeAddress(tx.From)
-			to := utils.NormalizeAddress(tx.To)
-
-			// If the address is involved, determine if it's incoming or outgoing
-			if from == address {
-				// Outgoing transaction
-				newTransactions = append(newTransactions, interfaces.Transaction{
-					Hash:     tx.Hash,
-					From:     from,
-					To:       to,
-					Value:    tx.Value,
-					Incoming: false, // Outgoing
-				})
-			} else if to == address {
-				// Incoming transaction
-				newTransactions = append(newTransactions, interfaces.Transaction{
-					Hash:     tx.Hash,
-					From:     from,
-					To:       to,
-					Value:    tx.Value,
-					Incoming: true, // Incoming
-				})
-			}
+	// Token and internal transfers only exist for successful transactions, so only the block's own
+	// transactions need receipts
+	var txs []*interfaces.Transaction
+	for _, m := range matched {
+		if needsReceipt(m.tx) {
+			txs = append(txs, &m.tx)
+		}
+	}
+	if err := p.addReceipts(ctx, number, block, txs); err != nil {
+		return err
+	}
+
+	// Settle the mempool before storing, so a late pending announcement cannot overwrite a mined record
+	var hashes []string
+	for _, m := range matched {
+		hashes = append(hashes, m.tx.Hash)
+	}
+	p.reconcileMined(number, block, hashes)
+
+	// Storage keeps each record once per address, so indexing a block again cannot duplicate it
+	for _, m := range matched {
+		for _, address := range m.addresses {
+			p.storeRecord(address, m.tx)
+			indexed.txns = append(indexed.txns, storedTx{address: address, hash: removalKey(m.tx)})
+		}
+	}
+
+	p.trackConfirmations(indexed)
+
+	// Keep only the most recent blocks needed for reorg detection
+	p.recentMu.Lock()
+	p.recent = append(p.recent, indexed)
+	if len(p.recent) > p.reorgDepth {
+		p.recent = p.recent[len(p.recent)-p.reorgDepth:]
+	}
+	p.recentMu.Unlock()
 
-			// Record the transaction to avoid duplicates
-			if !p.isRecorded(tx.Hash) {
-				p.recordTransaction(tx.Hash)
-				// Store the transaction in the memory storage
-				p.storage.AddTransaction(address, tx)
+	p.log.Debug.Printf("Indexed block %d: %d transactions, %d matched", number, len(block.Transactions), len(indexed.txns))
+	return nil
+}
+
+// involved returns the subscribed addresses among a record's sender and recipient, each once
+func (p *EthParser) involved(from, to string) []string {
+	var addresses []string
+	if p.storage.IsSubscribed(from) {
+		addresses = append(addresses, from)
+	}
+	// Deployments have no recipient
+	if to != "" && to != from && p.storage.IsSubscribed(to) {
+		addresses = append(addresses, to)
+	}
+	return addresses
+}
+
+// forAddress returns a record as seen by one of its addresses. A self-transfer is both sent and
+// received by the address.
+func forAddress(tx interfaces.Transaction, address string) interfaces.Transaction {
+	tx.Outgoing = tx.From == address
+	tx.Incoming = tx.To == address
+	return tx
+}
+
+// storeRecord stores a record for an address and publishes it to event subscribers and the notifier
+func (p *EthParser) storeRecord(address string, tx interfaces.Transaction) {
+	p.store(address, tx, false)
+}
+
+// storeBackfilled stores a record found by a backfill, marking its event as such
+func (p *EthParser) storeBackfilled(address string, tx interfaces.Transaction) {
+	p.store(address, tx, true)
+}
+
+func (p *EthParser) store(address string, tx interfaces.Transaction, backfill bool) {
+	tx = forAddress(tx, address)
+	p.storage.AddTransaction(address, tx)
+
+	if tx.Status == "" {
+		p.mu.Lock()
+		head, finalized := p.currentBlock, p.finalizedBlock
+		p.mu.Unlock()
+		tx.Status = p.status(tx.BlockNumber, head, finalized)
+	}
+	event := interfaces.Event{
+		Type:        interfaces.EventTransaction,
+		Transaction: &interfaces.TransactionEvent{Address: address, Transaction: tx, Backfill: backfill},
+	}
+	p.events.Publish(event)
+	if p.notifier != nil {
+		p.notifier.Notify(event)
+	}
+}
+
+// transfers derives the token and internal transfers and the withdrawals of a fetched block
+func (p *EthParser) transfers(result fetchResult) []interfaces.Transaction {
+	transfers := p.tokenTransfers(result.number, result.block, result.logs)
+	transfers = append(transfers, p.internalTransfers(result.number, result.block, result.traces)...)
+	return append(transfers, p.withdrawals(result.number, result.block)...)
+}
+
+// newTransaction builds the stored form of a block transaction as seen by its sender
+func newTransaction(raw rpc.Transaction, block *rpc.Block, number int) (interfaces.Transaction, error) {
+	tx, err := rpc.ParseTransaction(raw)
+	if err != nil {
+		return interfaces.Transaction{}, err
+	}
+
+	// The block is authoritative for where the transaction was included
+	tx.BlockNumber = number
+	tx.BlockHash = block.Hash
+	if tx.Timestamp, err = blockTime(number, block); err != nil {
+		return interfaces.Transaction{}, err
+	}
+	return tx, nil
+}
+
+// needsReceipt reports whether a record is a block transaction, whose outcome comes from its receipt
+func needsReceipt(tx interfaces.Transaction) bool {
+	return tx.Kind == interfaces.KindNative || tx.Kind == interfaces.KindDeployment
+}
+
+// blockTime returns the Unix timestamp of a block, or zero when the node did not report it
+func blockTime(number int, block *rpc.Block) (int64, error) {
+	if block.Timestamp == "" {
+		return 0, nil
+	}
+	timestamp, err := rpc.ParseBlockTimestamp(block)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp of block %d: %w", number, err)
+	}
+	return timestamp, nil
+}
+
+// rollback walks back from the last indexed block to the common ancestor with the canonical chain,
+// removes everything stored from the orphaned blocks and rewinds the indexer to re-index them
+func (p *EthParser) rollback(ctx context.Context) error {
+	orphaned := 0
+	for i := len(p.recent) - 1; i >= 0; i-- {
+		block, err := p.fetchBlock(ctx, p.recent[i].number)
+		if err != nil {
+			return err
+		}
+		if block.Hash == p.recent[i].hash {
+			break
+		}
+		orphaned++
+	}
+
+	if orphaned == 0 {
+		// The node may not have caught up with its own head yet, try again on the next poll
+		return fmt.Errorf("block %d is still canonical", p.recent[len(p.recent)-1].number)
+	}
+	reverted := p.recent[len(p.recent)-orphaned:]
+	fromBlock := reverted[0].number
+	if orphaned == len(p.recent) {
+		// The records of older blocks are not tracked, so find the common ancestor and remove
+		// everything stored after it
+		ancestor, err := p.commonAncestor(ctx, reverted[0])
+		if err != nil {
+			return fmt.Errorf("reorg is deeper than the %d tracked blocks: %w", p.reorgDepth, err)
+		}
+		fromBlock = ancestor + 1
+	}
+
+	// Backfill jobs must not register records in the orphaned blocks while they are removed
+	p.recentMu.Lock()
+	defer p.recentMu.Unlock()
+
+	affected := make(map[string]bool)
+	var addresses []string
+	for _, block := range reverted {
+		for _, tx := range block.txns {
+			p.storage.RemoveTransaction(tx.address, tx.hash)
+			if !affected[tx.address] {
+				affected[tx.address] = true
+				addresses = append(addresses, tx.address)
+			}
+		}
+	}
+	if fromBlock < reverted[0].number {
+		for _, address := range p.storage.RemoveTransactionsFrom(fromBlock) {
+			if !affected[address] {
+				affected[address] = true
+				addresses = append(addresses, address)
 			}
 		}
 	}
 
-	// Update the current block after processing
-	p.currentBlock = blockNumber
+	event := &interfaces.ReorgEvent{
+		Depth:     reverted[len(reverted)-1].number - fromBlock + 1,
+		FromBlock: fromBlock,
+		ToBlock:   reverted[len(reverted)-1].number,
+		Addresses: addresses,
+	}
+
+	p.recent = p.recent[:len(p.recent)-orphaned]
+	p.forgetConfirmations(event.FromBlock)
+	p.setNextBlock(event.FromBlock)
+
+	// Move the checkpoint back to the common ancestor
+	checkpoint := interfaces.Checkpoint{BlockNumber: event.FromBlock - 1}
+	if last := p.lastIndexed(); last != nil {
+		checkpoint = checkpointOf(*last)
+	}
+	p.storage.SaveCheckpoint(checkpoint)
+
+	p.log.Warn.Printf("Reorg of depth %d rolled back blocks %d-%d affecting %d addresses", event.Depth, event.FromBlock, event.ToBlock, len(addresses))
+	p.events.Publish(interfaces.Event{Type: interfaces.EventReorg, Reorg: event})
+	p.revertMined(event.FromBlock)
+	return nil
+}
+
+// commonAncestor walks back from an orphaned block along the parent hashes of its branch until
+// the canonical block at the same height matches, and returns that block's number. It fails when
+// the node no longer has a block of the orphaned branch.
+func (p *EthParser) commonAncestor(ctx context.Context, orphaned indexedBlock) (int, error) {
+	headers, ok := p.rpcClient.(rpc.HeaderClient)
+	if !ok {
+		return 0, fmt.Errorf("client cannot fetch orphaned blocks by hash")
+	}
+
+	number, hash := orphaned.number, orphaned.hash
+	for number > 0 {
+		block, err := headers.FetchHeaderByHash(ctx, hash)
+		if err != nil {
+			return 0, err
+		}
+		if block == nil {
+			return 0, fmt.Errorf("orphaned block %d %s is unknown to the node", number, hash)
+		}
+		number, hash = number-1, block.ParentHash
+
+		canonical, err := p.fetchBlock(ctx, number)
+		if err != nil {
+			return 0, err
+		}
+		if canonical.Hash == hash {
+			p.log.Warn.Printf("Reorg is deeper than the %d tracked blocks, common ancestor is block %d", p.reorgDepth, number)
+			return number, nil
+		}
+	}
+	return 0, fmt.Errorf("no common ancestor of orphaned block %d %s", orphaned.number, orphaned.hash)
+}
 
-	p.log.Info.Printf("Fetched %d new transactions for address: %s", len(newTransactions), address)
-	return newTransactions
+// saveCheckpoint saves the last indexed block as the checkpoint
+func (p *EthParser) saveCheckpoint() {
+	p.recentMu.Lock()
+	defer p.recentMu.Unlock()
+	p.storage.SaveCheckpoint(checkpointOf(*p.lastIndexed()))
+}
+
+// checkpointOf returns the checkpoint of an indexed block. It carries the block's records, so a
+// restarted indexer can still remove them when a reorg orphans the block.
+func checkpointOf(block indexedBlock) interfaces.Checkpoint {
+	checkpoint := interfaces.Checkpoint{BlockNumber: block.number, BlockHash: block.hash}
+	for _, tx := range block.txns {
+		checkpoint.Records = append(checkpoint.Records, interfaces.CheckpointRecord{Address: tx.address, Hash: tx.hash})
+	}
+	return checkpoint
+}
+
+// indexedAt returns the tracked block with the given number, if any. The caller must hold recentMu.
+func (p *EthParser) indexedAt(number int) *indexedBlock {
+	for i := range p.recent {
+		if p.recent[i].number == number {
+			return &p.recent[i]
+		}
+	}
+	return nil
+}
+
+// lastIndexed returns the most recently indexed block, if any
+func (p *EthParser) lastIndexed() *indexedBlock {
+	if len(p.recent) == 0 {
+		return nil
+	}
+	return &p.recent[len(p.recent)-1]
+}
+
+// getCurrentBlock returns the last known chain head
+func (p *EthParser) getCurrentBlock() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.currentBlock
+}
+
+// setCurrentBlock updates the last known chain head
+func (p *EthParser) setCurrentBlock(blockNumber int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.currentBlock = blockNumber
 }
 
-// isRecorded checks if a transaction has already been recorded
-func (p *EthParser) isRecorded(txHash string) bool {
+// getNextBlock returns the next block to be indexed by the background loop
+func (p *EthParser) getNextBlock() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.recordedTxns[txHash]
+	return p.nextBlock
 }
 
-// recordTransaction records a new transaction hash in memory
-func (p *EthParser) recordTransaction(txHash string) {
+// setNextBlock updates the next block to be indexed; only the background loop calls it
+func (p *EthParser) setNextBlock(blockNumber int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.recordedTxns[txHash] = true
+	p.nextBlock = blockNumber
 }
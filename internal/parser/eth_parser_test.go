@@ -1,7 +1,13 @@
 package parser
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"tx-parser/internal/config"
 	"tx-parser/internal/interfaces"
 	"tx-parser/internal/rpc"
 	"tx-parser/internal/storage"
@@ -13,42 +19,222 @@ import (
 // Mock implementation of the rpc.Client
 type mockRPCClient struct{}
 
-func (m *mockRPCClient) FetchCurrentBlock() (int, error) {
+func (m *mockRPCClient) FetchCurrentBlock(ctx context.Context) (int, error) {
 	return 10, nil
 }
 
-func (m *mockRPCClient) FetchBlockByNumber(blockNumber int) (*rpc.Block, error) {
+func (m *mockRPCClient) FetchBlockByNumber(ctx context.Context, blockNumber int) (*rpc.Block, error) {
 	// Return mock block with transactions based on the block number
 	switch blockNumber {
 	case 1:
 		return &rpc.Block{
-			Transactions: []interfaces.Transaction{
-				{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "100"},
-				{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "200"},
+			Transactions: []rpc.Transaction{
+				{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"},
+				{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"},
 			},
 		}, nil
 	case 2:
 		return &rpc.Block{
-			Transactions: []interfaces.Transaction{
-				{Hash: "0x3", From: "0xtestaddress", To: "0xto2", Value: "300"},
+			Transactions: []rpc.Transaction{
+				{Hash: "0x3", From: "0xtestaddress", To: "0xto2", Value: "0x12c"},
 			},
 		}, nil
 	default:
 		return &rpc.Block{
-			Transactions: []interfaces.Transaction{
-				{Hash: "0x4", From: "0xfrom2", To: "0xanotheraddress", Value: "400"},
+			Transactions: []rpc.Transaction{
+				{Hash: "0x4", From: "0xfrom2", To: "0xanotheraddress", Value: "0x190"},
 			},
 		}, nil
 	}
 }
 
+func (m *mockRPCClient) FetchBlockByTag(ctx context.Context, tag string) (*rpc.Block, error) {
+	return nil, fmt.Errorf("unsupported block tag %s", tag)
+}
+
+func (m *mockRPCClient) FetchTransactionReceipt(ctx context.Context, txHash string) (*rpc.Receipt, error) {
+	return &rpc.Receipt{TransactionHash: txHash, Status: "0x1", GasUsed: "0x5208", EffectiveGasPrice: "0x1"}, nil
+}
+
+func (m *mockRPCClient) FetchLogs(ctx context.Context, filter rpc.LogFilter) ([]rpc.Log, error) {
+	return nil, nil
+}
+
+func (m *mockRPCClient) CallContract(ctx context.Context, to, data string) (string, error) {
+	return "", rpc.ErrExecutionReverted
+}
+
+// mockChain is a mock rpc.Client serving blocks whose hashes link through parent hashes
+type mockChain struct {
+	blocks    map[int]*rpc.Block
+	byHash    map[string]*rpc.Block // Every block ever added, including orphaned ones
+	head      int
+	finalized int
+	reverted  map[string]bool      // Hashes of transactions whose receipts report a failure
+	receipts  atomic.Int32         // Number of receipt requests served
+	logs      map[string][]rpc.Log // Token transfer logs by block hash
+	tokens    map[string][2]string // ABI encoded symbol and decimals by token contract
+	calls     atomic.Int32         // Number of contract calls served
+	headers   atomic.Int32         // Number of headers served by number
+}
+
+func newMockChain() *mockChain {
+	return &mockChain{
+		blocks:   make(map[int]*rpc.Block),
+		byHash:   make(map[string]*rpc.Block),
+		reverted: make(map[string]bool),
+		logs:     make(map[string][]rpc.Log),
+		tokens:   make(map[string][2]string),
+	}
+}
+
+// addTransfer adds an ERC-20 transfer log to the block currently at the given number
+func (c *mockChain) addTransfer(number int, txHash, token, from, to string, amount int64) {
+	c.addLog(number, txHash, token, fmt.Sprintf("0x%064x", amount), rpc.TransferTopic, addressTopic(from), addressTopic(to))
+}
+
+// addLog adds a log to the block currently at the given number
+func (c *mockChain) addLog(number int, txHash, address, data string, topics ...string) {
+	block := c.blocks[number]
+	c.logs[block.Hash] = append(c.logs[block.Hash], rpc.Log{
+		Address:         address,
+		Topics:          topics,
+		Data:            data,
+		BlockNumber:     block.Number,
+		BlockHash:       block.Hash,
+		TransactionHash: txHash,
+		LogIndex:        fmt.Sprintf("0x%x", len(c.logs[block.Hash])),
+	})
+}
+
+// addressTopic left-pads an address to a 32 byte topic
+func addressTopic(address string) string {
+	return fmt.Sprintf("0x%064s", strings.TrimPrefix(address, "0x"))
+}
+
+// addBlock appends a block on top of the current chain at the given number, replacing any existing branch
+func (c *mockChain) addBlock(number int, branch string, txs ...rpc.Transaction) {
+	parentHash := ""
+	if parent, ok := c.blocks[number-1]; ok {
+		parentHash = parent.Hash
+	}
+	c.blocks[number] = &rpc.Block{
+		Number:       fmt.Sprintf("0x%x", number),
+		Hash:         fmt.Sprintf("0x%s%d", branch, number),
+		ParentHash:   parentHash,
+		Timestamp:    fmt.Sprintf("0x%x", number*12),
+		Transactions: txs,
+	}
+	c.byHash[c.blocks[number].Hash] = c.blocks[number]
+	c.head = number
+}
+
+func (c *mockChain) FetchCurrentBlock(ctx context.Context) (int, error) {
+	return c.head, nil
+}
+
+func (c *mockChain) FetchBlockByNumber(ctx context.Context, blockNumber int) (*rpc.Block, error) {
+	if blockNumber > c.head {
+		return nil, nil
+	}
+	return c.blocks[blockNumber], nil
+}
+
+func (c *mockChain) FetchHeaderByNumber(ctx context.Context, blockNumber int) (*rpc.Block, error) {
+	c.headers.Add(1)
+	block, err := c.FetchBlockByNumber(ctx, blockNumber)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	header := *block
+	header.Transactions = nil
+	return &header, nil
+}
+
+// FetchHeaderByHash returns any block ever added, like a node that still has orphaned blocks
+func (c *mockChain) FetchHeaderByHash(ctx context.Context, hash string) (*rpc.Block, error) {
+	block, ok := c.byHash[hash]
+	if !ok {
+		return nil, nil
+	}
+	header := *block
+	header.Transactions = nil
+	return &header, nil
+}
+
+func (c *mockChain) FetchBlockByTag(ctx context.Context, tag string) (*rpc.Block, error) {
+	if tag != "finalized" {
+		return nil, fmt.Errorf("unsupported block tag %s", tag)
+	}
+	return c.blocks[c.finalized], nil
+}
+
+// FetchLogs returns the logs of a canonical block, failing like a node for blocks it does not have
+func (c *mockChain) FetchLogs(ctx context.Context, filter rpc.LogFilter) ([]rpc.Log, error) {
+	for number := 0; number <= c.head; number++ {
+		if block, ok := c.blocks[number]; ok && block.Hash == filter.BlockHash {
+			return c.logs[block.Hash], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown block %s", filter.BlockHash)
+}
+
+// CallContract answers the metadata getters of the configured tokens and reverts otherwise
+func (c *mockChain) CallContract(ctx context.Context, to, data string) (string, error) {
+	c.calls.Add(1)
+	token, ok := c.tokens[to]
+	switch {
+	case !ok:
+		return "", rpc.ErrExecutionReverted
+	case data == rpc.SymbolSelector:
+		return token[0], nil
+	default:
+		return token[1], nil
+	}
+}
+
+// FetchTransactionReceipt returns the receipt of a transaction in the canonical chain, paying 1 gwei for 21000 gas
+func (c *mockChain) FetchTransactionReceipt(ctx context.Context, txHash string) (*rpc.Receipt, error) {
+	c.receipts.Add(1)
+	for number := 0; number <= c.head; number++ {
+		block, ok := c.blocks[number]
+		if !ok {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			if tx.Hash == txHash {
+				return c.receipt(block, tx), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (c *mockChain) receipt(block *rpc.Block, tx rpc.Transaction) *rpc.Receipt {
+	status := "0x1"
+	if c.reverted[tx.Hash] {
+		status = "0x0"
+	}
+	receipt := &rpc.Receipt{
+		TransactionHash:   tx.Hash,
+		BlockHash:         block.Hash,
+		Status:            status,
+		GasUsed:           "0x5208",
+		EffectiveGasPrice: "0x3b9aca00",
+	}
+	if tx.To == "" {
+		receipt.ContractAddress = "0xcontract" + strings.TrimPrefix(tx.Hash, "0x")
+	}
+	return receipt
+}
+
 // Test fetching current block during initialization
 func TestNewEthParser(t *testing.T) {
 	log := logger.GetLogger("debug")
 	client := &mockRPCClient{}
 	storage := storage.NewMemoryStorage()
 
-	parser := NewEthParser(client, storage, log)
+	parser := NewEthParser(client, storage, log, config.ParserConfig{})
 	assert.Equal(t, 10, parser.currentBlock, "The initial block number should be 10")
 }
 
@@ -58,7 +244,7 @@ func TestSubscribe(t *testing.T) {
 	client := &mockRPCClient{}
 	storage := storage.NewMemoryStorage()
 
-	parser := NewEthParser(client, storage, log)
+	parser := NewEthParser(client, storage, log, config.ParserConfig{})
 
 	// Test subscribing to a new address
 	address := "0xTestAddress"
@@ -68,15 +254,20 @@ func TestSubscribe(t *testing.T) {
 	// Test subscribing again to the same address
 	subscribed = parser.Subscribe(address)
 	assert.False(t, subscribed, "Should not subscribe the same address again")
+
+	// Test unsubscribing the address
+	assert.True(t, parser.Unsubscribe(" 0xTESTADDRESS"), "Should unsubscribe a subscribed address")
+	assert.False(t, storage.IsSubscribed(address), "Address should no longer be subscribed")
+	assert.False(t, parser.Unsubscribe(address), "Should not unsubscribe an address that is not subscribed")
 }
 
-// Test fetching transactions for an address
+// Test fetching transactions for an address before anything has been indexed
 func TestGetTransactions(t *testing.T) {
 	log := logger.GetLogger("debug")
 	client := &mockRPCClient{}
 	mockStorage := storage.NewMemoryStorage()
 
-	parser := NewEthParser(client, mockStorage, log)
+	parser := NewEthParser(client, mockStorage, log, config.ParserConfig{})
 
 	// Subscribe the address before fetching transactions
 	parser.Subscribe("0xtestaddress")
@@ -87,22 +278,810 @@ func TestGetTransactions(t *testing.T) {
 	// Debugging log to see the number of transactions fetched
 	log.Debug.Printf("Number of transactions fetched: %d", len(transactions))
 
-	// Check that we fetched 0 transactions
+	// Nothing has been indexed yet, so storage is empty
 	assert.Len(t, transactions, 0, "Should return 0 transactions")
 }
 
-// Test recording transactions and avoiding duplicates
-func TestIsRecordedAndRecordTransaction(t *testing.T) {
+// Test that polling indexes new blocks for every subscribed address
+func TestPoll(t *testing.T) {
 	log := logger.GetLogger("debug")
 	client := &mockRPCClient{}
-	storage := storage.NewMemoryStorage()
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(client, mockStorage, log, config.ParserConfig{})
+	parser.Subscribe("0xTestAddress")
+	parser.Subscribe("0xto2")
+
+	// Start indexing from block 1 so the mock blocks with matching transactions are walked
+	parser.nextBlock = 1
+	parser.poll(context.Background())
+	assert.Equal(t, 11, parser.nextBlock, "All blocks up to the head should be indexed")
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 3, "Should return 3 transactions")
+	assert.Equal(t, "0x1", transactions[0].Hash, "First transaction hash should match")
+	assert.True(t, transactions[0].Incoming, "First transaction should be incoming")
+	assert.False(t, transactions[1].Incoming, "Second transaction should be outgoing")
+
+	// A transaction between two subscribed addresses is stored for both
+	transactions = parser.GetTransactions("0xto2")
+	assert.Len(t, transactions, 1, "Should return 1 transaction")
+	assert.True(t, transactions[0].Incoming, "Transaction should be incoming")
+
+	// Unsubscribed addresses are not indexed
+	assert.Len(t, parser.GetTransactions("0xanotheraddress"), 0, "Should not index unsubscribed addresses")
+
+	// Polling again without a new head does not duplicate transactions
+	parser.poll(context.Background())
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 3, "Should not duplicate transactions")
+}
+
+// Test that each record is stored once for every subscribed address it involves
+func TestPoll_Attribution(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a",
+		rpc.Transaction{Hash: "0x1", From: "0xalice", To: "0xbob", Value: "0x1"},
+		rpc.Transaction{Hash: "0x2", From: "0xalice", To: "0xalice", Value: "0x1"},
+		rpc.Transaction{Hash: "0x3", From: "0xcarol", To: "0xdave", Value: "0x1"},
+	)
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xalice")
+	parser.Subscribe("0xbob")
+	parser.poll(context.Background())
+
+	alice := parser.GetTransactions("0xalice")
+	assert.Len(t, alice, 2, "Should store the transfer and the self-transfer once each")
+	assert.True(t, alice[0].Outgoing, "Sent transaction should be outgoing")
+	assert.False(t, alice[0].Incoming, "Sent transaction should not be incoming")
+	assert.True(t, alice[1].Outgoing && alice[1].Incoming, "Self-transfer should be both outgoing and incoming")
+
+	bob := parser.GetTransactions("0xbob")
+	assert.Len(t, bob, 1, "Should store the transfer for its recipient too")
+	assert.True(t, bob[0].Incoming, "Received transaction should be incoming")
+	assert.False(t, bob[0].Outgoing, "Received transaction should not be outgoing")
+
+	// Indexing the block again replaces the stored records instead of duplicating them
+	parser.indexRange(context.Background(), 1, 1)
+	assert.Len(t, parser.GetTransactions("0xalice"), 2, "Should not duplicate transactions")
+	assert.Empty(t, parser.GetTransactions("0xcarol"), "Unrelated transactions should never be stored")
+}
+
+// recordingNotifier records the events it is notified of
+type recordingNotifier struct {
+	events []interfaces.Event
+}
+
+func (n *recordingNotifier) Notify(event interfaces.Event) {
+	n.events = append(n.events, event)
+}
+
+// Test that the notifier is told about every stored record with its status
+func TestPoll_Notifier(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a",
+		rpc.Transaction{Hash: "0x1", From: "0xalice", To: "0xbob", Value: "0x1"},
+		rpc.Transaction{Hash: "0x2", From: "0xcarol", To: "0xdave", Value: "0x1"},
+	)
+	notifier := &recordingNotifier{}
+
+	parser := NewEthParser(chain, storage.NewMemoryStorage(), log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1}).WithNotifier(notifier)
+	parser.Subscribe("0xalice")
+	parser.Subscribe("0xbob")
+	parser.poll(context.Background())
+
+	assert.Len(t, notifier.events, 2, "Should notify once per stored record")
+	for _, event := range notifier.events {
+		assert.Equal(t, interfaces.EventTransaction, event.Type, "Event should be a transaction event")
+		assert.Equal(t, "0x1", event.Transaction.Transaction.Hash, "Only the matching transaction should be notified")
+		assert.Equal(t, interfaces.StatusUnconfirmed, event.Transaction.Transaction.Status, "Notified record should carry its status")
+		assert.False(t, event.Transaction.Backfill, "Records of the live indexer should not be marked as backfilled")
+	}
+	assert.True(t, notifier.events[0].Transaction.Transaction.Outgoing, "Record notified for the sender should be outgoing")
+	assert.True(t, notifier.events[1].Transaction.Transaction.Incoming, "Record notified for the recipient should be incoming")
+}
+
+// Test that withdrawals to subscribed addresses are stored and rolled back with their block
+func TestPoll_Withdrawals(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	chain.blocks[1].Withdrawals = []rpc.Withdrawal{
+		{Index: "0x1", ValidatorIndex: "0x10", Address: "0xTestAddress", Amount: "0x3b9aca00"},
+		{Index: "0x2", ValidatorIndex: "0x11", Address: "0xother", Amount: "0x1"},
+	}
+	chain.addBlock(2, "a")
+	chain.blocks[2].Withdrawals = []rpc.Withdrawal{{Index: "0x3", ValidatorIndex: "0x10", Address: "0xtestaddress", Amount: "0x1"}}
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 2, "Should store the withdrawals to the subscribed address")
+	assert.Equal(t, interfaces.KindWithdrawal, transactions[0].Kind, "Record should be a withdrawal")
+	assert.Equal(t, "1000000000000000000", transactions[0].Value.String(), "Amount should be in wei")
+	assert.Equal(t, uint64(16), transactions[0].Withdrawal.ValidatorIndex, "Validator index should be recorded")
+	assert.True(t, transactions[0].Incoming, "Withdrawals should be incoming")
+	assert.Equal(t, int32(0), chain.receipts.Load(), "Withdrawals should not need receipts")
+
+	// Orphaning block 2 removes only its withdrawal
+	chain.addBlock(2, "b")
+	chain.addBlock(3, "b")
+	parser.poll(context.Background())
+	transactions = parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "The orphaned withdrawal should be rolled back")
+	assert.Equal(t, uint64(1), transactions[0].Withdrawal.Index, "The canonical withdrawal should be kept")
+}
+
+// Test that a reorg rolls back orphaned transactions and re-indexes the canonical chain
+func TestPoll_Reorg(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"})
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{})
+	parser.Subscribe("0xtestaddress")
+	events, cancel := parser.SubscribeEvents(16)
+	defer cancel()
+
+	parser.nextBlock = 1
+	parser.poll(context.Background())
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 2, "Should index 2 transactions")
+
+	// Replace blocks 2 and 3 with a competing branch that drops 0x2 and includes a new transaction
+	chain.addBlock(2, "b", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(3, "b")
+	chain.addBlock(4, "b", rpc.Transaction{Hash: "0x3", From: "0xfrom2", To: "0xtestaddress", Value: "0x12c"})
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 2, "Should keep only canonical transactions")
+	assert.Equal(t, "0x1", transactions[0].Hash, "Transaction re-included on the new branch should be re-indexed")
+	assert.Equal(t, "0x3", transactions[1].Hash, "Transaction from the new branch should be indexed")
+	assert.Equal(t, 5, parser.nextBlock, "Indexer should continue from the new head")
+	for _, block := range parser.settling {
+		assert.Contains(t, []string{"0xb2", "0xb4"}, block.hash, "Only canonical blocks should be followed for confirmations")
+	}
+
+	// Stored records and confirmations are published too, so skip to the reorg
+	event := <-events
+	for event.Type != interfaces.EventReorg {
+		event = <-events
+	}
+	assert.Equal(t, interfaces.EventReorg, event.Type, "Should emit a reorg event")
+	assert.Equal(t, 2, event.Reorg.Depth, "Reorg depth should be 2")
+	assert.Equal(t, 2, event.Reorg.FromBlock, "Reorg should start at block 2")
+	assert.Equal(t, 3, event.Reorg.ToBlock, "Reorg should end at block 3")
+	assert.Equal(t, []string{"0xtestaddress"}, event.Reorg.Addresses, "Reorg should report affected addresses")
+}
+
+// Test that a reorg deeper than the tracked blocks is followed back to the common ancestor, and the
+// records stored since are removed
+func TestPoll_DeepReorg(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"})
+	chain.addBlock(4, "a", rpc.Transaction{Hash: "0x3", From: "0xfrom2", To: "0xtestaddress", Value: "0x12c"})
+	chain.addBlock(5, "a")
+	chain.addBlock(6, "a")
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{ReorgDepth: 2})
+	parser.Subscribe("0xtestaddress")
+	events, cancel := parser.SubscribeEvents(64)
+	defer cancel()
+
+	parser.nextBlock = 1
+	parser.poll(context.Background())
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 3, "Should index 3 transactions")
+	assert.Len(t, parser.recent, 2, "Only the last 2 blocks should be tracked")
+
+	// Replace every block after block 2 with a competing branch, deeper than the tracked blocks
+	for number := 3; number <= 7; number++ {
+		chain.addBlock(number, "b")
+	}
+	chain.addBlock(8, "b", rpc.Transaction{Hash: "0x4", From: "0xfrom3", To: "0xtestaddress", Value: "0x1"})
+
+	// A node that lost the orphaned branch cannot tell where it forked, so indexing stops there
+	orphaned := chain.byHash["0xa4"]
+	delete(chain.byHash, "0xa4")
+	parser.poll(context.Background())
+	assert.Equal(t, 7, parser.nextBlock, "Indexer should not move on without the common ancestor")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 3, "Records should be kept until the reorg is handled")
+
+	chain.byHash["0xa4"] = orphaned
+	parser.poll(context.Background())
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 2, "Records of untracked orphaned blocks should be removed")
+	assert.Equal(t, "0x1", transactions[0].Hash, "Record of the common ancestor should be kept")
+	assert.Equal(t, "0x4", transactions[1].Hash, "Record of the new branch should be indexed")
+	assert.Equal(t, 9, parser.nextBlock, "Indexer should continue from the new head")
 
-	parser := NewEthParser(client, storage, log)
+	event := <-events
+	for event.Type != interfaces.EventReorg {
+		event = <-events
+	}
+	assert.Equal(t, 3, event.Reorg.FromBlock, "Reorg should start after the common ancestor")
+	assert.Equal(t, 6, event.Reorg.ToBlock, "Reorg should end at the last indexed block")
+	assert.Equal(t, 4, event.Reorg.Depth, "Reorg depth should cover the untracked blocks")
+	assert.Equal(t, []string{"0xtestaddress"}, event.Reorg.Addresses, "Reorg should report affected addresses")
+}
 
-	// Test recording a transaction
-	parser.recordTransaction("0x1")
-	assert.True(t, parser.isRecorded("0x1"), "Transaction should be recorded")
+// Test that transaction status follows the confirmation depth and the finalized block
+func TestGetTransactions_Status(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"})
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x3", From: "0xfrom2", To: "0xtestaddress", Value: "0x12c"})
+	chain.addBlock(4, "a")
+	chain.finalized = 1
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Confirmations: 2})
+	parser.Subscribe("0xtestaddress")
+	parser.nextBlock = 1
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 3, "Should return 3 transactions")
+	assert.Equal(t, 1, transactions[0].BlockNumber, "Block number should be recorded")
+	assert.Equal(t, interfaces.StatusFinalized, transactions[0].Status, "Transaction in a finalized block should be finalized")
+	assert.Equal(t, interfaces.StatusConfirmed, transactions[1].Status, "Transaction with 2 blocks on top should be confirmed")
+	assert.Equal(t, interfaces.StatusUnconfirmed, transactions[2].Status, "Transaction with 1 block on top should be unconfirmed")
 
-	// Test that a new transaction is not recorded
-	assert.False(t, parser.isRecorded("0x2"), "New transaction should not be recorded yet")
+	// Status is computed on read and never written back to storage
+	assert.Empty(t, mockStorage.GetTransactions("0xtestaddress")[0].Status, "Stored transaction should not carry a status")
+}
+
+// confirmations drains the confirmation events published so far
+func confirmations(events <-chan interfaces.Event) []*interfaces.ConfirmationEvent {
+	var confirmations []*interfaces.ConfirmationEvent
+	for {
+		select {
+		case event := <-events:
+			if event.Confirmation != nil {
+				confirmations = append(confirmations, event.Confirmation)
+			}
+		default:
+			return confirmations
+		}
+	}
+}
+
+// Test that a confirmation event is published whenever a block's records reach a new status
+func TestPoll_Confirmations(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	chain.addBlock(2, "a",
+		rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x1"},
+		rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xother", Value: "0x1"},
+	)
+	chain.addTransfer(2, "0x2", "0xtoken", "0xtestaddress", "0xother", 5)
+	chain.finalized = 1
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Confirmations: 2, Start: config.StartBlock, StartBlock: 2})
+	parser.Subscribe("0xtestaddress")
+	parser.Subscribe("0xother")
+	events, cancel := parser.SubscribeEvents(64)
+	defer cancel()
+	parser.poll(context.Background())
+	assert.Empty(t, confirmations(events), "Unconfirmed records should not be announced")
+
+	// Two blocks on top confirm the block's records, announced once per address
+	chain.addBlock(3, "a")
+	chain.addBlock(4, "a")
+	parser.poll(context.Background())
+	confirmed := confirmations(events)
+	assert.Len(t, confirmed, 2, "Should announce the block once per address")
+	assert.Equal(t, interfaces.StatusConfirmed, confirmed[0].Status, "Records should be confirmed")
+	assert.Equal(t, "0xtestaddress", confirmed[0].Address, "Event should name the address")
+	assert.Equal(t, "0xa2", confirmed[0].BlockHash, "Event should name the block")
+	assert.Equal(t, []string{"0x1", "0x2"}, confirmed[0].Hashes, "Each transaction should be listed once")
+	assert.Equal(t, []string{"0x2"}, confirmed[1].Hashes, "The other address should get its own transactions")
+
+	chain.addBlock(5, "a")
+	parser.poll(context.Background())
+	assert.Empty(t, confirmations(events), "Unchanged status should not be announced again")
+
+	chain.finalized = 2
+	chain.addBlock(6, "a")
+	parser.poll(context.Background())
+	finalized := confirmations(events)
+	assert.Len(t, finalized, 2, "Finalization should be announced")
+	assert.Equal(t, interfaces.StatusFinalized, finalized[0].Status, "Records should be finalized")
+	assert.Empty(t, parser.settling, "Finalized blocks should no longer be followed")
+}
+
+// mockFailingRPCClient is a mock rpc.Client whose node cannot be reached
+type mockFailingRPCClient struct {
+	mockRPCClient
+}
+
+func (m *mockFailingRPCClient) FetchCurrentBlock(ctx context.Context) (int, error) {
+	return 0, fmt.Errorf("connection refused")
+}
+
+// Test the configured start modes
+func TestNewEthParser_Start(t *testing.T) {
+	log := logger.GetLogger("debug")
+	client := &mockRPCClient{}
+
+	// Resume without a checkpoint starts from the head
+	mockStorage := storage.NewMemoryStorage()
+	parser := NewEthParser(client, mockStorage, log, config.ParserConfig{Start: config.StartResume})
+	assert.Equal(t, 10, parser.nextBlock, "Should start from the head without a checkpoint")
+
+	// Resume continues after the checkpoint
+	mockStorage.SaveCheckpoint(interfaces.Checkpoint{BlockNumber: 5, BlockHash: "0x5"})
+	parser = NewEthParser(client, mockStorage, log, config.ParserConfig{Start: config.StartResume})
+	assert.Equal(t, 6, parser.nextBlock, "Should resume after the checkpoint")
+	assert.Equal(t, "0x5", parser.lastIndexed().hash, "Checkpoint should seed reorg detection")
+
+	// Head ignores the checkpoint
+	parser = NewEthParser(client, mockStorage, log, config.ParserConfig{Start: config.StartHead})
+	assert.Equal(t, 10, parser.nextBlock, "Should start from the head")
+
+	// Block starts from the configured block
+	parser = NewEthParser(client, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 3})
+	assert.Equal(t, 3, parser.nextBlock, "Should start from the configured block")
+
+	// An unreachable node defers the head lookup instead of starting from genesis
+	parser = NewEthParser(&mockFailingRPCClient{}, storage.NewMemoryStorage(), log, config.ParserConfig{Start: config.StartHead})
+	assert.Equal(t, unknownBlock, parser.nextBlock, "Should wait for the head instead of starting from block 0")
+}
+
+// Test that the checkpoint follows indexing and reorgs
+func TestPoll_Checkpoint(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	chain.addBlock(2, "a")
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	checkpoint, ok := mockStorage.GetCheckpoint()
+	assert.True(t, ok, "Checkpoint should be saved")
+	assert.Equal(t, 3, checkpoint.BlockNumber, "Checkpoint should be the last indexed block")
+	assert.Equal(t, "0xa3", checkpoint.BlockHash, "Checkpoint should record the block hash")
+	assert.Equal(t, []interfaces.CheckpointRecord{{Address: "0xtestaddress", Hash: "0x1"}}, checkpoint.Records, "Checkpoint should record the block's records")
+
+	// A restarted parser detects a reorg that happened while it was down
+	chain.addBlock(3, "b")
+	chain.addBlock(4, "b")
+	restarted := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartResume})
+	assert.Equal(t, 4, restarted.nextBlock, "Should resume after the checkpoint")
+	restarted.poll(context.Background())
+
+	checkpoint, _ = mockStorage.GetCheckpoint()
+	assert.Equal(t, 4, checkpoint.BlockNumber, "Checkpoint should advance to the new head")
+	assert.Equal(t, "0xb4", checkpoint.BlockHash, "Checkpoint should follow the canonical chain")
+	assert.Len(t, mockStorage.GetTransactions("0xtestaddress"), 0, "Records of the orphaned checkpoint block should be removed")
+}
+
+// mockFlakyChain is a mockChain that fails to serve one block until it is healed
+type mockFlakyChain struct {
+	*mockChain
+	failBlock atomic.Int64 // Read by fetch workers that may outlive the poll
+}
+
+func (c *mockFlakyChain) FetchBlockByNumber(ctx context.Context, blockNumber int) (*rpc.Block, error) {
+	if int64(blockNumber) == c.failBlock.Load() {
+		return nil, fmt.Errorf("block %d unavailable", blockNumber)
+	}
+	return c.mockChain.FetchBlockByNumber(ctx, blockNumber)
+}
+
+// Test that the indexer never advances past a block it failed to fetch
+func TestPoll_FetchError(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockFlakyChain{mockChain: newMockChain()}
+	chain.failBlock.Store(2)
+	chain.addBlock(1, "a")
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"})
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	assert.Equal(t, 2, parser.nextBlock, "Indexer should stop at the block it failed to fetch")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 0, "Blocks after the failed one should not be indexed")
+	checkpoint, _ := mockStorage.GetCheckpoint()
+	assert.Equal(t, 1, checkpoint.BlockNumber, "Checkpoint should stay before the failed block")
+
+	// Once the node serves the block again, indexing continues from it
+	chain.failBlock.Store(0)
+	parser.poll(context.Background())
+	assert.Equal(t, 4, parser.nextBlock, "Indexer should catch up to the head")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 2, "Should index the previously failed block")
+}
+
+// mockHeadSubscriber is a mock rpc.HeadSubscriber forwarding heads pushed by the test
+type mockHeadSubscriber struct {
+	heads chan *rpc.Block
+}
+
+func (m *mockHeadSubscriber) SubscribeNewHeads(ctx context.Context, heads chan<- *rpc.Block) {
+	for {
+		select {
+		case head := <-m.heads:
+			heads <- head
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Test that a pushed head fetches every block missed since the last indexed one
+func TestHandleHead_Gap(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	chain.addBlock(2, "a")
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+	assert.Equal(t, 3, parser.nextBlock, "All blocks up to the head should be indexed")
+
+	// Heads 3 and 4 were missed, e.g. while the subscription was reconnecting
+	chain.addBlock(3, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	chain.addBlock(4, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0xc8"})
+	chain.addBlock(5, "a")
+	parser.handleHead(context.Background(), chain.blocks[5])
+
+	assert.Equal(t, 6, parser.nextBlock, "Indexer should catch up to the pushed head")
+	assert.Equal(t, 5, parser.getCurrentBlock(), "Current block should follow the pushed head")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 2, "Transactions in missed blocks should be indexed")
+}
+
+// Test that the indexer reacts to pushed heads without waiting for the poll interval
+func TestRun_HeadSubscriber(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a")
+	mockStorage := storage.NewMemoryStorage()
+	subscriber := &mockHeadSubscriber{heads: make(chan *rpc.Block)}
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{}).WithHeadSubscriber(subscriber)
+	parser.Subscribe("0xtestaddress")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go parser.Run(ctx, time.Hour)
+	assert.Eventually(t, func() bool {
+		checkpoint, ok := mockStorage.GetCheckpoint()
+		return ok && checkpoint.BlockNumber == 1
+	}, time.Second, time.Millisecond, "Indexer should poll once on start")
+
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x1", From: "0xfrom1", To: "0xtestaddress", Value: "0x64"})
+	subscriber.heads <- chain.blocks[2]
+	assert.Eventually(t, func() bool {
+		return len(mockStorage.GetTransactions("0xtestaddress")) == 1
+	}, time.Second, time.Millisecond, "Pushed head should be indexed right away")
+}
+
+// Test that indexed transactions carry the full typed transaction and block context
+func TestPoll_TransactionFields(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a", rpc.Transaction{
+		Hash: "0x1", From: "0xfrom1", To: "0xTestAddress", Value: "0xde0b6b3a7640000",
+		TransactionIndex: "0x2", Nonce: "0x5", Gas: "0x5208", GasPrice: "0x3b9aca00",
+		MaxFeePerGas: "0x77359400", MaxPriorityFeePerGas: "0x3b9aca00", Type: "0x2", ChainID: "0x1", Input: "0x",
+	})
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "Should return 1 transaction")
+	tx := transactions[0]
+	assert.Equal(t, "0xtestaddress", tx.To, "Address should be normalized")
+	assert.Equal(t, "1000000000000000000", tx.Value.String(), "Value should be decoded to wei")
+	assert.Equal(t, 1, tx.BlockNumber, "Block number should be recorded")
+	assert.Equal(t, "0xa1", tx.BlockHash, "Block hash should be recorded")
+	assert.Equal(t, int64(12), tx.Timestamp, "Timestamp should come from the block")
+	assert.Equal(t, 2, tx.TransactionIndex, "Transaction index should be decoded")
+	assert.Equal(t, uint64(5), tx.Nonce, "Nonce should be decoded")
+	assert.Equal(t, uint64(21000), tx.Gas, "Gas should be decoded")
+	assert.Equal(t, 2, tx.Type, "Type should be decoded")
+	assert.Equal(t, "2000000000", tx.MaxFeePerGas.String(), "Max fee should be decoded")
+	assert.True(t, tx.Incoming, "Transaction should be incoming")
+}
+
+// mockBlockReceiptsChain is a mockChain that also serves all receipts of a block in one call
+type mockBlockReceiptsChain struct {
+	*mockChain
+	unsupported   bool
+	blockRequests atomic.Int32
+}
+
+func (c *mockBlockReceiptsChain) FetchBlockReceipts(ctx context.Context, blockNumber int) ([]*rpc.Receipt, error) {
+	c.blockRequests.Add(1)
+	if c.unsupported {
+		return nil, rpc.ErrBlockReceiptsUnsupported
+	}
+	block, ok := c.blocks[blockNumber]
+	if !ok || blockNumber > c.head {
+		return nil, nil
+	}
+	receipts := make([]*rpc.Receipt, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		receipts[i] = c.receipt(block, tx)
+	}
+	return receipts, nil
+}
+
+// Test that matched transactions are stored with the outcome from their receipts
+func TestPoll_Receipts(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a",
+		rpc.Transaction{Hash: "0x1", From: "0xtestaddress", To: "0xto1", Value: "0x1"},
+		rpc.Transaction{Hash: "0x2", From: "0xfrom1", To: "0xother", Value: "0x1"},
+	)
+	chain.reverted["0x1"] = true
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "Should return 1 transaction")
+	assert.Equal(t, interfaces.ReceiptFailed, transactions[0].ReceiptStatus, "Reverted transaction should be marked failed")
+	assert.Equal(t, uint64(21000), transactions[0].GasUsed, "Gas used should come from the receipt")
+	assert.Equal(t, "1000000000", transactions[0].EffectiveGasPrice.String(), "Effective gas price should come from the receipt")
+	assert.Equal(t, "21000000000000", transactions[0].Fee.String(), "Fee should be gas used times effective gas price")
+	assert.Equal(t, int32(1), chain.receipts.Load(), "Should only fetch receipts of matched transactions")
+}
+
+// Test that a block is retried instead of stored when a receipt is not available yet
+func TestPoll_ReceiptMissing(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a", rpc.Transaction{Hash: "0x1", From: "0xtestaddress", To: "0xto1", Value: "0x1"})
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+
+	// The receipt lookup only sees the canonical chain up to the head
+	chain.head = 0
+	parser.indexRange(context.Background(), 1, 1)
+	assert.Empty(t, parser.GetTransactions("0xtestaddress"), "Nothing should be stored without a receipt")
+	assert.Equal(t, 1, parser.getNextBlock(), "The block should be retried")
+
+	chain.head = 1
+	parser.poll(context.Background())
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 1, "The block should be indexed once its receipt is available")
+}
+
+// Test that receipts are fetched per block when supported and one by one otherwise
+func TestPoll_BlockReceipts(t *testing.T) {
+	log := logger.GetLogger("debug")
+	for _, unsupported := range []bool{false, true} {
+		chain := &mockBlockReceiptsChain{mockChain: newMockChain(), unsupported: unsupported}
+		chain.addBlock(1, "a",
+			rpc.Transaction{Hash: "0x1", From: "0xtestaddress", To: "0xto1", Value: "0x1"},
+			rpc.Transaction{Hash: "0x2", From: "0xfrom1", To: "0xtestaddress", Value: "0x1"},
+		)
+		chain.addBlock(2, "a",
+			rpc.Transaction{Hash: "0x3", From: "0xtestaddress", To: "0xto1", Value: "0x1"},
+			rpc.Transaction{Hash: "0x4", From: "0xtestaddress", To: "0xto2", Value: "0x1"},
+		)
+		mockStorage := storage.NewMemoryStorage()
+
+		parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+		parser.Subscribe("0xtestaddress")
+		parser.poll(context.Background())
+
+		transactions := parser.GetTransactions("0xtestaddress")
+		assert.Len(t, transactions, 4, "Should return every transaction")
+		for _, tx := range transactions {
+			assert.Equal(t, interfaces.ReceiptSuccess, tx.ReceiptStatus, "Every transaction should have a receipt")
+		}
+		if unsupported {
+			assert.Equal(t, int32(1), chain.blockRequests.Load(), "Should stop asking for block receipts once unsupported")
+			assert.Equal(t, int32(4), chain.receipts.Load(), "Should fall back to one receipt request per transaction")
+		} else {
+			assert.Equal(t, int32(2), chain.blockRequests.Load(), "Should fetch receipts once per block")
+			assert.Equal(t, int32(0), chain.receipts.Load(), "Should not fetch receipts one by one")
+		}
+	}
+}
+
+// Test that ERC-20 transfers involving subscribed addresses are stored with their token metadata
+func TestPoll_TokenTransfers(t *testing.T) {
+	// Topics carry 20 byte addresses, so the placeholders used elsewhere do not round-trip
+	holder := "0x" + strings.Repeat("1", 40)
+	sender := "0x" + strings.Repeat("2", 40)
+	other := "0x" + strings.Repeat("3", 40)
+	token := "0x" + strings.Repeat("a", 40)
+
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a", rpc.Transaction{Hash: "0x1", From: sender, To: token, Value: "0x0"})
+	chain.addTransfer(1, "0x1", token, sender, holder, 1500000)
+	chain.addTransfer(1, "0x1", token, sender, other, 1)
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x2", From: holder, To: token, Value: "0x0"})
+	chain.addTransfer(2, "0x2", token, holder, other, 500000)
+	chain.tokens[token] = [2]string{
+		"0x4d4b520000000000000000000000000000000000000000000000000000000000", // bytes32 "MKR"
+		fmt.Sprintf("0x%064x", 6),
+	}
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe(holder)
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions(holder)
+	assert.Len(t, transactions, 3, "Should store both token transfers and the outgoing call")
+
+	received := transactions[0]
+	assert.Equal(t, interfaces.KindERC20, received.Kind, "Transfer should be an ERC-20 transfer")
+	assert.True(t, received.Incoming, "Received tokens should be incoming")
+	assert.Equal(t, token, received.Token.Contract, "Token contract should be recorded")
+	assert.Equal(t, "1500000", received.Token.Amount.String(), "Amount should be recorded in base units")
+	assert.Equal(t, "MKR", received.Token.Symbol, "Symbol should be resolved")
+	assert.Equal(t, 6, *received.Token.Decimals, "Decimals should be resolved")
+	assert.Equal(t, int64(12), received.Timestamp, "Timestamp should come from the block")
+
+	kinds := []string{transactions[1].Kind, transactions[2].Kind}
+	assert.ElementsMatch(t, []string{interfaces.KindNative, interfaces.KindERC20}, kinds, "Should store the call and the sent tokens")
+	assert.Equal(t, int32(2), chain.calls.Load(), "Token metadata should be fetched once and cached")
+}
+
+// Test that NFT transfers involving subscribed addresses are stored with their ids and quantities
+func TestPoll_NFTTransfers(t *testing.T) {
+	holder := "0x" + strings.Repeat("1", 40)
+	sender := "0x" + strings.Repeat("2", 40)
+	operator := "0x" + strings.Repeat("3", 40)
+	collection := "0x" + strings.Repeat("c", 40)
+
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a", rpc.Transaction{Hash: "0x1", From: sender, To: collection, Value: "0x0"})
+	chain.addLog(1, "0x1", collection, "0x", rpc.TransferTopic, addressTopic(sender), addressTopic(holder), fmt.Sprintf("0x%064x", 42))
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x2", From: operator, To: collection, Value: "0x0"})
+	chain.addLog(2, "0x2", collection, fmt.Sprintf("0x%064x%064x", 7, 5), rpc.TransferSingleTopic, addressTopic(operator), addressTopic(holder), addressTopic(sender))
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe(holder)
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions(holder)
+	assert.Len(t, transactions, 2, "Should store both NFT transfers")
+
+	assert.Equal(t, interfaces.KindERC721, transactions[0].Kind, "First transfer should be an ERC-721 transfer")
+	assert.True(t, transactions[0].Incoming, "Received NFT should be incoming")
+	assert.Equal(t, collection, transactions[0].Token.Contract, "Collection should be recorded")
+	assert.Equal(t, "42", transactions[0].Token.TokenIDs[0].String(), "Token id should be recorded")
+	assert.Nil(t, transactions[0].Token.Decimals, "NFTs have no decimals")
+
+	assert.Equal(t, interfaces.KindERC1155, transactions[1].Kind, "Second transfer should be an ERC-1155 transfer")
+	assert.False(t, transactions[1].Incoming, "Sent NFT should be outgoing")
+	assert.Equal(t, operator, transactions[1].Token.Operator, "Operator should be recorded")
+	assert.Equal(t, "5", transactions[1].Token.Quantities[0].String(), "Quantity should be recorded")
+}
+
+// mockTraceChain is a mockChain that also serves callTracer results for its blocks
+type mockTraceChain struct {
+	*mockChain
+	traces      map[string]*rpc.CallFrame // Call tree by transaction hash
+	unsupported bool
+	requests    atomic.Int32
+}
+
+func (c *mockTraceChain) DebugTraceBlock(ctx context.Context, blockNumber int) ([]rpc.CallTrace, error) {
+	c.requests.Add(1)
+	if c.unsupported {
+		return nil, rpc.ErrTracingUnsupported
+	}
+	block := c.blocks[blockNumber]
+	traces := make([]rpc.CallTrace, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		traces[i] = rpc.CallTrace{TxHash: tx.Hash, Result: c.traces[tx.Hash]}
+	}
+	return traces, nil
+}
+
+func (c *mockTraceChain) TraceBlock(ctx context.Context, blockNumber int) ([]rpc.ParityTrace, error) {
+	return nil, rpc.ErrTracingUnsupported
+}
+
+// Test that internal transfers involving subscribed addresses are stored with their trace path
+func TestPoll_InternalTransfers(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockTraceChain{mockChain: newMockChain(), traces: make(map[string]*rpc.CallFrame)}
+	chain.addBlock(1, "a",
+		rpc.Transaction{Hash: "0x1", From: "0xsender", To: "0xcontract", Value: "0x0"},
+		rpc.Transaction{Hash: "0x2", From: "0xsender", To: "0xcontract", Value: "0x0"},
+	)
+	chain.traces["0x1"] = &rpc.CallFrame{Type: "CALL", From: "0xsender", To: "0xcontract", Value: "0x0", Calls: []rpc.CallFrame{
+		{Type: "STATICCALL", From: "0xcontract", To: "0xoracle"},
+		{Type: "CALL", From: "0xcontract", To: "0xtestaddress", Value: "0x64"},
+	}}
+	chain.traces["0x2"] = &rpc.CallFrame{Type: "CALL", From: "0xsender", To: "0xcontract", Value: "0x0", Calls: []rpc.CallFrame{
+		{Type: "CALL", From: "0xcontract", To: "0xother", Value: "0x1"},
+	}}
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1, Traces: config.TracesDebug})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "Should store the internal transfer to the subscribed address")
+	tx := transactions[0]
+	assert.Equal(t, interfaces.KindInternal, tx.Kind, "Transfer should be an internal transfer")
+	assert.Equal(t, "0x1", tx.Hash, "Internal transfer should carry its parent transaction hash")
+	assert.Equal(t, []int{1}, tx.TracePath, "Trace path should locate the call")
+	assert.Equal(t, "call", tx.CallType, "Call type should be recorded")
+	assert.Equal(t, "100", tx.Value.String(), "Value should be recorded")
+	assert.True(t, tx.Incoming, "Received ether should be incoming")
+	assert.Equal(t, int32(0), chain.receipts.Load(), "Internal transfers should not need receipts")
+}
+
+// Test that indexing carries on without internal transfers when the node cannot trace
+func TestPoll_TracingUnsupported(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockTraceChain{mockChain: newMockChain(), unsupported: true}
+	chain.addBlock(1, "a", rpc.Transaction{Hash: "0x1", From: "0xtestaddress", To: "0xto1", Value: "0x1"})
+	chain.addBlock(2, "a", rpc.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xto1", Value: "0x1"})
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1, Traces: config.TracesDebug})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 2, "Blocks should still be indexed")
+	assert.Equal(t, int32(1), chain.requests.Load(), "Should stop tracing once unsupported")
+}
+
+// Test that deployments by a subscribed deployer are stored with the created contract address
+func TestPoll_ContractCreation(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := newMockChain()
+	chain.addBlock(1, "a",
+		rpc.Transaction{Hash: "0x1", From: "0xtestaddress", Value: "0x0", Input: "0x6080"},
+		rpc.Transaction{Hash: "0x2", From: "0xother", Value: "0x0", Input: "0x6080"},
+	)
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	assert.False(t, parser.Subscribe(""), "An empty address should not be subscribable")
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "Should only store the subscribed deployer's deployment")
+	assert.Equal(t, interfaces.KindDeployment, transactions[0].Kind, "Transaction should be a deployment")
+	assert.False(t, transactions[0].Incoming, "Deployments are outgoing for the deployer")
+	assert.Equal(t, "0xcontract1", transactions[0].ContractAddress, "Contract address should come from the receipt")
+	assert.Equal(t, int32(1), chain.receipts.Load(), "Should only fetch the receipt of the matched deployment")
 }
@@ -0,0 +1,327 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+	"tx-parser/utils"
+)
+
+// mempool tracks the pending transactions stored for subscribed addresses until they are mined,
+// replaced or dropped
+type mempool struct {
+	mu     sync.Mutex
+	txs    map[string]*pendingTx // Tracked pending transactions by hash
+	nonces map[string]string     // Hash of the tracked transaction by sender and nonce
+	mined  map[string]*minedTx   // Recently mined matching transactions by hash
+}
+
+// minedTx is a mined transaction of a subscribed address, remembered until a reorg can no longer
+// orphan its block
+type minedTx struct {
+	number  int
+	pending *pendingTx // Set when it was tracked while pending, so a reorg can make it pending again
+}
+
+// pendingTx is a pending transaction and the subscribed addresses it was stored for
+type pendingTx struct {
+	tx        interfaces.Transaction
+	addresses []string
+	checked   time.Time // When the transaction was last known to the node
+}
+
+func newMempool() *mempool {
+	return &mempool{
+		txs:    make(map[string]*pendingTx),
+		nonces: make(map[string]string),
+		mined:  make(map[string]*minedTx),
+	}
+}
+
+// nonceKey identifies the transactions competing for a sender's nonce
+func nonceKey(from string, nonce uint64) string {
+	return fmt.Sprintf("%s:%d", from, nonce)
+}
+
+// WithPendingSubscriber records pending transactions of subscribed addresses as soon as the
+// subscriber pushes them. Pending transactions the node no longer knows after timeout are dropped.
+func (p *EthParser) WithPendingSubscriber(pending rpc.PendingSubscriber, timeout time.Duration) *EthParser {
+	if timeout <= 0 {
+		timeout = DefaultPendingTimeout
+	}
+	p.pending = pending
+	p.pendingTimeout = timeout
+	return p
+}
+
+// watchMempool records pushed pending transactions and checks for dropped ones until ctx is cancelled
+func (p *EthParser) watchMempool(ctx context.Context) {
+	txs := make(chan rpc.PendingTransaction, pendingBuffer)
+	go p.pending.SubscribePendingTransactions(ctx, txs)
+
+	ticker := time.NewTicker(p.pendingTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pending := <-txs:
+			// Handle the announcements queued meanwhile too, so their hashes are looked up together
+			announced := []rpc.PendingTransaction{pending}
+		queued:
+			for len(announced) < pendingLookupBatch {
+				select {
+				case pending := <-txs:
+					announced = append(announced, pending)
+				default:
+					break queued
+				}
+			}
+			p.handlePending(ctx, announced...)
+		case <-ticker.C:
+			p.sweepPending(ctx)
+		}
+	}
+}
+
+// handlePending stores announced pending transactions for the subscribed addresses they involve,
+// looking up the ones announced by hash only. A pending transaction reusing the nonce of a tracked
+// one replaces it.
+func (p *EthParser) handlePending(ctx context.Context, announced ...rpc.PendingTransaction) {
+	var hashes []string
+	for _, pending := range announced {
+		if pending.Transaction == nil {
+			hashes = append(hashes, pending.Hash)
+		}
+	}
+	results, _ := p.fetchPending(ctx, hashes)
+	fetched := make(map[string]*rpc.Transaction, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			p.log.Debug.Printf("Error fetching pending transaction %s: %v", hashes[i], result.Err)
+			continue
+		}
+		fetched[hashes[i]] = result.Transaction
+	}
+
+	for _, pending := range announced {
+		raw := pending.Transaction
+		if raw == nil {
+			raw = fetched[pending.Hash]
+		}
+		if raw != nil {
+			p.recordPending(raw)
+		}
+	}
+}
+
+// fetchPending looks up transactions by hash, with a single batch request when the node supports
+// it. It returns false when the client cannot look up transactions at all.
+func (p *EthParser) fetchPending(ctx context.Context, hashes []string) ([]rpc.TransactionResult, bool) {
+	fetcher, ok := p.rpcClient.(rpc.TransactionFetcher)
+	if !ok || len(hashes) == 0 {
+		return nil, ok
+	}
+
+	if batcher, ok := p.rpcClient.(rpc.BatchTransactionFetcher); ok && len(hashes) > 1 && p.batchSize > 1 && !p.batchUnsupported.Load() {
+		results, err := batcher.FetchTransactionsByHash(ctx, hashes)
+		switch {
+		case err == nil:
+			return results, true
+		case errors.Is(err, rpc.ErrBatchUnsupported):
+			p.batchUnsupported.Store(true)
+			p.log.Warn.Println("Node does not support batch requests, falling back to single requests")
+		default:
+			results = make([]rpc.TransactionResult, len(hashes))
+			for i := range results {
+				results[i].Err = err
+			}
+			return results, true
+		}
+	}
+
+	results := make([]rpc.TransactionResult, len(hashes))
+	for i, hash := range hashes {
+		results[i].Transaction, results[i].Err = fetcher.FetchTransactionByHash(ctx, hash)
+	}
+	return results, true
+}
+
+// recordPending stores a pending transaction for the subscribed addresses it involves
+func (p *EthParser) recordPending(raw *rpc.Transaction) {
+	if raw.BlockHash != "" {
+		// Mined before it could be looked up, the indexer records it
+		return
+	}
+
+	addresses := p.involved(utils.NormalizeAddress(raw.From), utils.NormalizeAddress(raw.To))
+	if len(addresses) == 0 {
+		return
+	}
+	tx, err := rpc.ParseTransaction(*raw)
+	if err != nil {
+		p.log.Error.Printf("Skipping pending transaction: %v", err)
+		return
+	}
+	tx.Status = interfaces.StatusPending
+
+	p.mempool.mu.Lock()
+	defer p.mempool.mu.Unlock()
+	if _, ok := p.mempool.mined[tx.Hash]; ok {
+		return
+	}
+	if _, ok := p.mempool.txs[tx.Hash]; ok {
+		return
+	}
+
+	key := nonceKey(tx.From, tx.Nonce)
+	if previous, ok := p.mempool.txs[p.mempool.nonces[key]]; ok {
+		p.replacePending(previous, tx.Hash)
+	}
+	p.mempool.txs[tx.Hash] = &pendingTx{tx: tx, addresses: addresses, checked: time.Now()}
+	p.mempool.nonces[key] = tx.Hash
+	for _, address := range addresses {
+		p.storeRecord(address, tx)
+	}
+	p.log.Debug.Printf("Recorded pending transaction %s", tx.Hash)
+}
+
+// replacePending marks a tracked transaction as replaced by another one with the same nonce. The
+// caller must hold the mempool lock.
+func (p *EthParser) replacePending(previous *pendingTx, hash string) {
+	p.untrackPending(previous)
+	previous.tx.Status = interfaces.StatusReplaced
+	previous.tx.ReplacedBy = hash
+	for _, address := range previous.addresses {
+		p.storeRecord(address, previous.tx)
+	}
+	p.log.Debug.Printf("Pending transaction %s was replaced by %s", previous.tx.Hash, hash)
+}
+
+// untrackPending stops tracking a pending transaction. The caller must hold the mempool lock.
+func (p *EthParser) untrackPending(pending *pendingTx) {
+	delete(p.mempool.txs, pending.tx.Hash)
+	key := nonceKey(pending.tx.From, pending.tx.Nonce)
+	if p.mempool.nonces[key] == pending.tx.Hash {
+		delete(p.mempool.nonces, key)
+	}
+}
+
+// reconcileMined stops tracking the pending transactions mined in a block, and marks those whose
+// nonce was used by another mined transaction as replaced. matched lists the hashes of the block's
+// transactions stored for subscribed addresses, whose late pending announcements are then ignored.
+func (p *EthParser) reconcileMined(number int, block *rpc.Block, matched []string) {
+	p.mempool.mu.Lock()
+	defer p.mempool.mu.Unlock()
+
+	for _, hash := range matched {
+		// Records without a transaction hash, such as withdrawals, were never pending
+		if hash != "" {
+			p.mempool.mined[hash] = &minedTx{number: number}
+		}
+	}
+	for hash, mined := range p.mempool.mined {
+		if mined.number <= number-p.reorgDepth {
+			delete(p.mempool.mined, hash)
+		}
+	}
+
+	if len(p.mempool.txs) == 0 {
+		return
+	}
+	for _, raw := range block.Transactions {
+		if pending, ok := p.mempool.txs[raw.Hash]; ok {
+			p.untrackPending(pending)
+			if mined, ok := p.mempool.mined[raw.Hash]; ok {
+				mined.pending = pending
+			}
+			continue
+		}
+		nonce, err := strconv.ParseUint(strings.TrimPrefix(raw.Nonce, "0x"), 16, 64)
+		if err != nil {
+			continue
+		}
+		if pending, ok := p.mempool.txs[p.mempool.nonces[nonceKey(utils.NormalizeAddress(raw.From), nonce)]]; ok {
+			p.replacePending(pending, raw.Hash)
+		}
+	}
+}
+
+// revertMined forgets the transactions mined from block number onwards after a reorg orphaned
+// them. Those that were tracked while pending are tracked and stored as pending again, until they
+// are mined on the new branch or dropped.
+func (p *EthParser) revertMined(number int) {
+	p.mempool.mu.Lock()
+	defer p.mempool.mu.Unlock()
+
+	for hash, mined := range p.mempool.mined {
+		if mined.number < number {
+			continue
+		}
+		delete(p.mempool.mined, hash)
+
+		pending := mined.pending
+		if pending == nil {
+			continue
+		}
+		key := nonceKey(pending.tx.From, pending.tx.Nonce)
+		if _, ok := p.mempool.txs[p.mempool.nonces[key]]; ok {
+			// Another transaction with the same nonce was announced since
+			continue
+		}
+		pending.checked = time.Now()
+		p.mempool.txs[hash] = pending
+		p.mempool.nonces[key] = hash
+		for _, address := range pending.addresses {
+			p.storeRecord(address, pending.tx)
+		}
+		p.log.Debug.Printf("Transaction %s is pending again after a reorg", hash)
+	}
+}
+
+// sweepPending marks tracked transactions as dropped once the node has not known them for the
+// pending timeout
+func (p *EthParser) sweepPending(ctx context.Context) {
+	p.mempool.mu.Lock()
+	var stale []string
+	for hash, pending := range p.mempool.txs {
+		if time.Since(pending.checked) >= p.pendingTimeout {
+			stale = append(stale, hash)
+		}
+	}
+	p.mempool.mu.Unlock()
+
+	results, canFetch := p.fetchPending(ctx, stale)
+	for i, hash := range stale {
+		known := false
+		if canFetch {
+			if results[i].Err != nil {
+				p.log.Debug.Printf("Error checking pending transaction %s: %v", hash, results[i].Err)
+				continue
+			}
+			// A mined transaction is left for the indexer to reconcile
+			known = results[i].Transaction != nil
+		}
+
+		p.mempool.mu.Lock()
+		if pending, ok := p.mempool.txs[hash]; ok {
+			if known {
+				pending.checked = time.Now()
+			} else {
+				p.untrackPending(pending)
+				pending.tx.Status = interfaces.StatusDropped
+				for _, address := range pending.addresses {
+					p.storeRecord(address, pending.tx)
+				}
+				p.log.Debug.Printf("Pending transaction %s was dropped", hash)
+			}
+		}
+		p.mempool.mu.Unlock()
+	}
+}
@@ -0,0 +1,196 @@
+package parser
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+	"tx-parser/internal/storage"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockMempoolChain is a mockChain that also looks up pending transactions by hash
+type mockMempoolChain struct {
+	*mockChain
+	pending map[string]*rpc.Transaction
+	lookups int // Number of single lookups served
+	batches int // Number of batch lookups served
+}
+
+func (c *mockMempoolChain) FetchTransactionByHash(ctx context.Context, txHash string) (*rpc.Transaction, error) {
+	c.lookups++
+	return c.pending[txHash], nil
+}
+
+func (c *mockMempoolChain) FetchTransactionsByHash(ctx context.Context, txHashes []string) ([]rpc.TransactionResult, error) {
+	c.batches++
+	results := make([]rpc.TransactionResult, len(txHashes))
+	for i, hash := range txHashes {
+		results[i].Transaction = c.pending[hash]
+	}
+	return results, nil
+}
+
+// pendingRecord returns the record stored for address with the given hash
+func pendingRecord(t *testing.T, parser *EthParser, address, hash string) interfaces.Transaction {
+	for _, tx := range parser.GetTransactions(address) {
+		if tx.Hash == hash {
+			return tx
+		}
+	}
+	t.Fatalf("No record of %s stored for %s", hash, address)
+	return interfaces.Transaction{}
+}
+
+// Test that pending transactions are recorded and settled once mined or replaced
+func TestMempool_MinedAndReplaced(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockMempoolChain{mockChain: newMockChain(), pending: make(map[string]*rpc.Transaction)}
+	chain.addBlock(1, "a")
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 2})
+	parser.Subscribe("0xtestaddress")
+	events, cancel := parser.SubscribeEvents(16)
+	defer cancel()
+	ctx := context.Background()
+
+	// A transaction announced in full and one announced by hash only
+	parser.handlePending(ctx, rpc.PendingTransaction{Hash: "0x1", Transaction: &rpc.Transaction{Hash: "0x1", From: "0xtestaddress", To: "0xto1", Value: "0x1", Nonce: "0x5"}})
+	chain.pending["0x2"] = &rpc.Transaction{Hash: "0x2", From: "0xfrom1", To: "0xtestaddress", Value: "0x1", Nonce: "0x0"}
+	parser.handlePending(ctx, rpc.PendingTransaction{Hash: "0x2"})
+	parser.handlePending(ctx, rpc.PendingTransaction{Hash: "0x9", Transaction: &rpc.Transaction{Hash: "0x9", From: "0xfrom1", To: "0xto1", Value: "0x1"}})
+
+	transactions := parser.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 2, "Should record pending transactions of subscribed addresses only")
+	for _, tx := range transactions {
+		assert.Equal(t, interfaces.StatusPending, tx.Status, "Transaction should be pending")
+	}
+	event := <-events
+	assert.Equal(t, interfaces.EventTransaction, event.Type, "Pending transaction should be published")
+	assert.Equal(t, interfaces.StatusPending, event.Transaction.Transaction.Status, "Published transaction should be pending")
+
+	// Broadcasting another transaction with the same nonce replaces the first one
+	parser.handlePending(ctx, rpc.PendingTransaction{Hash: "0x3", Transaction: &rpc.Transaction{Hash: "0x3", From: "0xtestaddress", To: "0xtestaddress", Value: "0x0", Nonce: "0x5"}})
+	replaced := pendingRecord(t, parser, "0xtestaddress", "0x1")
+	assert.Equal(t, interfaces.StatusReplaced, replaced.Status, "Transaction with the same nonce should replace the first one")
+	assert.Equal(t, "0x3", replaced.ReplacedBy, "Replacement should be recorded")
+
+	// Mining the replacement settles it, and a transaction using the nonce of 0x2 replaces it
+	chain.addBlock(2, "a",
+		rpc.Transaction{Hash: "0x3", From: "0xtestaddress", To: "0xtestaddress", Value: "0x0", Nonce: "0x5"},
+		rpc.Transaction{Hash: "0x4", From: "0xfrom1", To: "0xto1", Value: "0x0", Nonce: "0x0"},
+	)
+	parser.poll(ctx)
+	mined := pendingRecord(t, parser, "0xtestaddress", "0x3")
+	assert.Equal(t, interfaces.StatusUnconfirmed, mined.Status, "Mined transaction should replace its pending record")
+	assert.Equal(t, 2, mined.BlockNumber, "Mined transaction should carry its block")
+	assert.Equal(t, "0x4", pendingRecord(t, parser, "0xtestaddress", "0x2").ReplacedBy, "Transaction whose nonce was mined by another should be replaced")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 3, "Each transaction should be stored once")
+
+	// A late announcement of a mined transaction does not overwrite it
+	parser.handlePending(ctx, rpc.PendingTransaction{Hash: "0x3", Transaction: &rpc.Transaction{Hash: "0x3", From: "0xtestaddress", To: "0xtestaddress", Value: "0x0", Nonce: "0x5"}})
+	assert.Equal(t, interfaces.StatusUnconfirmed, pendingRecord(t, parser, "0xtestaddress", "0x3").Status, "Mined transaction should stay mined")
+}
+
+// Test that pending transactions the node no longer knows are dropped after the timeout
+func TestMempool_Dropped(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockMempoolChain{mockChain: newMockChain(), pending: make(map[string]*rpc.Transaction)}
+	chain.addBlock(1, "a")
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{}).WithPendingSubscriber(nil, time.Millisecond)
+	parser.Subscribe("0xtestaddress")
+	ctx := context.Background()
+
+	for _, hash := range []string{"0x1", "0x2"} {
+		chain.pending[hash] = &rpc.Transaction{Hash: hash, From: "0xtestaddress", To: "0xto1", Value: "0x1", Nonce: hash}
+		parser.handlePending(ctx, rpc.PendingTransaction{Hash: hash})
+	}
+
+	// The node still knows 0x2
+	delete(chain.pending, "0x1")
+	time.Sleep(2 * time.Millisecond)
+	parser.sweepPending(ctx)
+
+	assert.Equal(t, interfaces.StatusDropped, pendingRecord(t, parser, "0xtestaddress", "0x1").Status, "Unknown transaction should be dropped")
+	assert.Equal(t, interfaces.StatusPending, pendingRecord(t, parser, "0xtestaddress", "0x2").Status, "Known transaction should stay pending")
+}
+
+// Test that transactions announced by hash only are looked up with a single batch request
+func TestMempool_BatchLookup(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockMempoolChain{mockChain: newMockChain(), pending: make(map[string]*rpc.Transaction)}
+	chain.addBlock(1, "a")
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{})
+	parser.Subscribe("0xtestaddress")
+
+	var announced []rpc.PendingTransaction
+	for _, hash := range []string{"0x1", "0x2", "0x3"} {
+		chain.pending[hash] = &rpc.Transaction{Hash: hash, From: "0xtestaddress", To: "0xto1", Value: "0x1", Nonce: hash}
+		announced = append(announced, rpc.PendingTransaction{Hash: hash})
+	}
+	// Announced in full, so it needs no lookup
+	announced = append(announced, rpc.PendingTransaction{Hash: "0x4", Transaction: &rpc.Transaction{Hash: "0x4", From: "0xtestaddress", To: "0xto1", Value: "0x1", Nonce: "0x4"}})
+	parser.handlePending(context.Background(), announced...)
+
+	assert.Equal(t, 1, chain.batches, "Hashes should be looked up with one batch request")
+	assert.Equal(t, 0, chain.lookups, "No hash should be looked up on its own")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 4, "Every announced transaction should be recorded")
+}
+
+// Test that transactions mined in a block orphaned by a reorg are pending again
+func TestMempool_Reorg(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockMempoolChain{mockChain: newMockChain(), pending: make(map[string]*rpc.Transaction)}
+	chain.addBlock(1, "a")
+	mockStorage := storage.NewMemoryStorage()
+
+	parser := NewEthParser(chain, mockStorage, log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	ctx := context.Background()
+	parser.poll(ctx)
+
+	raw := rpc.Transaction{Hash: "0x1", From: "0xtestaddress", To: "0xto1", Value: "0x1", Nonce: "0x5"}
+	parser.handlePending(ctx, rpc.PendingTransaction{Hash: "0x1", Transaction: &raw})
+	chain.addBlock(2, "a", raw)
+	parser.poll(ctx)
+	assert.Equal(t, interfaces.StatusUnconfirmed, pendingRecord(t, parser, "0xtestaddress", "0x1").Status, "Transaction should be mined")
+
+	// The competing branch does not include the transaction yet
+	chain.addBlock(2, "b")
+	chain.addBlock(3, "b")
+	parser.poll(ctx)
+	assert.Equal(t, interfaces.StatusPending, pendingRecord(t, parser, "0xtestaddress", "0x1").Status, "Orphaned transaction should be pending again")
+
+	// It is settled again once mined on the new branch
+	chain.addBlock(4, "b", raw)
+	parser.poll(ctx)
+	mined := pendingRecord(t, parser, "0xtestaddress", "0x1")
+	assert.Equal(t, interfaces.StatusUnconfirmed, mined.Status, "Transaction should be mined again")
+	assert.Equal(t, 4, mined.BlockNumber, "Transaction should carry its new block")
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 1, "Transaction should be stored once")
+}
+
+// Test that records without a transaction hash are not remembered as mined transactions
+func TestMempool_MinedWithdrawal(t *testing.T) {
+	log := logger.GetLogger("debug")
+	chain := &mockMempoolChain{mockChain: newMockChain(), pending: make(map[string]*rpc.Transaction)}
+	chain.addBlock(1, "a", rpc.Transaction{Hash: "0x1", From: "0xtestaddress", To: "0xto1", Value: "0x1"})
+	chain.blocks[1].Withdrawals = []rpc.Withdrawal{{Index: "0x1", ValidatorIndex: "0x10", Address: "0xtestaddress", Amount: "0x1"}}
+
+	parser := NewEthParser(chain, storage.NewMemoryStorage(), log, config.ParserConfig{Start: config.StartBlock, StartBlock: 1})
+	parser.Subscribe("0xtestaddress")
+	parser.poll(context.Background())
+
+	assert.Len(t, parser.GetTransactions("0xtestaddress"), 2, "Should store the transaction and the withdrawal")
+	assert.Contains(t, parser.mempool.mined, "0x1", "Mined transaction should be remembered")
+	assert.NotContains(t, parser.mempool.mined, "", "Withdrawal should not be remembered as a mined transaction")
+}
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"tx-parser/internal/rpc"
+)
+
+// fetchResult is a block fetched by the pipeline together with its token transfer logs and, when
+// tracing, its internal transfers, or the error that prevented fetching them
+type fetchResult struct {
+	number int
+	block  *rpc.Block
+	logs   []rpc.Log
+	traces []rpc.InternalCall
+	err    error
+}
+
+// tokenTopics selects the logs of token transfers
+var tokenTopics = [][]string{rpc.TokenTransferTopics}
+
+// fetchChunk is a run of consecutive blocks fetched by a single worker
+type fetchChunk struct {
+	from int
+	to   int
+}
+
+// fetchRange fetches blocks from..to with up to fetchWorkers concurrent requests and delivers them
+// strictly in block order. The channel is closed after the last block, after the first error (which
+// is delivered), or when ctx is cancelled; callers that stop reading early must cancel ctx.
+func (p *EthParser) fetchRange(ctx context.Context, from, to int) <-chan fetchResult {
+	ctx, cancel := context.WithCancel(ctx)
+
+	out := make(chan fetchResult)
+	jobs := make(chan fetchChunk)
+	results := make(chan fetchResult)
+
+	// Limit how far ahead of the next block to deliver workers may get, bounding buffered blocks
+	window := make(chan struct{}, 2*p.fetchWorkers*p.batchSize)
+
+	// Dispatch chunks in order while there is room in the window
+	go func() {
+		defer close(jobs)
+		for n := from; n <= to; {
+			chunk := fetchChunk{from: n, to: n}
+			if p.canBatch() {
+				chunk.to = n + p.batchSize - 1
+				if chunk.to > to {
+					chunk.to = to
+				}
+			}
+
+			for i := chunk.from; i <= chunk.to; i++ {
+				select {
+				case window <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- chunk:
+			case <-ctx.Done():
+				return
+			}
+			n = chunk.to + 1
+		}
+	}()
+
+	// Fetch chunks concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < p.fetchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				for _, result := range p.fetchChunk(ctx, chunk) {
+					select {
+					case results <- result:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Reorder results and deliver them by block number
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		pending := make(map[int]fetchResult)
+		next := from
+		for result := range results {
+			pending[result.number] = result
+			for {
+				ready, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+
+				select {
+				case out <- ready:
+				case <-ctx.Done():
+					return
+				}
+				<-window
+
+				if ready.err != nil {
+					return
+				}
+				next++
+			}
+		}
+	}()
+
+	return out
+}
+
+// canBatch reports whether chunks of blocks can be fetched with a single batch request
+func (p *EthParser) canBatch() bool {
+	_, ok := p.rpcClient.(rpc.BatchClient)
+	return ok && p.batchSize > 1 && !p.batchUnsupported.Load()
+}
+
+// fetchChunk fetches a chunk of blocks, their token transfer logs and their traces
+func (p *EthParser) fetchChunk(ctx context.Context, chunk fetchChunk) []fetchResult {
+	results := p.fetchBlocks(ctx, chunk)
+	p.fetchLogs(ctx, results)
+	p.fetchTraces(ctx, results)
+	return results
+}
+
+// fetchBlocks fetches a chunk of blocks, batching them when the node supports it
+func (p *EthParser) fetchBlocks(ctx context.Context, chunk fetchChunk) []fetchResult {
+	results := make([]fetchResult, 0, chunk.to-chunk.from+1)
+
+	if chunk.to > chunk.from && p.canBatch() {
+		blocks, err := p.rpcClient.(rpc.BatchClient).FetchBlockRange(ctx, chunk.from, chunk.to)
+		switch {
+		case err == nil:
+			for i, result := range blocks {
+				number := chunk.from + i
+				block, err := result.Block, result.Err
+				if err == nil && block == nil {
+					err = errBlockNotAvailable(number)
+				}
+				results = append(results, fetchResult{number: number, block: block, err: err})
+			}
+			return results
+		case errors.Is(err, rpc.ErrBatchUnsupported):
+			// Remember so later chunks go straight to single requests
+			p.batchUnsupported.Store(true)
+			p.log.Warn.Println("Node does not support batch requests, falling back to single requests")
+		default:
+			for n := chunk.from; n <= chunk.to; n++ {
+				results = append(results, fetchResult{number: n, err: err})
+			}
+			return results
+		}
+	}
+
+	for n := chunk.from; n <= chunk.to; n++ {
+		block, err := p.fetchBlock(ctx, n)
+		results = append(results, fetchResult{number: n, block: block, err: err})
+	}
+	return results
+}
+
+// fetchLogs fetches the token transfer logs of every fetched block, batching them when the node
+// supports it. Logs are selected by block hash, so a node that does not have the block fails
+// instead of returning no logs. A block whose logs cannot be fetched fails like a missing block.
+func (p *EthParser) fetchLogs(ctx context.Context, results []fetchResult) {
+	var fetched []*fetchResult
+	for i := range results {
+		if results[i].err == nil {
+			fetched = append(fetched, &results[i])
+		}
+	}
+
+	if len(fetched) > 1 && p.canBatch() {
+		hashes := make([]string, len(fetched))
+		for i, result := range fetched {
+			hashes[i] = result.block.Hash
+		}
+		logs, err := p.rpcClient.(rpc.BatchClient).FetchBlockLogs(ctx, hashes, tokenTopics)
+		switch {
+		case err == nil:
+			for i, result := range fetched {
+				result.logs, result.err = logs[i].Logs, logs[i].Err
+			}
+			return
+		case errors.Is(err, rpc.ErrBatchUnsupported):
+			p.batchUnsupported.Store(true)
+			p.log.Warn.Println("Node does not support batch requests, falling back to single requests")
+		default:
+			for _, result := range fetched {
+				result.err = err
+			}
+			return
+		}
+	}
+
+	for _, result := range fetched {
+		result.logs, result.err = p.rpcClient.FetchLogs(ctx, rpc.LogFilter{BlockHash: result.block.Hash, Topics: tokenTopics})
+	}
+}
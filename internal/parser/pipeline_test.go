@@ -0,0 +1,251 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/internal/rpc"
+	"tx-parser/internal/storage"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSlowRPCClient is a mock rpc.Client that answers after a random delay and fails for one block
+type mockSlowRPCClient struct {
+	mockRPCClient
+	failBlock int
+}
+
+func (m *mockSlowRPCClient) FetchBlockByNumber(ctx context.Context, blockNumber int) (*rpc.Block, error) {
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+	if blockNumber == m.failBlock {
+		return nil, fmt.Errorf("block %d unavailable", blockNumber)
+	}
+	return &rpc.Block{Number: fmt.Sprintf("0x%x", blockNumber)}, nil
+}
+
+// Test that concurrently fetched blocks are delivered in block order
+func TestFetchRange_Order(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(&mockSlowRPCClient{}, storage.NewMemoryStorage(), log, config.ParserConfig{FetchWorkers: 8})
+
+	var numbers []int
+	for result := range parser.fetchRange(context.Background(), 1, 50) {
+		assert.Nil(t, result.err, "Expected no error when fetching blocks")
+		numbers = append(numbers, result.number)
+	}
+
+	assert.Len(t, numbers, 50, "Should deliver every block in the range")
+	for i, number := range numbers {
+		assert.Equal(t, i+1, number, "Blocks should be delivered in order")
+	}
+}
+
+// Test that the pipeline stops at the first block it fails to fetch
+func TestFetchRange_Error(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(&mockSlowRPCClient{failBlock: 5}, storage.NewMemoryStorage(), log, config.ParserConfig{FetchWorkers: 8})
+
+	var results []fetchResult
+	for result := range parser.fetchRange(context.Background(), 1, 50) {
+		results = append(results, result)
+	}
+
+	assert.Len(t, results, 5, "Should stop after the failed block")
+	assert.Nil(t, results[3].err, "Blocks before the failed one should be delivered")
+	assert.Equal(t, 5, results[4].number, "The failed block should be delivered last")
+	assert.NotNil(t, results[4].err, "The failed block should carry its error")
+}
+
+// Test that a cancelled consumer does not leave the pipeline blocked
+func TestFetchRange_Cancel(t *testing.T) {
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(&mockSlowRPCClient{}, storage.NewMemoryStorage(), log, config.ParserConfig{FetchWorkers: 4})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := parser.fetchRange(ctx, 1, 1000)
+	<-results
+	cancel()
+
+	// The channel is closed shortly after cancellation
+	assert.Eventually(t, func() bool {
+		for range results {
+		}
+		return true
+	}, time.Second, 10*time.Millisecond, "Pipeline should stop after cancellation")
+}
+
+// fakeNode is a JSON-RPC server that answers every block request after a fixed latency
+type fakeNode struct {
+	*httptest.Server
+	batches  bool // Whether batch requests are answered
+	requests int32
+	status   atomic.Int32 // HTTP status every request fails with when set
+}
+
+// newFakeNode starts a fake node, optionally supporting batch requests
+func newFakeNode(latency time.Duration, batches bool) *fakeNode {
+	node := &fakeNode{batches: batches}
+	node.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&node.requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		time.Sleep(latency)
+		if status := node.status.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+
+		if bytes.HasPrefix(body, []byte("[")) {
+			if !node.batches {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch requests are not supported"}}`)
+				return
+			}
+			var reqs []rpc.RequestPayload
+			json.Unmarshal(body, &reqs)
+
+			// Answer in reverse order to exercise matching by id
+			responses := make([]interface{}, 0, len(reqs))
+			for i := len(reqs) - 1; i >= 0; i-- {
+				responses = append(responses, fakeResponse(reqs[i]))
+			}
+			json.NewEncoder(w).Encode(responses)
+			return
+		}
+
+		var req rpc.RequestPayload
+		json.Unmarshal(body, &req)
+		json.NewEncoder(w).Encode(fakeResponse(req))
+	}))
+	return node
+}
+
+// fakeResponse answers eth_blockNumber with a fixed head, block requests with a one-transaction
+// block and log requests with no logs
+func fakeResponse(req rpc.RequestPayload) map[string]interface{} {
+	switch req.Method {
+	case "eth_blockNumber":
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": "0x100000"}
+	case "eth_getLogs":
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": []rpc.Log{}}
+	}
+	number := req.Params[0].(string)
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      req.Id,
+		"result": rpc.Block{
+			Number: number,
+			Hash:   "0xhash" + number,
+			Transactions: []rpc.Transaction{
+				{Hash: "0xtx" + number, From: "0xfrom", To: "0xto", Value: "0x1"},
+			},
+		},
+	}
+}
+
+// Test that the pipeline batches requests when the node supports it
+func TestFetchRange_Batch(t *testing.T) {
+	node := newFakeNode(0, true)
+	defer node.Close()
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(rpc.NewClient(node.URL, log), storage.NewMemoryStorage(), log, config.ParserConfig{FetchWorkers: 2, BatchSize: 10})
+	atomic.StoreInt32(&node.requests, 0)
+
+	var numbers []int
+	for result := range parser.fetchRange(context.Background(), 1, 50) {
+		assert.Nil(t, result.err, "Expected no error when fetching blocks")
+		assert.Equal(t, fmt.Sprintf("0x%x", result.number), result.block.Number, "Block should match its number")
+		numbers = append(numbers, result.number)
+	}
+
+	assert.Len(t, numbers, 50, "Should deliver every block in the range")
+	assert.Equal(t, 1, numbers[0], "Blocks should be delivered in order")
+	assert.Equal(t, 50, numbers[49], "Blocks should be delivered in order")
+	assert.Equal(t, int32(10), atomic.LoadInt32(&node.requests), "Should fetch 10 blocks, then their logs, per request")
+}
+
+// Test that the pipeline falls back to single requests when the node rejects batches
+func TestFetchRange_BatchUnsupported(t *testing.T) {
+	node := newFakeNode(0, false)
+	defer node.Close()
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(rpc.NewClient(node.URL, log), storage.NewMemoryStorage(), log, config.ParserConfig{FetchWorkers: 1, BatchSize: 10})
+
+	var numbers []int
+	for result := range parser.fetchRange(context.Background(), 1, 30) {
+		assert.Nil(t, result.err, "Expected no error when fetching blocks")
+		numbers = append(numbers, result.number)
+	}
+
+	assert.Len(t, numbers, 30, "Should deliver every block in the range")
+	assert.True(t, parser.batchUnsupported.Load(), "Should remember that batches are unsupported")
+	assert.False(t, parser.canBatch(), "Should stop batching")
+}
+
+// Test that a request refused for another reason than batching, such as an expired API key, does
+// not stop batching for good
+func TestFetchRange_BatchForbidden(t *testing.T) {
+	node := newFakeNode(0, true)
+	defer node.Close()
+	log := logger.GetLogger("debug")
+	parser := NewEthParser(rpc.NewClient(node.URL, log), storage.NewMemoryStorage(), log, config.ParserConfig{FetchWorkers: 1, BatchSize: 10})
+
+	for _, status := range []int32{http.StatusUnauthorized, http.StatusForbidden} {
+		node.status.Store(status)
+		for result := range parser.fetchRange(context.Background(), 1, 10) {
+			assert.NotNil(t, result.err, "Expected an error while the node refuses requests")
+		}
+		assert.False(t, parser.batchUnsupported.Load(), "Status %d should not mark batches as unsupported", status)
+	}
+
+	node.status.Store(0)
+	atomic.StoreInt32(&node.requests, 0)
+	for result := range parser.fetchRange(context.Background(), 1, 10) {
+		assert.Nil(t, result.err, "Expected no error once the node accepts requests")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&node.requests), "Should fetch the blocks and their logs with one batch each")
+}
+
+// BenchmarkFetchRange measures block throughput against a fake node with 2ms latency
+func BenchmarkFetchRange(b *testing.B) {
+	benchmarkFetchRange(b, false, 1)
+}
+
+// BenchmarkFetchRange_Batch measures block throughput with 10 blocks per batch request
+func BenchmarkFetchRange_Batch(b *testing.B) {
+	benchmarkFetchRange(b, true, 10)
+}
+
+func benchmarkFetchRange(b *testing.B, batches bool, batchSize int) {
+	const blocks = 100
+	node := newFakeNode(2*time.Millisecond, batches)
+	defer node.Close()
+	log := logger.InitLogger("error")
+	defer logger.InitLogger("debug")
+
+	for _, workers := range []int{1, 2, 4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			client := rpc.NewClient(node.URL, log)
+			parser := NewEthParser(client, storage.NewMemoryStorage(), log, config.ParserConfig{FetchWorkers: workers, BatchSize: batchSize})
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for result := range parser.fetchRange(context.Background(), 1, blocks) {
+					if result.err != nil {
+						b.Fatal("Error fetching block:", result.err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.N*blocks)/b.Elapsed().Seconds(), "blocks/s")
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+)
+
+// addReceipts completes the transactions of a block with the outcome reported by their receipts.
+// It fails unless every transaction gets a receipt from the same block, so the block is retried
+// rather than stored without its outcome.
+func (p *EthParser) addReceipts(ctx context.Context, number int, block *rpc.Block, txs []*interfaces.Transaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	receipts, err := p.fetchReceipts(ctx, number, txs)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		receipt, ok := receipts[tx.Hash]
+		if !ok {
+			return fmt.Errorf("receipt of transaction %s not available yet", tx.Hash)
+		}
+		// A receipt from another block means the chain reorganized while the block was processed
+		if receipt.BlockHash != "" && receipt.BlockHash != block.Hash {
+			return fmt.Errorf("receipt of transaction %s is from block %s instead of %s", tx.Hash, receipt.BlockHash, block.Hash)
+		}
+		if err := rpc.ApplyReceipt(tx, receipt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchReceipts fetches the receipts of the given transactions of a block, keyed by transaction
+// hash. All receipts of the block are fetched in one call when the node supports it and more than
+// one transaction is needed, falling back to one call per transaction otherwise.
+func (p *EthParser) fetchReceipts(ctx context.Context, number int, txs []*interfaces.Transaction) (map[string]*rpc.Receipt, error) {
+	receipts := make(map[string]*rpc.Receipt, len(txs))
+
+	if client, ok := p.rpcClient.(rpc.BlockReceiptsClient); ok && len(txs) > 1 && !p.blockReceiptsUnsupported.Load() {
+		blockReceipts, err := client.FetchBlockReceipts(ctx, number)
+		switch {
+		case errors.Is(err, rpc.ErrBlockReceiptsUnsupported):
+			p.log.Warn.Printf("Node does not support eth_getBlockReceipts, fetching receipts one by one")
+			p.blockReceiptsUnsupported.Store(true)
+		case err != nil:
+			return nil, err
+		default:
+			for _, receipt := range blockReceipts {
+				if receipt != nil {
+					receipts[receipt.TransactionHash] = receipt
+				}
+			}
+			return receipts, nil
+		}
+	}
+
+	for _, tx := range txs {
+		receipt, err := p.rpcClient.FetchTransactionReceipt(ctx, tx.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if receipt != nil {
+			receipts[tx.Hash] = receipt
+		}
+	}
+	return receipts, nil
+}
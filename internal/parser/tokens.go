@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+)
+
+// tokenMetadata is the symbol and decimals of a token contract, as far as the contract reports them
+type tokenMetadata struct {
+	symbol   string
+	decimals *int
+}
+
+// tokenTransfers decodes the token transfers among a block's logs, skipping logs that are not
+// Transfer events of a recognised token standard or that are malformed
+func (p *EthParser) tokenTransfers(number int, block *rpc.Block, logs []rpc.Log) []interfaces.Transaction {
+	timestamp, err := blockTime(number, block)
+	if err != nil {
+		p.log.Error.Printf("Skipping token transfers in block %d: %v", number, err)
+		return nil
+	}
+
+	var transfers []interfaces.Transaction
+	for _, log := range logs {
+		tx, ok, err := rpc.ParseTokenTransfer(log)
+		if err != nil {
+			p.log.Error.Printf("Skipping token transfer in block %d: %v", number, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		// The block is authoritative for where the transfer was included
+		tx.BlockNumber = number
+		tx.BlockHash = block.Hash
+		tx.Timestamp = timestamp
+		transfers = append(transfers, tx)
+	}
+	return transfers
+}
+
+// addTokenMetadata sets the symbol of a token transfer's token, and its decimals if it is fungible
+func (p *EthParser) addTokenMetadata(ctx context.Context, tx *interfaces.Transaction) {
+	metadata := p.tokenMetadata(ctx, tx.Token.Contract)
+	tx.Token.Symbol = metadata.symbol
+	if tx.Kind == interfaces.KindERC20 {
+		tx.Token.Decimals = metadata.decimals
+	}
+}
+
+// tokenMetadata returns the metadata of a token contract, calling the contract the first time it
+// is seen. Contracts without the optional getters are cached without them, while node failures are
+// not cached so the next transfer of the token tries again.
+func (p *EthParser) tokenMetadata(ctx context.Context, contract string) tokenMetadata {
+	p.tokensMu.Lock()
+	metadata, ok := p.tokens[contract]
+	p.tokensMu.Unlock()
+	if ok {
+		return metadata
+	}
+
+	cacheable := true
+	if data, err := p.callToken(ctx, contract, rpc.SymbolSelector, &cacheable); err == nil {
+		if symbol, err := rpc.DecodeABIString(data); err == nil {
+			metadata.symbol = symbol
+		}
+	}
+	if data, err := p.callToken(ctx, contract, rpc.DecimalsSelector, &cacheable); err == nil {
+		// Decimals are a uint8 by the standard, anything larger is not a decimals value
+		if decimals, err := rpc.DecodeABIUint(data); err == nil && decimals.IsUint64() && decimals.Uint64() <= 255 {
+			value := int(decimals.Uint64())
+			metadata.decimals = &value
+		}
+	}
+
+	if cacheable {
+		p.tokensMu.Lock()
+		p.tokens[contract] = metadata
+		p.tokensMu.Unlock()
+	}
+	return metadata
+}
+
+// callToken calls a metadata getter of a token, clearing cacheable when the call failed for a
+// reason other than the contract's own answer
+func (p *EthParser) callToken(ctx context.Context, contract, selector string, cacheable *bool) (string, error) {
+	data, err := p.rpcClient.CallContract(ctx, contract, selector)
+	if err != nil && !errors.Is(err, rpc.ErrExecutionReverted) {
+		p.log.Warn.Printf("Failed to fetch metadata of token %s: %v", contract, err)
+		*cacheable = false
+	}
+	return data, err
+}
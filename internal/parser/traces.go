@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"tx-parser/internal/config"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+)
+
+// tracing reports whether blocks are traced for internal transfers
+func (p *EthParser) tracing() bool {
+	return p.traces != "" && !p.tracingUnsupported.Load()
+}
+
+// fetchTraces traces every fetched block when tracing is enabled. A block that cannot be traced
+// fails like a missing block, so internal transfers are never silently skipped.
+func (p *EthParser) fetchTraces(ctx context.Context, results []fetchResult) {
+	for i := range results {
+		result := &results[i]
+		if result.err != nil || !p.tracing() {
+			continue
+		}
+		result.traces, result.err = p.traceBlock(ctx, result.number, result.block)
+	}
+}
+
+// traceBlock returns the internal transfers of a block, checking that the traces belong to the
+// fetched block rather than one that replaced it since
+func (p *EthParser) traceBlock(ctx context.Context, number int, block *rpc.Block) ([]rpc.InternalCall, error) {
+	client := p.rpcClient.(rpc.TraceClient)
+
+	var calls []rpc.InternalCall
+	var err error
+	switch p.traces {
+	case config.TracesDebug:
+		var traces []rpc.CallTrace
+		if traces, err = client.DebugTraceBlock(ctx, number); err == nil {
+			if err = matchCallTraces(number, block, traces); err == nil {
+				calls, err = rpc.ParseCallTraces(traces)
+			}
+		}
+	case config.TracesTrace:
+		var traces []rpc.ParityTrace
+		if traces, err = client.TraceBlock(ctx, number); err == nil {
+			for _, trace := range traces {
+				if trace.BlockHash != "" && trace.BlockHash != block.Hash {
+					return nil, fmt.Errorf("traces of block %d are from block %s instead of %s", number, trace.BlockHash, block.Hash)
+				}
+			}
+			calls, err = rpc.ParseParityTraces(traces)
+		}
+	}
+
+	if errors.Is(err, rpc.ErrTracingUnsupported) {
+		// Retrying would stall indexing for good, so carry on without internal transfers
+		p.log.Error.Printf("Node does not support %s tracing, internal transfers will not be indexed: %v", p.traces, err)
+		p.tracingUnsupported.Store(true)
+		return nil, nil
+	}
+	return calls, err
+}
+
+// matchCallTraces checks that callTracer results line up with the block's transactions, filling
+// in the transaction hashes older nodes leave out
+func matchCallTraces(number int, block *rpc.Block, traces []rpc.CallTrace) error {
+	if len(traces) != len(block.Transactions) {
+		return fmt.Errorf("got %d traces for the %d transactions of block %d", len(traces), len(block.Transactions), number)
+	}
+	for i := range traces {
+		switch traces[i].TxHash {
+		case "":
+			traces[i].TxHash = block.Transactions[i].Hash
+		case block.Transactions[i].Hash:
+		default:
+			return fmt.Errorf("trace of transaction %s does not match transaction %s of block %d", traces[i].TxHash, block.Transactions[i].Hash, number)
+		}
+	}
+	return nil
+}
+
+// internalTransfers builds internal transfer records from the traced calls of a block
+func (p *EthParser) internalTransfers(number int, block *rpc.Block, calls []rpc.InternalCall) []interfaces.Transaction {
+	if len(calls) == 0 {
+		return nil
+	}
+	timestamp, err := blockTime(number, block)
+	if err != nil {
+		p.log.Error.Printf("Skipping internal transfers in block %d: %v", number, err)
+		return nil
+	}
+
+	txIndex := make(map[string]int, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txIndex[tx.Hash] = i
+	}
+
+	transfers := make([]interfaces.Transaction, 0, len(calls))
+	for _, call := range calls {
+		transfers = append(transfers, interfaces.Transaction{
+			Kind:             interfaces.KindInternal,
+			Hash:             call.TxHash,
+			From:             call.From,
+			To:               call.To,
+			Value:            new(big.Int).Set(call.Value),
+			BlockNumber:      number,
+			BlockHash:        block.Hash,
+			TransactionIndex: txIndex[call.TxHash],
+			Timestamp:        timestamp,
+			TracePath:        call.Path,
+			CallType:         call.Type,
+		})
+	}
+	return transfers
+}
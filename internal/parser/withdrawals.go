@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/rpc"
+)
+
+// withdrawals builds withdrawal records from the beacon chain withdrawals of a block
+func (p *EthParser) withdrawals(number int, block *rpc.Block) []interfaces.Transaction {
+	if len(block.Withdrawals) == 0 {
+		return nil
+	}
+	timestamp, err := blockTime(number, block)
+	if err != nil {
+		p.log.Error.Printf("Skipping withdrawals in block %d: %v", number, err)
+		return nil
+	}
+
+	withdrawals := make([]interfaces.Transaction, 0, len(block.Withdrawals))
+	for _, raw := range block.Withdrawals {
+		withdrawal, err := rpc.ParseWithdrawal(raw)
+		if err != nil {
+			p.log.Error.Printf("Skipping withdrawal in block %d: %v", number, err)
+			continue
+		}
+		withdrawal.BlockNumber = number
+		withdrawal.BlockHash = block.Hash
+		withdrawal.Timestamp = timestamp
+		withdrawals = append(withdrawals, withdrawal)
+	}
+	return withdrawals
+}
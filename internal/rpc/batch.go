@@ -0,0 +1,161 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrBatchUnsupported is returned when the node does not answer JSON-RPC batches with an array
+var ErrBatchUnsupported = errors.New("node does not support JSON-RPC batch requests")
+
+// BatchClient is implemented by clients that can fetch several blocks, or their logs, in one round trip
+type BatchClient interface {
+	FetchBlockRange(ctx context.Context, from, to int) ([]BlockResult, error)
+	FetchBlockLogs(ctx context.Context, blockHashes []string, topics [][]string) ([]LogsResult, error)
+}
+
+// BlockResult is the outcome of fetching a single block in a batch
+type BlockResult struct {
+	Block *Block
+	Err   error
+}
+
+// BatchElem is a single call in a JSON-RPC batch. Result must be a pointer the call's result is
+// unmarshalled into; Error is set when that call failed.
+type BatchElem struct {
+	Method string
+	Params []interface{}
+	Result interface{}
+	Error  error
+}
+
+// RPCError is an error object returned by the node for a single call
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// Batch sends all elems in a single HTTP request and maps each response back to its elem by id.
+// The returned error covers the request as a whole; per-call errors are set on the elems.
+func (c *RpcClient) Batch(ctx context.Context, elems []BatchElem) error {
+	if len(elems) == 0 {
+		return nil
+	}
+
+	payload := make([]RequestPayload, len(elems))
+	for i, elem := range elems {
+		params := elem.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		payload[i] = RequestPayload{Jsonrpc: "2.0", Method: elem.Method, Params: params, Id: i + 1}
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch payload: %v", err)
+	}
+
+	// Only failures of the request as a whole are retried here
+	var body []byte
+	err = c.withRetry(ctx, "batch", func() error {
+		body, err = c.post(ctx, jsonPayload)
+		return err
+	})
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && batchRejected(statusErr.StatusCode) {
+		// Some nodes reject batches outright with a client error status
+		c.log.Debug.Printf("Batch request rejected: %v", err)
+		return ErrBatchUnsupported
+	}
+	if err != nil {
+		return err
+	}
+
+	// Nodes without batch support answer with a single error object (or a non-JSON body)
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		c.log.Debug.Printf("Batch request answered with a non-array body: %s", body)
+		return ErrBatchUnsupported
+	}
+
+	var responses []struct {
+		Id     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return fmt.Errorf("failed to unmarshal batch response: %v", err)
+	}
+
+	// Responses may arrive in any order, so match them to their request by id
+	answered := make([]bool, len(elems))
+	for _, response := range responses {
+		i := response.Id - 1
+		if i < 0 || i >= len(elems) || answered[i] {
+			c.log.Warn.Printf("Ignoring batch response with unexpected id %d", response.Id)
+			continue
+		}
+		answered[i] = true
+
+		switch {
+		case response.Error != nil:
+			elems[i].Error = response.Error
+		case elems[i].Result != nil:
+			if err := json.Unmarshal(response.Result, elems[i].Result); err != nil {
+				elems[i].Error = fmt.Errorf("failed to unmarshal result: %v", err)
+			}
+		}
+	}
+	for i := range elems {
+		if !answered[i] {
+			elems[i].Error = fmt.Errorf("no response for batched %s call", elems[i].Method)
+		}
+	}
+	return nil
+}
+
+// batchRejected reports whether an HTTP status means the node does not accept batch requests, as
+// opposed to failures such as authentication errors that would fail single requests just the same
+func batchRejected(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusRequestEntityTooLarge, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// FetchBlockRange fetches blocks from..to with transactions in a single batch request
+func (c *RpcClient) FetchBlockRange(ctx context.Context, from, to int) ([]BlockResult, error) {
+	if to < from {
+		return nil, nil
+	}
+
+	blocks := make([]*Block, to-from+1)
+	elems := make([]BatchElem, len(blocks))
+	for i := range elems {
+		elems[i] = BatchElem{
+			Method: "eth_getBlockByNumber",
+			Params: []interface{}{fmt.Sprintf("0x%x", from+i), true}, // true to include transactions
+			Result: &blocks[i],
+		}
+	}
+
+	if err := c.Batch(ctx, elems); err != nil {
+		return nil, err
+	}
+
+	results := make([]BlockResult, len(blocks))
+	for i := range results {
+		results[i] = BlockResult{Block: blocks[i], Err: elems[i].Error}
+	}
+	return results, nil
+}
@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test Batch maps out-of-order responses and per-call errors back to their calls by id
+func TestBatch(t *testing.T) {
+	mockResponse := `[
+		{"jsonrpc":"2.0","id":3,"error":{"code":-32000,"message":"header not found"}},
+		{"jsonrpc":"2.0","id":1,"result":"0xa"},
+		{"jsonrpc":"2.0","id":2,"result":"0xb"}
+	]`
+	mockServer := newMockServer(mockResponse)
+	defer mockServer.Close()
+
+	// Set up the client
+	log := logger.GetLogger("debug")
+	client := NewClient(mockServer.URL, log)
+
+	var first, second, third string
+	elems := []BatchElem{
+		{Method: "eth_blockNumber", Result: &first},
+		{Method: "eth_chainId", Result: &second},
+		{Method: "eth_gasPrice", Result: &third},
+	}
+	err := client.Batch(context.Background(), elems)
+	assert.Nil(t, err, "Expected no error for the batch as a whole")
+
+	assert.Nil(t, elems[0].Error, "Expected no error for the first call")
+	assert.Equal(t, "0xa", first, "First result should match response id 1")
+	assert.Nil(t, elems[1].Error, "Expected no error for the second call")
+	assert.Equal(t, "0xb", second, "Second result should match response id 2")
+	assert.NotNil(t, elems[2].Error, "Expected an error for the third call")
+	assert.Contains(t, elems[2].Error.Error(), "header not found", "Error should come from response id 3")
+}
+
+// Test Batch reports calls the node did not answer
+func TestBatch_MissingResponse(t *testing.T) {
+	mockServer := newMockServer(`[{"jsonrpc":"2.0","id":1,"result":"0xa"}]`)
+	defer mockServer.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(mockServer.URL, log)
+
+	var first, second string
+	elems := []BatchElem{
+		{Method: "eth_blockNumber", Result: &first},
+		{Method: "eth_chainId", Result: &second},
+	}
+	assert.Nil(t, client.Batch(context.Background(), elems), "Expected no error for the batch as a whole")
+	assert.Nil(t, elems[0].Error, "Expected no error for the answered call")
+	assert.NotNil(t, elems[1].Error, "Expected an error for the unanswered call")
+}
+
+// Test Batch detects nodes that do not support batch requests
+func TestBatch_Unsupported(t *testing.T) {
+	mockServer := newMockServer(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch requests are not supported"}}`)
+	defer mockServer.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(mockServer.URL, log)
+
+	var result string
+	err := client.Batch(context.Background(), []BatchElem{{Method: "eth_blockNumber", Result: &result}, {Method: "eth_chainId", Result: &result}})
+	assert.Equal(t, ErrBatchUnsupported, err, "Expected the batch to be reported as unsupported")
+}
+
+// Test Batch only reports statuses that reject batches as unsupported, returning others as they are
+func TestBatch_Status(t *testing.T) {
+	for _, tc := range []struct {
+		status      int
+		unsupported bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusMethodNotAllowed, true},
+		{http.StatusRequestEntityTooLarge, true},
+		{http.StatusNotImplemented, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, false},
+		{http.StatusInternalServerError, false},
+	} {
+		mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.status)
+		}))
+
+		log := logger.GetLogger("debug")
+		client := NewClient(mockServer.URL, log)
+
+		var result string
+		err := client.Batch(context.Background(), []BatchElem{{Method: "eth_blockNumber", Result: &result}})
+		if tc.unsupported {
+			assert.Equal(t, ErrBatchUnsupported, err, "Status %d should report batches as unsupported", tc.status)
+		} else {
+			var statusErr *StatusError
+			assert.ErrorAs(t, err, &statusErr, "Status %d should be returned as a status error", tc.status)
+			assert.NotErrorIs(t, err, ErrBatchUnsupported, "Status %d should not report batches as unsupported", tc.status)
+		}
+		mockServer.Close()
+	}
+}
+
+// Test FetchBlockRange fetches consecutive blocks in one request
+func TestFetchBlockRange(t *testing.T) {
+	var requests int
+	var requestBody string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		requestBody = string(body)
+		io.WriteString(w, `[
+			{"jsonrpc":"2.0","id":2,"result":null},
+			{"jsonrpc":"2.0","id":1,"result":{"number":"0x1","hash":"0xa","transactions":[{"hash":"0x1","from":"0xFrom1","to":"0xTo1","value":"100"}]}}
+		]`)
+	}))
+	defer mockServer.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(mockServer.URL, log)
+
+	results, err := client.FetchBlockRange(context.Background(), 1, 2)
+	assert.Nil(t, err, "Expected no error when fetching a block range")
+	assert.Equal(t, 1, requests, "Expected a single HTTP request")
+	assert.Contains(t, requestBody, `"params":["0x2",true]`, "Expected the second block to be requested")
+
+	assert.Len(t, results, 2, "Expected a result per block")
+	assert.Nil(t, results[0].Err, "Expected no error for the first block")
+	assert.Equal(t, "0xa", results[0].Block.Hash, "Expected the first block to be decoded")
+	assert.Len(t, results[0].Block.Transactions, 1, "Expected the first block's transactions to be decoded")
+	assert.Nil(t, results[1].Block, "Expected a missing block to be nil")
+}
+
+// Test FetchTransactionsByHash looks up several transactions in one request
+func TestFetchTransactionsByHash(t *testing.T) {
+	var requests int
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.WriteString(w, `[
+			{"jsonrpc":"2.0","id":2,"result":null},
+			{"jsonrpc":"2.0","id":1,"result":{"hash":"0x1","from":"0xFrom1","to":"0xTo1","value":"0x64"}}
+		]`)
+	}))
+	defer mockServer.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(mockServer.URL, log)
+
+	results, err := client.FetchTransactionsByHash(context.Background(), []string{"0x1", "0x2"})
+	assert.Nil(t, err, "Expected no error when fetching transactions")
+	assert.Equal(t, 1, requests, "Expected a single HTTP request")
+	assert.Len(t, results, 2, "Expected a result per transaction")
+	assert.Equal(t, "0x1", results[0].Transaction.Hash, "Expected the first transaction to be decoded")
+	assert.Nil(t, results[1].Transaction, "Expected an unknown transaction to be nil")
+	assert.Nil(t, results[1].Err, "Expected no error for an unknown transaction")
+}
@@ -2,70 +2,95 @@ package rpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
-	"tx-parser/internal/interfaces"
+	"time"
 	"tx-parser/pkg/logger"
 )
 
+// Defaults used for timeouts that are not configured
+const (
+	DefaultConnectTimeout = 5 * time.Second
+	DefaultRequestTimeout = 30 * time.Second
+)
+
 type Client interface {
-	FetchCurrentBlock() (int, error)
-	FetchBlockByNumber(int) (*Block, error)
+	FetchCurrentBlock(ctx context.Context) (int, error)
+	FetchBlockByNumber(ctx context.Context, blockNumber int) (*Block, error)
+	FetchBlockByTag(ctx context.Context, tag string) (*Block, error)
+	FetchTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error)
+	FetchLogs(ctx context.Context, filter LogFilter) ([]Log, error)
+	CallContract(ctx context.Context, to, data string) (string, error)
+}
+
+// HeaderClient is implemented by clients that can fetch blocks without their transactions
+type HeaderClient interface {
+	FetchHeaderByNumber(ctx context.Context, blockNumber int) (*Block, error)
+	FetchHeaderByHash(ctx context.Context, hash string) (*Block, error)
 }
 
 type RpcClient struct {
-	url string
-	log *logger.Logger
+	url        string
+	httpClient *http.Client
+	retry      RetryPolicy
+	log        *logger.Logger
 }
 
+// NewClient creates a client with default timeouts that sends each request once; see
+// WithHTTPClient and WithRetryPolicy
 func NewClient(url string, log *logger.Logger) *RpcClient {
 	return &RpcClient{
-		url: url,
-		log: log,
+		url:        url,
+		httpClient: NewHTTPClient(DefaultConnectTimeout, DefaultRequestTimeout),
+		retry:      RetryPolicy{MaxAttempts: 1},
+		log:        log,
 	}
 }
 
-func (c *RpcClient) FetchCurrentBlock() (int, error) {
-	payload := `{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}`
-	resp, err := http.Post(c.url, "application/json", bytes.NewBuffer([]byte(payload)))
-	c.log.Info.Printf("request resp: %v", resp)
-	if err != nil {
-		c.log.Error.Printf("Failed to send request: %v", err)
-		return 0, err
+// NewHTTPClient creates an HTTP client for RPC requests. The connect timeout bounds dialing and the
+// TLS handshake, the request timeout bounds a whole request including reading the response.
+func NewHTTPClient(connectTimeout, requestTimeout time.Duration) *http.Client {
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		errStr := fmt.Sprintf("failed to fetch current block: status code %d", resp.StatusCode)
-		c.log.Error.Printf(errStr)
-		return 0, fmt.Errorf(errStr)
+	if requestTimeout <= 0 {
+		requestTimeout = DefaultRequestTimeout
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.log.Error.Printf("Failed to read response body: %v", err)
-		return 0, err
-	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	// Keep enough idle connections for the concurrent fetch workers
+	transport.MaxIdleConnsPerHost = 32
+	return &http.Client{Transport: transport, Timeout: requestTimeout}
+}
 
-	// Struct to capture the JSON-RPC result
-	var result struct {
-		Jsonrpc string `json:"jsonrpc"`
-		ID      int    `json:"id"`
-		Result  string `json:"result"` // The result will be a hexadecimal string
-	}
+// WithHTTPClient sets the HTTP client used to send requests, e.g. to share it between clients
+func (c *RpcClient) WithHTTPClient(httpClient *http.Client) *RpcClient {
+	c.httpClient = httpClient
+	return c
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests
+func (c *RpcClient) WithRetryPolicy(policy RetryPolicy) *RpcClient {
+	c.retry = policy
+	return c
+}
 
-	// Parse the JSON response
-	if err := json.Unmarshal(body, &result); err != nil {
-		c.log.Error.Printf("Failed to parse JSON response: %v", err)
-		return 0, fmt.Errorf("failed to parse JSON response: %w", err)
+func (c *RpcClient) FetchCurrentBlock(ctx context.Context) (int, error) {
+	var result string // The result will be a hexadecimal string
+	if err := c.call(ctx, "eth_blockNumber", nil, &result); err != nil {
+		c.log.Error.Printf("Failed to fetch current block: %v", err)
+		return 0, err
 	}
 
 	// Trim the "0x" prefix from the hex string if present
-	hexStr := strings.TrimPrefix(result.Result, "0x")
+	hexStr := strings.TrimPrefix(result, "0x")
 
 	// Convert the hex string to an integer
 	blockNumber, err := parseHexToInt(hexStr)
@@ -98,52 +123,136 @@ type RequestPayload struct {
 
 // Block and Transaction are used to unmarshal the block data from the RPC
 type Block struct {
-	Number       string                   `json:"number"`
-	Transactions []interfaces.Transaction `json:"transactions"`
+	Number       string        `json:"number"`
+	Hash         string        `json:"hash"`
+	ParentHash   string        `json:"parentHash"`
+	Timestamp    string        `json:"timestamp"`
+	Transactions []Transaction `json:"transactions"`
+	Withdrawals  []Withdrawal  `json:"withdrawals"` // Beacon chain withdrawals, since Shanghai
+}
+
+func (client *RpcClient) FetchBlockByNumber(ctx context.Context, blockNumber int) (*Block, error) {
+	return client.fetchBlock(ctx, fmt.Sprintf("0x%x", blockNumber))
 }
 
-func (client *RpcClient) FetchBlockByNumber(blockNumber int) (*Block, error) {
-	payload := RequestPayload{
-		Jsonrpc: "2.0",
-		Method:  "eth_getBlockByNumber",
-		Params:  []interface{}{fmt.Sprintf("0x%x", blockNumber), true}, // true to include transactions
-		Id:      1,
+// FetchBlockByTag fetches a block by tag such as "latest", "safe" or "finalized"
+func (client *RpcClient) FetchBlockByTag(ctx context.Context, tag string) (*Block, error) {
+	return client.fetchBlock(ctx, tag)
+}
+
+// FetchHeaderByNumber fetches a block without its transactions, returning nil for blocks the node
+// does not have yet
+func (client *RpcClient) FetchHeaderByNumber(ctx context.Context, blockNumber int) (*Block, error) {
+	return client.fetchHeader(ctx, "eth_getBlockByNumber", fmt.Sprintf("0x%x", blockNumber))
+}
+
+// FetchHeaderByHash fetches a block without its transactions by hash, which also finds blocks of
+// a branch orphaned by a reorg as long as the node still has them. It returns nil for unknown blocks.
+func (client *RpcClient) FetchHeaderByHash(ctx context.Context, hash string) (*Block, error) {
+	return client.fetchHeader(ctx, "eth_getBlockByHash", hash)
+}
+
+func (client *RpcClient) fetchHeader(ctx context.Context, method, blockParam string) (*Block, error) {
+	var header *blockHeader
+	params := []interface{}{blockParam, false} // false to only include transaction hashes
+	if err := client.call(ctx, method, params, &header); err != nil {
+		return nil, err
+	}
+	return header.block(), nil
+}
+
+// blockHeader is a block fetched without its transactions, which are then only listed by hash
+type blockHeader struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// block returns the header as a block without transactions, or nil for a missing block
+func (h *blockHeader) block() *Block {
+	if h == nil {
+		return nil
+	}
+	return &Block{Number: h.Number, Hash: h.Hash, ParentHash: h.ParentHash, Timestamp: h.Timestamp}
+}
+
+func (client *RpcClient) fetchBlock(ctx context.Context, blockParam string) (*Block, error) {
+	var block *Block
+	params := []interface{}{blockParam, true} // true to include transactions
+	if err := client.call(ctx, "eth_getBlockByNumber", params, &block); err != nil {
+		return nil, err
 	}
+	return block, nil
+}
 
-	jsonPayload, err := json.Marshal(payload)
+// call sends a single JSON-RPC request and unmarshals its result, retrying according to the policy
+func (c *RpcClient) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	payload, err := json.Marshal(RequestPayload{Jsonrpc: "2.0", Method: method, Params: params, Id: 1})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal payload: %v", err)
+		return fmt.Errorf("failed to marshal payload: %v", err)
 	}
 
-	resp, err := http.Post(client.url, "application/json", bytes.NewBuffer(jsonPayload))
+	return c.withRetry(ctx, method, func() error {
+		body, err := c.post(ctx, payload)
+		if err != nil {
+			return err
+		}
+
+		var response struct {
+			Jsonrpc string          `json:"jsonrpc"`
+			Id      int             `json:"id"`
+			Result  json.RawMessage `json:"result"`
+			Error   *RPCError       `json:"error,omitempty"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %v", err)
+		}
+		if response.Error != nil {
+			return response.Error
+		}
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("failed to unmarshal result: %v", err)
+		}
+		return nil
+	})
+}
+
+// post sends a JSON-RPC payload and returns the response body of a successful HTTP exchange
+func (c *RpcClient) post(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewBuffer(payload))
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	defer resp.Body.Close()
+	req.Header.Set("Content-Type", "application/json")
 
-	body, err := ioutil.ReadAll(resp.Body)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
+	defer resp.Body.Close()
 
-	var result struct {
-		Jsonrpc string `json:"jsonrpc"`
-		Id      int    `json:"id"`
-		Result  *Block `json:"result"`
-		Error   *struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-		} `json:"error,omitempty"`
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
-	err = json.Unmarshal(body, &result)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	return body, nil
+}
 
-	if result.Error != nil {
-		return nil, fmt.Errorf("RPC error: %s", result.Error.Message)
-	}
+// ParseBlockNumber converts a block's hex encoded number to an integer
+func ParseBlockNumber(block *Block) (int, error) {
+	return parseHexToInt(strings.TrimPrefix(block.Number, "0x"))
+}
 
-	return result.Result, nil
+// ParseBlockTimestamp converts a block's hex encoded timestamp to Unix seconds
+func ParseBlockTimestamp(block *Block) (int64, error) {
+	timestamp, err := parseHexToInt(strings.TrimPrefix(block.Timestamp, "0x"))
+	return int64(timestamp), err
 }
@@ -1,11 +1,15 @@
 package rpc
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"tx-parser/internal/config"
 	"tx-parser/pkg/logger"
 
 	"github.com/stretchr/testify/assert"
@@ -31,7 +35,7 @@ func TestFetchCurrentBlock(t *testing.T) {
 	client := NewClient(mockServer.URL, log)
 
 	// Fetch the current block number
-	blockNumber, err := client.FetchCurrentBlock()
+	blockNumber, err := client.FetchCurrentBlock(context.Background())
 	assert.Nil(t, err, "Expected no error when fetching current block")
 	assert.Equal(t, 10, blockNumber, "Expected block number to be 10 (0xa in hex)")
 }
@@ -48,7 +52,7 @@ func TestFetchCurrentBlock_Error(t *testing.T) {
 	client := NewClient(mockServer.URL, log)
 
 	// Fetch the current block number (this should return an error)
-	blockNumber, err := client.FetchCurrentBlock()
+	blockNumber, err := client.FetchCurrentBlock(context.Background())
 	assert.NotNil(t, err, "Expected an error when fetching current block")
 	assert.Equal(t, 0, blockNumber, "Expected block number to be 0 on error")
 }
@@ -75,7 +79,7 @@ func TestFetchBlockByNumber(t *testing.T) {
 	client := NewClient(mockServer.URL, log)
 
 	// Fetch block by number
-	block, err := client.FetchBlockByNumber(1)
+	block, err := client.FetchBlockByNumber(context.Background(), 1)
 	assert.Nil(t, err, "Expected no error when fetching block by number")
 	assert.Equal(t, "0x1", block.Number, "Expected block number to be 0x1")
 	assert.Len(t, block.Transactions, 2, "Expected 2 transactions in the block")
@@ -97,8 +101,111 @@ func TestFetchBlockByNumber_Error(t *testing.T) {
 	client := NewClient(mockServer.URL, log)
 
 	// Fetch block by number (this should return an error)
-	block, err := client.FetchBlockByNumber(1)
+	block, err := client.FetchBlockByNumber(context.Background(), 1)
 	assert.NotNil(t, err, "Expected an error when fetching block by number")
 	assert.Nil(t, block, "Expected block to be nil on error")
 	assert.True(t, strings.Contains(err.Error(), "Internal error"), "Expected error message to contain 'Internal error'")
 }
+
+// Test FetchBlockByTag sends the tag as the block parameter
+func TestFetchBlockByTag(t *testing.T) {
+	var requestBody string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requestBody = string(body)
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":{"number":"0x64","hash":"0xabc","parentHash":"0xdef","transactions":[]}}`)
+	}))
+	defer mockServer.Close()
+
+	// Set up the client
+	log := logger.GetLogger("debug")
+	client := NewClient(mockServer.URL, log)
+
+	// Fetch the finalized block
+	block, err := client.FetchBlockByTag(context.Background(), "finalized")
+	assert.Nil(t, err, "Expected no error when fetching block by tag")
+	assert.True(t, strings.Contains(requestBody, `"params":["finalized",true]`), "Expected the tag to be sent as the block parameter")
+
+	number, err := ParseBlockNumber(block)
+	assert.Nil(t, err, "Expected no error when parsing the block number")
+	assert.Equal(t, 100, number, "Expected block number to be 100 (0x64 in hex)")
+	assert.Equal(t, "0xdef", block.ParentHash, "Expected parent hash to be decoded")
+}
+
+// Test that headers are fetched without transactions, and an unknown block is nil
+func TestFetchHeader(t *testing.T) {
+	var requestBody string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requestBody = string(body)
+		if strings.Contains(requestBody, "0xunknown") {
+			io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":null}`)
+			return
+		}
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":{"number":"0x64","hash":"0xabc","parentHash":"0xdef","transactions":["0x1"]}}`)
+	}))
+	defer mockServer.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(mockServer.URL, log)
+
+	block, err := client.FetchHeaderByHash(context.Background(), "0xabc")
+	assert.Nil(t, err, "Expected no error when fetching a header by hash")
+	assert.True(t, strings.Contains(requestBody, `"method":"eth_getBlockByHash","params":["0xabc",false]`), "Expected the hash to be sent without full transactions")
+	assert.Equal(t, "0xdef", block.ParentHash, "Expected parent hash to be decoded")
+
+	block, err = client.FetchHeaderByNumber(context.Background(), 100)
+	assert.Nil(t, err, "Expected no error when fetching a header by number")
+	assert.True(t, strings.Contains(requestBody, `"method":"eth_getBlockByNumber","params":["0x64",false]`), "Expected the number to be sent without full transactions")
+	assert.Equal(t, "0xabc", block.Hash, "Expected hash to be decoded")
+
+	block, err = client.FetchHeaderByHash(context.Background(), "0xunknown")
+	assert.Nil(t, err, "Expected no error for an unknown block")
+	assert.Nil(t, block, "Expected no block for an unknown hash")
+}
+
+// newHangingServer answers only after the given delay or once the client goes away
+func newHangingServer(delay time.Duration) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		// The server only notices the client going away once the request body has been read
+		io.ReadAll(r.Body)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":"0xa"}`)
+	}))
+	return server, &requests
+}
+
+// Test that a hung node fails the request once the request timeout expires
+func TestFetchCurrentBlock_Timeout(t *testing.T) {
+	server, _ := newHangingServer(time.Minute)
+	defer server.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(server.URL, log).WithHTTPClient(NewHTTPClient(time.Second, 50*time.Millisecond))
+
+	start := time.Now()
+	_, err := client.FetchCurrentBlock(context.Background())
+	assert.NotNil(t, err, "Expected an error for a hung node")
+	assert.Less(t, time.Since(start), 5*time.Second, "Request should give up after the timeout")
+}
+
+// Test that cancelling the context aborts an in-flight request without retrying it
+func TestFetchCurrentBlock_Cancel(t *testing.T) {
+	server, requests := newHangingServer(time.Minute)
+	defer server.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(server.URL, log).WithRetryPolicy(NewRetryPolicy(config.RetryConfig{MaxAttempts: 5, InitialBackoff: time.Millisecond}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.FetchCurrentBlock(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Expected the context error")
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests), "Cancelled requests should not be retried")
+}
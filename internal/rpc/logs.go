@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+)
+
+// Log is an event log as returned by the node, with quantities hex encoded
+type Log struct {
+	Address          string   `json:"address"`
+	Topics           []string `json:"topics"`
+	Data             string   `json:"data"`
+	BlockNumber      string   `json:"blockNumber"`
+	BlockHash        string   `json:"blockHash"`
+	TransactionHash  string   `json:"transactionHash"`
+	TransactionIndex string   `json:"transactionIndex"`
+	LogIndex         string   `json:"logIndex"`
+	Removed          bool     `json:"removed"`
+}
+
+// LogFilter selects the logs returned by eth_getLogs. Each topic position matches any of the
+// listed topics, and a nil position matches every topic.
+type LogFilter struct {
+	BlockHash string     `json:"blockHash,omitempty"`
+	Address   []string   `json:"address,omitempty"`
+	Topics    [][]string `json:"topics,omitempty"`
+}
+
+// LogsResult is the outcome of fetching the logs of a single block in a batch
+type LogsResult struct {
+	Logs []Log
+	Err  error
+}
+
+// FetchLogs fetches the logs matching a filter. Filtering by block hash makes the node fail
+// instead of returning nothing when it does not have the block.
+func (c *RpcClient) FetchLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	var logs []Log
+	if err := c.call(ctx, "eth_getLogs", []interface{}{filter}, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// FetchBlockLogs fetches the logs matching topics in each of the given blocks in a single batch request
+func (c *RpcClient) FetchBlockLogs(ctx context.Context, blockHashes []string, topics [][]string) ([]LogsResult, error) {
+	logs := make([][]Log, len(blockHashes))
+	elems := make([]BatchElem, len(blockHashes))
+	for i, hash := range blockHashes {
+		elems[i] = BatchElem{
+			Method: "eth_getLogs",
+			Params: []interface{}{LogFilter{BlockHash: hash, Topics: topics}},
+			Result: &logs[i],
+		}
+	}
+
+	if err := c.Batch(ctx, elems); err != nil {
+		return nil, err
+	}
+
+	results := make([]LogsResult, len(logs))
+	for i := range results {
+		results[i] = LogsResult{Logs: logs[i], Err: elems[i].Error}
+	}
+	return results, nil
+}
+
+// parseLogRecord builds the common part of a record derived from a log: where it was emitted
+func parseLogRecord(log Log) (interfaces.Transaction, int, error) {
+	blockNumber, err := parseOptionalHexInt(log.BlockNumber)
+	if err != nil {
+		return interfaces.Transaction{}, 0, fmt.Errorf("invalid blockNumber of log in transaction %s: %w", log.TransactionHash, err)
+	}
+	txIndex, err := parseOptionalHexInt(log.TransactionIndex)
+	if err != nil {
+		return interfaces.Transaction{}, 0, fmt.Errorf("invalid transactionIndex of log in transaction %s: %w", log.TransactionHash, err)
+	}
+	logIndex, err := parseOptionalHexInt(log.LogIndex)
+	if err != nil {
+		return interfaces.Transaction{}, 0, fmt.Errorf("invalid logIndex of log in transaction %s: %w", log.TransactionHash, err)
+	}
+	return interfaces.Transaction{
+		Hash:             log.TransactionHash,
+		BlockNumber:      blockNumber,
+		BlockHash:        log.BlockHash,
+		TransactionIndex: txIndex,
+	}, logIndex, nil
+}
+
+// topicAddress decodes an address from an indexed topic, which left-pads it to 32 bytes
+func topicAddress(topic string) (string, error) {
+	hex := strings.TrimPrefix(topic, "0x")
+	if len(hex) != 64 {
+		return "", fmt.Errorf("topic %s is not 32 bytes", topic)
+	}
+	return utils.NormalizeAddress("0x" + hex[24:]), nil
+}
@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+)
+
+// PendingSubscriber pushes transactions as they enter the node's mempool
+type PendingSubscriber interface {
+	// SubscribePendingTransactions delivers every new pending transaction to txs until ctx is
+	// cancelled. Transactions announced while txs is full are dropped rather than waited for.
+	SubscribePendingTransactions(ctx context.Context, txs chan<- PendingTransaction)
+}
+
+// PendingTransaction is a transaction announced by the node's mempool. Nodes that only announce
+// hashes leave Transaction nil.
+type PendingTransaction struct {
+	Hash        string
+	Transaction *Transaction
+}
+
+// TransactionFetcher is implemented by clients that can look up a transaction by hash
+type TransactionFetcher interface {
+	// FetchTransactionByHash returns nil when the node knows no such transaction, mined or pending
+	FetchTransactionByHash(ctx context.Context, txHash string) (*Transaction, error)
+}
+
+// BatchTransactionFetcher is implemented by clients that can look up several transactions by hash
+// in one round trip
+type BatchTransactionFetcher interface {
+	FetchTransactionsByHash(ctx context.Context, txHashes []string) ([]TransactionResult, error)
+}
+
+// TransactionResult is the outcome of looking up a single transaction in a batch. Transaction is
+// nil when the node knows no such transaction.
+type TransactionResult struct {
+	Transaction *Transaction
+	Err         error
+}
+
+// FetchTransactionByHash fetches a mined or pending transaction. Pending transactions have no block number.
+func (c *RpcClient) FetchTransactionByHash(ctx context.Context, txHash string) (*Transaction, error) {
+	var tx *Transaction
+	if err := c.call(ctx, "eth_getTransactionByHash", []interface{}{txHash}, &tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// FetchTransactionsByHash fetches several mined or pending transactions in a single batch request
+func (c *RpcClient) FetchTransactionsByHash(ctx context.Context, txHashes []string) ([]TransactionResult, error) {
+	txs := make([]*Transaction, len(txHashes))
+	elems := make([]BatchElem, len(txHashes))
+	for i, hash := range txHashes {
+		elems[i] = BatchElem{
+			Method: "eth_getTransactionByHash",
+			Params: []interface{}{hash},
+			Result: &txs[i],
+		}
+	}
+
+	if err := c.Batch(ctx, elems); err != nil {
+		return nil, err
+	}
+
+	results := make([]TransactionResult, len(txs))
+	for i := range results {
+		results[i] = TransactionResult{Transaction: txs[i], Err: elems[i].Error}
+	}
+	return results, nil
+}
+
+// FetchTransactionByHash fetches a transaction, asking the next endpoint when one does not know it
+// as mempools differ between nodes
+func (p *Pool) FetchTransactionByHash(ctx context.Context, txHash string) (*Transaction, error) {
+	var tx *Transaction
+	err := p.do(ctx, "eth_getTransactionByHash", func(e *endpoint) error {
+		var err error
+		tx, err = e.client.FetchTransactionByHash(ctx, txHash)
+		if err == nil && tx == nil {
+			return errBlockMissing
+		}
+		return err
+	})
+	if errors.Is(err, errBlockMissing) {
+		return nil, nil
+	}
+	return tx, err
+}
+
+// FetchTransactionsByHash fetches several transactions in a single batch from the first endpoint
+// that supports batches and knows every transaction, as mempools differ between nodes. When none
+// knows them all, the results of the last endpoint asked are returned. It returns
+// ErrBatchUnsupported when no available endpoint supports batches.
+func (p *Pool) FetchTransactionsByHash(ctx context.Context, txHashes []string) ([]TransactionResult, error) {
+	var results []TransactionResult
+	err := p.do(ctx, "batch", func(e *endpoint) error {
+		p.mu.RLock()
+		unsupported := e.batchUnsupported
+		p.mu.RUnlock()
+		if unsupported {
+			return ErrBatchUnsupported
+		}
+
+		var err error
+		results, err = e.client.FetchTransactionsByHash(ctx, txHashes)
+		if errors.Is(err, ErrBatchUnsupported) {
+			p.log.Info.Printf("RPC endpoint %s does not support batch requests", e.name)
+			p.mu.Lock()
+			e.batchUnsupported = true
+			p.mu.Unlock()
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Err == nil && result.Transaction == nil {
+				return errBlockMissing
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBlockMissing) {
+		return results, nil
+	}
+	return results, err
+}
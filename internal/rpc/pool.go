@@ -0,0 +1,500 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/internal/interfaces"
+	"tx-parser/pkg/logger"
+)
+
+// Defaults used for pool settings that are not configured
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultMaxHeadLag          = 5
+
+	// latencySmoothing is the weight of the newest sample in an endpoint's moving average latency
+	latencySmoothing = 0.3
+)
+
+// errBlockMissing is used internally when an endpoint does not have a block yet, usually because
+// it is a few blocks behind the others, so the request should fail over to another endpoint
+var errBlockMissing = errors.New("block not available on endpoint")
+
+// endpoint is a single node in a Pool together with its last observed health
+type endpoint struct {
+	client           *RpcClient
+	name             string // URL without credentials, safe to log and expose
+	healthy          bool
+	head             int
+	headKnown        bool
+	latency          time.Duration // Moving average, zero until the first measurement
+	lastError        string
+	lastChecked      time.Time
+	batchUnsupported bool
+	// receiptsUnsupported is set once the endpoint rejects eth_getBlockReceipts
+	receiptsUnsupported bool
+}
+
+// Pool is a Client backed by several endpoints. It health checks every endpoint, routes each
+// request to the healthiest one with the lowest latency, fails over to the next one on errors and
+// refuses endpoints whose head is far behind the others.
+type Pool struct {
+	endpoints  []*endpoint
+	mu         sync.RWMutex
+	retry      RetryPolicy // Applied to a full round over all endpoints
+	interval   time.Duration
+	maxHeadLag int
+	log        *logger.Logger
+}
+
+// NewPool creates a pool for the configured endpoints. Endpoints are assumed healthy until the
+// first health check says otherwise.
+func NewPool(cfg config.RPCConfig, log *logger.Logger) (*Pool, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("no RPC endpoints configured")
+	}
+
+	p := &Pool{
+		retry:      NewRetryPolicy(cfg.Retry),
+		interval:   cfg.HealthCheckInterval,
+		maxHeadLag: cfg.MaxHeadLag,
+		log:        log,
+	}
+	if p.interval <= 0 {
+		p.interval = DefaultHealthCheckInterval
+	}
+	if p.maxHeadLag <= 0 {
+		p.maxHeadLag = DefaultMaxHeadLag
+	}
+
+	httpClient := NewHTTPClient(cfg.ConnectTimeout, cfg.RequestTimeout)
+	for _, endpointURL := range cfg.Endpoints {
+		// Endpoints send each request once; the pool fails over and retries across all of them
+		p.endpoints = append(p.endpoints, &endpoint{
+			client:  NewClient(endpointURL, log).WithHTTPClient(httpClient),
+			name:    redactURL(endpointURL),
+			healthy: true,
+		})
+	}
+	return p, nil
+}
+
+// Run health checks every endpoint until ctx is cancelled
+func (p *Pool) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckHealth queries the head of every endpoint concurrently and records the outcome
+func (p *Pool) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+
+			start := time.Now()
+			head, err := e.client.FetchCurrentBlock(ctx)
+			if ctx.Err() != nil {
+				// Shutting down says nothing about the endpoint's health
+				return
+			}
+			p.observe(e, time.Since(start), err)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			e.lastChecked = time.Now()
+			if err == nil {
+				e.head, e.headKnown = head, true
+				e.healthy = true
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	for _, status := range p.Status() {
+		if !status.Healthy || status.Lagging {
+			p.log.Warn.Printf("RPC endpoint %s is unavailable (healthy: %t, head lag: %d): %s", status.URL, status.Healthy, status.HeadLag, status.LastError)
+		}
+	}
+}
+
+// Status returns the health of every endpoint in configuration order
+func (p *Pool) Status() []interfaces.EndpointStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	maxHead := p.maxHead()
+	statuses := make([]interfaces.EndpointStatus, len(p.endpoints))
+	for i, e := range p.endpoints {
+		statuses[i] = interfaces.EndpointStatus{
+			URL:         e.name,
+			Healthy:     e.healthy,
+			Lagging:     p.lagging(e, maxHead),
+			Head:        e.head,
+			LatencyMs:   float64(e.latency) / float64(time.Millisecond),
+			LastError:   e.lastError,
+			LastChecked: e.lastChecked,
+		}
+		if e.headKnown {
+			statuses[i].HeadLag = maxHead - e.head
+		}
+	}
+	return statuses
+}
+
+func (p *Pool) FetchCurrentBlock(ctx context.Context) (int, error) {
+	var head int
+	err := p.do(ctx, "eth_blockNumber", func(e *endpoint) error {
+		var err error
+		head, err = e.client.FetchCurrentBlock(ctx)
+		if err == nil {
+			p.mu.Lock()
+			if head > e.head {
+				e.head, e.headKnown = head, true
+			}
+			p.mu.Unlock()
+		}
+		return err
+	})
+	return head, err
+}
+
+func (p *Pool) FetchBlockByNumber(ctx context.Context, blockNumber int) (*Block, error) {
+	return p.fetchBlock(ctx, "eth_getBlockByNumber", func(c *RpcClient) (*Block, error) { return c.FetchBlockByNumber(ctx, blockNumber) })
+}
+
+func (p *Pool) FetchBlockByTag(ctx context.Context, tag string) (*Block, error) {
+	return p.fetchBlock(ctx, "eth_getBlockByNumber", func(c *RpcClient) (*Block, error) { return c.FetchBlockByTag(ctx, tag) })
+}
+
+func (p *Pool) FetchHeaderByNumber(ctx context.Context, blockNumber int) (*Block, error) {
+	return p.fetchBlock(ctx, "eth_getBlockByNumber", func(c *RpcClient) (*Block, error) { return c.FetchHeaderByNumber(ctx, blockNumber) })
+}
+
+func (p *Pool) FetchHeaderByHash(ctx context.Context, hash string) (*Block, error) {
+	return p.fetchBlock(ctx, "eth_getBlockByHash", func(c *RpcClient) (*Block, error) { return c.FetchHeaderByHash(ctx, hash) })
+}
+
+// fetchBlock fetches a block from the first endpoint that has it, returning nil if none does
+func (p *Pool) fetchBlock(ctx context.Context, method string, fetch func(c *RpcClient) (*Block, error)) (*Block, error) {
+	var block *Block
+	err := p.do(ctx, method, func(e *endpoint) error {
+		var err error
+		block, err = fetch(e.client)
+		if err == nil && block == nil {
+			return errBlockMissing
+		}
+		return err
+	})
+	if errors.Is(err, errBlockMissing) {
+		return nil, nil
+	}
+	return block, err
+}
+
+// FetchBlockRange fetches blocks from..to in a single batch from the first endpoint that supports
+// batches and has every block. It returns ErrBatchUnsupported when no available endpoint does.
+func (p *Pool) FetchBlockRange(ctx context.Context, from, to int) ([]BlockResult, error) {
+	var results []BlockResult
+	err := p.do(ctx, "batch", func(e *endpoint) error {
+		p.mu.RLock()
+		unsupported := e.batchUnsupported
+		p.mu.RUnlock()
+		if unsupported {
+			return ErrBatchUnsupported
+		}
+
+		var err error
+		results, err = e.client.FetchBlockRange(ctx, from, to)
+		if errors.Is(err, ErrBatchUnsupported) {
+			p.log.Info.Printf("RPC endpoint %s does not support batch requests", e.name)
+			p.mu.Lock()
+			e.batchUnsupported = true
+			p.mu.Unlock()
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Err == nil && result.Block == nil {
+				return errBlockMissing
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBlockMissing) {
+		// No endpoint has every block yet, let the caller handle the missing ones
+		return results, nil
+	}
+	return results, err
+}
+
+// FetchTransactionReceipt fetches a receipt from the first endpoint that has it, returning nil if none does
+func (p *Pool) FetchTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var receipt *Receipt
+	err := p.do(ctx, "eth_getTransactionReceipt", func(e *endpoint) error {
+		var err error
+		receipt, err = e.client.FetchTransactionReceipt(ctx, txHash)
+		if err == nil && receipt == nil {
+			return errBlockMissing
+		}
+		return err
+	})
+	if errors.Is(err, errBlockMissing) {
+		return nil, nil
+	}
+	return receipt, err
+}
+
+// FetchBlockReceipts fetches the receipts of a block from the first endpoint that supports
+// eth_getBlockReceipts and has the block. It returns ErrBlockReceiptsUnsupported when no available
+// endpoint does.
+func (p *Pool) FetchBlockReceipts(ctx context.Context, blockNumber int) ([]*Receipt, error) {
+	var receipts []*Receipt
+	err := p.do(ctx, "eth_getBlockReceipts", func(e *endpoint) error {
+		p.mu.RLock()
+		unsupported := e.receiptsUnsupported
+		p.mu.RUnlock()
+		if unsupported {
+			return ErrBlockReceiptsUnsupported
+		}
+
+		var err error
+		receipts, err = e.client.FetchBlockReceipts(ctx, blockNumber)
+		if errors.Is(err, ErrBlockReceiptsUnsupported) {
+			p.log.Info.Printf("RPC endpoint %s does not support eth_getBlockReceipts", e.name)
+			p.mu.Lock()
+			e.receiptsUnsupported = true
+			p.mu.Unlock()
+			return err
+		}
+		if err == nil && receipts == nil {
+			return errBlockMissing
+		}
+		return err
+	})
+	if errors.Is(err, errBlockMissing) {
+		return nil, nil
+	}
+	return receipts, err
+}
+
+// FetchLogs fetches logs from the first endpoint that answers
+func (p *Pool) FetchLogs(ctx context.Context, filter LogFilter) ([]Log, error) {
+	var logs []Log
+	err := p.do(ctx, "eth_getLogs", func(e *endpoint) error {
+		var err error
+		logs, err = e.client.FetchLogs(ctx, filter)
+		return err
+	})
+	return logs, err
+}
+
+// FetchBlockLogs fetches the logs of several blocks in a single batch from the first endpoint that
+// supports batches. It returns ErrBatchUnsupported when no available endpoint does.
+func (p *Pool) FetchBlockLogs(ctx context.Context, blockHashes []string, topics [][]string) ([]LogsResult, error) {
+	var results []LogsResult
+	err := p.do(ctx, "batch", func(e *endpoint) error {
+		p.mu.RLock()
+		unsupported := e.batchUnsupported
+		p.mu.RUnlock()
+		if unsupported {
+			return ErrBatchUnsupported
+		}
+
+		var err error
+		results, err = e.client.FetchBlockLogs(ctx, blockHashes, topics)
+		if errors.Is(err, ErrBatchUnsupported) {
+			p.log.Info.Printf("RPC endpoint %s does not support batch requests", e.name)
+			p.mu.Lock()
+			e.batchUnsupported = true
+			p.mu.Unlock()
+		}
+		return err
+	})
+	return results, err
+}
+
+// CallContract executes a read-only call on the first endpoint that answers
+func (p *Pool) CallContract(ctx context.Context, to, data string) (string, error) {
+	var result string
+	err := p.do(ctx, "eth_call", func(e *endpoint) error {
+		var err error
+		result, err = e.client.CallContract(ctx, to, data)
+		return err
+	})
+	return result, err
+}
+
+// DebugTraceBlock traces a block on the first endpoint that supports the debug API. It returns
+// ErrTracingUnsupported when no available endpoint does.
+func (p *Pool) DebugTraceBlock(ctx context.Context, blockNumber int) ([]CallTrace, error) {
+	var traces []CallTrace
+	err := p.do(ctx, "debug_traceBlockByNumber", func(e *endpoint) error {
+		var err error
+		traces, err = e.client.DebugTraceBlock(ctx, blockNumber)
+		return err
+	})
+	return traces, err
+}
+
+// TraceBlock traces a block on the first endpoint that supports the trace API. It returns
+// ErrTracingUnsupported when no available endpoint does.
+func (p *Pool) TraceBlock(ctx context.Context, blockNumber int) ([]ParityTrace, error) {
+	var traces []ParityTrace
+	err := p.do(ctx, "trace_block", func(e *endpoint) error {
+		var err error
+		traces, err = e.client.TraceBlock(ctx, blockNumber)
+		return err
+	})
+	return traces, err
+}
+
+// do runs fn against the available endpoints in order of preference until one succeeds or ctx is
+// done. Rounds over all endpoints are retried according to the pool's retry policy. JSON-RPC errors
+// are returned as is, and only transport failures, timeouts, server errors and rate limiting mark
+// an endpoint unhealthy.
+func (p *Pool) do(ctx context.Context, method string, fn func(e *endpoint) error) error {
+	return p.retry.run(ctx, p.log, method, func() error {
+		err := fmt.Errorf("no RPC endpoint available")
+		for _, e := range p.candidates() {
+			start := time.Now()
+			err = fn(e)
+			if ctx.Err() != nil {
+				// The caller gave up, which says nothing about the endpoint's health
+				return err
+			}
+			if errors.Is(err, errBlockMissing) || errors.Is(err, ErrBatchUnsupported) || errors.Is(err, ErrBlockReceiptsUnsupported) || errors.Is(err, ErrTracingUnsupported) {
+				// The endpoint answered, it just cannot serve this request
+				p.observe(e, time.Since(start), nil)
+				continue
+			}
+			var rpcErr *RPCError
+			if errors.Is(err, ErrExecutionReverted) || errors.As(err, &rpcErr) {
+				// The node answered the call with an error, every endpoint would give the same answer
+				p.observe(e, time.Since(start), nil)
+				return err
+			}
+			if err != nil && !endpointFailed(err) {
+				// The endpoint answered but the answer was unusable, which does not make it unhealthy
+				p.log.Warn.Printf("%s failed on RPC endpoint %s: %v", method, e.name, err)
+				continue
+			}
+			p.observe(e, time.Since(start), err)
+			if err == nil {
+				return nil
+			}
+			p.log.Warn.Printf("%s failed on RPC endpoint %s: %v", method, e.name, err)
+		}
+		return err
+	})
+}
+
+// endpointFailed reports whether an error means the endpoint itself failed: the request did not
+// get through or timed out, or the endpoint answered with a server error or rate limiting
+func endpointFailed(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// observe records the latency and outcome of a request to an endpoint. A failed request marks the
+// endpoint unhealthy until its next successful health check.
+func (p *Pool) observe(e *endpoint, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		e.healthy = false
+		e.lastError = err.Error()
+		return
+	}
+	e.lastError = ""
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(float64(e.latency)*(1-latencySmoothing) + float64(latency)*latencySmoothing)
+	}
+}
+
+// candidates returns the endpoints that are not lagging: healthy ones by latency, followed by
+// unhealthy ones as a last resort
+func (p *Pool) candidates() []*endpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	maxHead := p.maxHead()
+	var healthy, unhealthy []*endpoint
+	for _, e := range p.endpoints {
+		switch {
+		case p.lagging(e, maxHead):
+		case e.healthy:
+			healthy = append(healthy, e)
+		default:
+			unhealthy = append(unhealthy, e)
+		}
+	}
+
+	// Endpoints without a latency measurement yet go after the measured ones
+	sort.SliceStable(healthy, func(i, j int) bool {
+		a, b := healthy[i].latency, healthy[j].latency
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+	return append(healthy, unhealthy...)
+}
+
+// maxHead returns the highest head reported by a healthy endpoint; callers must hold mu
+func (p *Pool) maxHead() int {
+	maxHead := 0
+	for _, e := range p.endpoints {
+		if e.healthy && e.headKnown && e.head > maxHead {
+			maxHead = e.head
+		}
+	}
+	return maxHead
+}
+
+// lagging reports whether an endpoint is too far behind the highest head; callers must hold mu.
+// Endpoints whose head is not known yet get the benefit of the doubt.
+func (p *Pool) lagging(e *endpoint, maxHead int) bool {
+	return e.headKnown && maxHead-e.head > p.maxHeadLag
+}
+
+// redactURL keeps only the scheme and host of an endpoint URL, as paths and queries often carry API keys
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "invalid endpoint"
+	}
+	name := u.Scheme + "://" + u.Host
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		name += "/..."
+	}
+	return name
+}
@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+)
+
+// ErrBlockReceiptsUnsupported is returned when the node does not implement eth_getBlockReceipts
+var ErrBlockReceiptsUnsupported = errors.New("node does not support eth_getBlockReceipts")
+
+// codeMethodNotFound is the JSON-RPC error code for methods the node does not implement
+const codeMethodNotFound = -32601
+
+// BlockReceiptsClient is implemented by clients that can fetch all receipts of a block in one call
+type BlockReceiptsClient interface {
+	FetchBlockReceipts(ctx context.Context, blockNumber int) ([]*Receipt, error)
+}
+
+// Receipt is a transaction receipt as returned by the node, with quantities hex encoded
+type Receipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	BlockHash         string `json:"blockHash"`
+	Status            string `json:"status"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	ContractAddress   string `json:"contractAddress"`
+}
+
+// FetchTransactionReceipt fetches the receipt of a transaction, or nil if it is not mined yet
+func (c *RpcClient) FetchTransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var receipt *Receipt
+	if err := c.call(ctx, "eth_getTransactionReceipt", []interface{}{txHash}, &receipt); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// FetchBlockReceipts fetches the receipts of every transaction in a block, or nil if the node
+// does not have the block yet
+func (c *RpcClient) FetchBlockReceipts(ctx context.Context, blockNumber int) ([]*Receipt, error) {
+	var receipts []*Receipt
+	err := c.call(ctx, "eth_getBlockReceipts", []interface{}{fmt.Sprintf("0x%x", blockNumber)}, &receipts)
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == codeMethodNotFound {
+		return nil, ErrBlockReceiptsUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// ApplyReceipt adds the outcome of a transaction from its receipt. Nodes that predate
+// effectiveGasPrice only report the gas price the transaction offered, which is what it paid.
+func ApplyReceipt(tx *interfaces.Transaction, receipt *Receipt) error {
+	switch receipt.Status {
+	case "0x1":
+		tx.ReceiptStatus = interfaces.ReceiptSuccess
+	case "0x0":
+		tx.ReceiptStatus = interfaces.ReceiptFailed
+	default:
+		return fmt.Errorf("unexpected status %q in receipt of transaction %s", receipt.Status, tx.Hash)
+	}
+
+	gasUsed, err := parseHexUint64(receipt.GasUsed)
+	if err != nil {
+		return fmt.Errorf("invalid gasUsed in receipt of transaction %s: %w", tx.Hash, err)
+	}
+	effectiveGasPrice, err := parseHexBig(receipt.EffectiveGasPrice)
+	if err != nil {
+		return fmt.Errorf("invalid effectiveGasPrice in receipt of transaction %s: %w", tx.Hash, err)
+	}
+	if effectiveGasPrice == nil {
+		effectiveGasPrice = tx.GasPrice
+	}
+
+	tx.GasUsed = gasUsed
+	tx.EffectiveGasPrice = effectiveGasPrice
+	if effectiveGasPrice != nil {
+		tx.Fee = new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), effectiveGasPrice)
+	}
+	tx.ContractAddress = utils.NormalizeAddress(receipt.ContractAddress)
+	return nil
+}
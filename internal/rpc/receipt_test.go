@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"tx-parser/internal/interfaces"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test FetchTransactionReceipt with a mined transaction
+func TestFetchTransactionReceipt(t *testing.T) {
+	mockServer := newMockServer(`{"jsonrpc":"2.0","id":1,"result":{"transactionHash":"0x1","blockHash":"0xb1","status":"0x0","gasUsed":"0x5208","effectiveGasPrice":"0x3b9aca00","contractAddress":null}}`)
+	defer mockServer.Close()
+	client := NewClient(mockServer.URL, logger.GetLogger("debug"))
+
+	receipt, err := client.FetchTransactionReceipt(context.Background(), "0x1")
+	assert.Nil(t, err, "Expected no error when fetching a receipt")
+	assert.Equal(t, "0x0", receipt.Status, "Status should be returned")
+	assert.Equal(t, "0xb1", receipt.BlockHash, "Block hash should be returned")
+	assert.Empty(t, receipt.ContractAddress, "Contract address should be empty for calls")
+}
+
+// Test FetchTransactionReceipt with a transaction that is not mined yet
+func TestFetchTransactionReceipt_Pending(t *testing.T) {
+	mockServer := newMockServer(`{"jsonrpc":"2.0","id":1,"result":null}`)
+	defer mockServer.Close()
+	client := NewClient(mockServer.URL, logger.GetLogger("debug"))
+
+	receipt, err := client.FetchTransactionReceipt(context.Background(), "0x1")
+	assert.Nil(t, err, "Expected no error for a pending transaction")
+	assert.Nil(t, receipt, "Expected no receipt for a pending transaction")
+}
+
+// Test FetchBlockReceipts with a node that does not implement it
+func TestFetchBlockReceipts_Unsupported(t *testing.T) {
+	mockServer := newMockServer(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"the method eth_getBlockReceipts does not exist/is not available"}}`)
+	defer mockServer.Close()
+	client := NewClient(mockServer.URL, logger.GetLogger("debug"))
+
+	_, err := client.FetchBlockReceipts(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrBlockReceiptsUnsupported, "Method not found should report eth_getBlockReceipts as unsupported")
+}
+
+// Test that the fee is gas used times the effective gas price
+func TestApplyReceipt(t *testing.T) {
+	tx := interfaces.Transaction{Hash: "0x1"}
+	err := ApplyReceipt(&tx, &Receipt{Status: "0x1", GasUsed: "0x5208", EffectiveGasPrice: "0x3b9aca00", ContractAddress: "0xABC"})
+	assert.Nil(t, err, "Expected no error when applying a receipt")
+	assert.Equal(t, interfaces.ReceiptSuccess, tx.ReceiptStatus, "Status 1 should be a success")
+	assert.Equal(t, uint64(21000), tx.GasUsed, "Gas used should be decoded")
+	assert.Equal(t, "21000000000000", tx.Fee.String(), "Fee should be gas used times effective gas price")
+	assert.Equal(t, "0xabc", tx.ContractAddress, "Contract address should be normalized")
+}
+
+// Test that receipts without an effective gas price fall back to the transaction's gas price
+func TestApplyReceipt_LegacyNode(t *testing.T) {
+	tx := interfaces.Transaction{Hash: "0x1", GasPrice: big.NewInt(2)}
+	err := ApplyReceipt(&tx, &Receipt{Status: "0x0", GasUsed: "0x10"})
+	assert.Nil(t, err, "Expected no error when applying a receipt")
+	assert.Equal(t, interfaces.ReceiptFailed, tx.ReceiptStatus, "Status 0 should be a failure")
+	assert.Equal(t, "32", tx.Fee.String(), "Fee should use the gas price")
+}
+
+// Test that a receipt without a status is rejected
+func TestApplyReceipt_Invalid(t *testing.T) {
+	tx := interfaces.Transaction{Hash: "0x1"}
+	assert.NotNil(t, ApplyReceipt(&tx, &Receipt{GasUsed: "0x10"}), "Expected an error for a receipt without status")
+}
@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/pkg/logger"
+)
+
+// Defaults used for retry settings that are not configured
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+	DefaultJitter         = 0.2
+)
+
+var (
+	// DefaultRetryStatusCodes are HTTP status codes that usually indicate a transient node problem
+	DefaultRetryStatusCodes = []int{429, 500, 502, 503, 504}
+	// DefaultRetryRPCCodes are JSON-RPC error codes for rate limiting and internal node errors
+	DefaultRetryRPCCodes = []int{-32005, -32603}
+)
+
+// StatusError is returned when the node answers with a non-200 HTTP status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxAttempts      int // Total attempts including the first one
+	InitialBackoff   time.Duration
+	MaxBackoff       time.Duration
+	Jitter           float64 // Fraction of each backoff that is randomized, between 0 and 1
+	RetryStatusCodes []int
+	RetryRPCCodes    []int
+}
+
+// NewRetryPolicy builds a retry policy from configuration, applying defaults for unset values. A
+// jitter of 0 and empty code lists are respected, only a nil jitter or nil lists get the defaults.
+func NewRetryPolicy(cfg config.RetryConfig) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts:      cfg.MaxAttempts,
+		InitialBackoff:   cfg.InitialBackoff,
+		MaxBackoff:       cfg.MaxBackoff,
+		Jitter:           DefaultJitter,
+		RetryStatusCodes: cfg.RetryStatusCodes,
+		RetryRPCCodes:    cfg.RetryRPCCodes,
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultMaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultInitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Jitter != nil && *cfg.Jitter >= 0 && *cfg.Jitter <= 1 {
+		policy.Jitter = *cfg.Jitter
+	}
+	if policy.RetryStatusCodes == nil {
+		policy.RetryStatusCodes = DefaultRetryStatusCodes
+	}
+	if policy.RetryRPCCodes == nil {
+		policy.RetryRPCCodes = DefaultRetryRPCCodes
+	}
+	return policy
+}
+
+// Retryable reports whether a failed request should be attempted again
+func (p RetryPolicy) Retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return containsCode(p.RetryStatusCodes, statusErr.StatusCode)
+	}
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return containsCode(p.RetryRPCCodes, rpcErr.Code)
+	}
+
+	// Connection failures and timeouts never reached the node or got no answer
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// Backoff returns the delay before the given retry (1 for the first retry), including jitter
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	// Spread retries from many clients so they do not hit the node at the same moment
+	jitter := (rand.Float64()*2 - 1) * p.Jitter * float64(backoff)
+	return backoff + time.Duration(jitter)
+}
+
+// withRetry runs fn according to the client's retry policy
+func (c *RpcClient) withRetry(ctx context.Context, method string, fn func() error) error {
+	return c.retry.run(ctx, c.log, method, fn)
+}
+
+// run calls fn until it succeeds, fails with a non-retryable error, runs out of attempts or ctx is done
+func (p RetryPolicy) run(ctx context.Context, log *logger.Logger, method string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt >= p.MaxAttempts || !p.Retryable(err) {
+			return err
+		}
+
+		delay := p.Backoff(attempt)
+		log.Warn.Printf("%s failed (attempt %d/%d), retrying in %s: %v", method, attempt, p.MaxAttempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRetryPolicy retries quickly so tests stay fast
+func testRetryPolicy() RetryPolicy {
+	return NewRetryPolicy(config.RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	})
+}
+
+// newFlakyServer answers the first failures requests with the given status and body, then succeeds
+func newFlakyServer(failures int, status int, body string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+			return
+		}
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":"0xa"}`)
+	}))
+	return server, &requests
+}
+
+// Test that transient HTTP errors are retried until the request succeeds
+func TestRetry_StatusCode(t *testing.T) {
+	server, requests := newFlakyServer(2, http.StatusBadGateway, "bad gateway")
+	defer server.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(server.URL, log).WithRetryPolicy(testRetryPolicy())
+
+	blockNumber, err := client.FetchCurrentBlock(context.Background())
+	assert.Nil(t, err, "Expected the request to succeed after retrying")
+	assert.Equal(t, 10, blockNumber, "Expected block number to be 10 (0xa in hex)")
+	assert.Equal(t, 3, *requests, "Expected 2 failed attempts and 1 successful attempt")
+}
+
+// Test that retries stop after the maximum number of attempts
+func TestRetry_MaxAttempts(t *testing.T) {
+	server, requests := newFlakyServer(10, http.StatusServiceUnavailable, "unavailable")
+	defer server.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(server.URL, log).WithRetryPolicy(testRetryPolicy())
+
+	_, err := client.FetchCurrentBlock(context.Background())
+	assert.NotNil(t, err, "Expected an error once attempts are exhausted")
+	assert.Equal(t, 3, *requests, "Expected exactly 3 attempts")
+}
+
+// Test that non-retryable HTTP errors fail immediately
+func TestRetry_NonRetryableStatusCode(t *testing.T) {
+	server, requests := newFlakyServer(10, http.StatusBadRequest, "bad request")
+	defer server.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(server.URL, log).WithRetryPolicy(testRetryPolicy())
+
+	_, err := client.FetchCurrentBlock(context.Background())
+	assert.NotNil(t, err, "Expected an error for a bad request")
+	assert.Equal(t, 1, *requests, "Expected a single attempt")
+}
+
+// Test that only configured JSON-RPC error codes are retried
+func TestRetry_RPCErrorCode(t *testing.T) {
+	server, requests := newFlakyServer(1, http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"limit exceeded"}}`)
+	defer server.Close()
+
+	log := logger.GetLogger("debug")
+	client := NewClient(server.URL, log).WithRetryPolicy(testRetryPolicy())
+
+	block, err := client.FetchBlockByNumber(context.Background(), 1)
+	assert.NotNil(t, err, "Expected the retried response to fail to decode as a block")
+	assert.Nil(t, block, "Expected block to be nil on error")
+	assert.Equal(t, 2, *requests, "Expected the rate limited request to be retried")
+
+	server, requests = newFlakyServer(1, http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`)
+	defer server.Close()
+	client = NewClient(server.URL, log).WithRetryPolicy(testRetryPolicy())
+
+	_, err = client.FetchBlockByNumber(context.Background(), 1)
+	assert.Contains(t, err.Error(), "header not found", "Expected the node's error")
+	assert.Equal(t, 1, *requests, "Expected a single attempt for a non-retryable error code")
+}
+
+// Test that connection failures are retried
+func TestRetry_ConnectionError(t *testing.T) {
+	server, _ := newFlakyServer(0, http.StatusOK, "")
+	url := server.URL
+	server.Close()
+
+	log := logger.GetLogger("debug")
+	policy := testRetryPolicy()
+	client := NewClient(url, log).WithRetryPolicy(policy)
+
+	_, err := client.FetchCurrentBlock(context.Background())
+	assert.NotNil(t, err, "Expected an error for an unreachable node")
+	assert.True(t, policy.Retryable(err), "Expected connection failures to be retryable")
+}
+
+// Test that backoff grows exponentially up to the maximum, within the jitter bounds
+func TestBackoff(t *testing.T) {
+	jitter := 0.1
+	policy := NewRetryPolicy(config.RetryConfig{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Jitter:         &jitter,
+	})
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, base := range expected {
+		for j := 0; j < 20; j++ {
+			backoff := policy.Backoff(i + 1)
+			assert.GreaterOrEqual(t, backoff, base*9/10, "Backoff should not go below the jitter range")
+			assert.LessOrEqual(t, backoff, base*11/10, "Backoff should not go above the jitter range")
+		}
+	}
+}
+
+// Test that explicit zero jitter and empty code lists are kept instead of being replaced by defaults
+func TestNewRetryPolicy_Unset(t *testing.T) {
+	policy := NewRetryPolicy(config.RetryConfig{})
+	assert.Equal(t, DefaultJitter, policy.Jitter, "Unset jitter should use the default")
+	assert.Equal(t, DefaultRetryStatusCodes, policy.RetryStatusCodes, "Unset status codes should use the defaults")
+	assert.Equal(t, DefaultRetryRPCCodes, policy.RetryRPCCodes, "Unset RPC codes should use the defaults")
+
+	jitter := 0.0
+	policy = NewRetryPolicy(config.RetryConfig{
+		InitialBackoff:   100 * time.Millisecond,
+		Jitter:           &jitter,
+		RetryStatusCodes: []int{},
+		RetryRPCCodes:    []int{},
+	})
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1), "Zero jitter should keep the backoff exact")
+	assert.False(t, policy.Retryable(&StatusError{StatusCode: 503}), "Empty status codes should retry no status")
+	assert.False(t, policy.Retryable(&RPCError{Code: -32005}), "Empty RPC codes should retry no code")
+}
@@ -0,0 +1,231 @@
+package rpc
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+	"unicode/utf8"
+)
+
+// Topics of the token transfer events
+const (
+	// TransferTopic is the topic of Transfer(address,address,uint256), shared by ERC-20 and ERC-721
+	// tokens. ERC-721 transfers index the token id as a third topic instead of logging an amount.
+	TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	// TransferSingleTopic is the topic of the ERC-1155 TransferSingle(address,address,address,uint256,uint256)
+	TransferSingleTopic = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+	// TransferBatchTopic is the topic of the ERC-1155 TransferBatch(address,address,address,uint256[],uint256[])
+	TransferBatchTopic = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+)
+
+// TokenTransferTopics lists the topics of every token transfer event that can be decoded
+var TokenTransferTopics = []string{TransferTopic, TransferSingleTopic, TransferBatchTopic}
+
+// Selectors of the optional ERC-20 metadata getters
+const (
+	SymbolSelector   = "0x95d89b41" // symbol()
+	DecimalsSelector = "0x313ce567" // decimals()
+)
+
+// ErrExecutionReverted is returned when a call reverts, which is the contract's answer rather than a node failure
+var ErrExecutionReverted = errors.New("execution reverted")
+
+// codeExecutionReverted is the JSON-RPC error code geth uses for reverts that carry revert data
+const codeExecutionReverted = 3
+
+// CallContract executes a read-only call against the latest block and returns the hex encoded result
+func (c *RpcClient) CallContract(ctx context.Context, to, data string) (string, error) {
+	var result string
+	call := map[string]string{"to": to, "data": data}
+	err := c.call(ctx, "eth_call", []interface{}{call, "latest"}, &result)
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && (rpcErr.Code == codeExecutionReverted || strings.Contains(strings.ToLower(rpcErr.Message), "revert")) {
+		return "", fmt.Errorf("%w: %v", ErrExecutionReverted, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// ParseTokenTransfer decodes an ERC-20, ERC-721 or ERC-1155 transfer log into a token transfer
+// record. ok is false for logs that are not token transfers.
+func ParseTokenTransfer(log Log) (tx interfaces.Transaction, ok bool, err error) {
+	if len(log.Topics) == 0 || log.Removed {
+		return interfaces.Transaction{}, false, nil
+	}
+
+	// Find where the event keeps its participants, and decode what it moved
+	token := &interfaces.TokenTransfer{Contract: utils.NormalizeAddress(log.Address)}
+	var from, to, kind string
+	switch {
+	case log.Topics[0] == TransferTopic && len(log.Topics) == 3:
+		kind, from, to = interfaces.KindERC20, log.Topics[1], log.Topics[2]
+		if token.Amount, err = DecodeABIUint(log.Data); err != nil {
+			return interfaces.Transaction{}, false, fmt.Errorf("invalid amount in transfer log of transaction %s: %w", log.TransactionHash, err)
+		}
+	case log.Topics[0] == TransferTopic && len(log.Topics) == 4:
+		kind, from, to = interfaces.KindERC721, log.Topics[1], log.Topics[2]
+		id, err := DecodeABIUint(log.Topics[3])
+		if err != nil {
+			return interfaces.Transaction{}, false, fmt.Errorf("invalid token id in transfer log of transaction %s: %w", log.TransactionHash, err)
+		}
+		token.TokenIDs, token.Quantities = []*big.Int{id}, []*big.Int{big.NewInt(1)}
+	case log.Topics[0] == TransferSingleTopic && len(log.Topics) == 4:
+		kind, from, to = interfaces.KindERC1155, log.Topics[2], log.Topics[3]
+		values, err := decodeABIUints(log.Data, 2)
+		if err != nil {
+			return interfaces.Transaction{}, false, fmt.Errorf("invalid data in transfer log of transaction %s: %w", log.TransactionHash, err)
+		}
+		token.TokenIDs, token.Quantities = values[:1], values[1:]
+	case log.Topics[0] == TransferBatchTopic && len(log.Topics) == 4:
+		kind, from, to = interfaces.KindERC1155, log.Topics[2], log.Topics[3]
+		if token.TokenIDs, token.Quantities, err = decodeABIUintArrays(log.Data); err != nil {
+			return interfaces.Transaction{}, false, fmt.Errorf("invalid data in transfer log of transaction %s: %w", log.TransactionHash, err)
+		}
+	default:
+		return interfaces.Transaction{}, false, nil
+	}
+	if kind == interfaces.KindERC1155 {
+		if token.Operator, err = topicAddress(log.Topics[1]); err != nil {
+			return interfaces.Transaction{}, false, fmt.Errorf("invalid operator in transfer log of transaction %s: %w", log.TransactionHash, err)
+		}
+	}
+
+	tx, token.LogIndex, err = parseLogRecord(log)
+	if err != nil {
+		return interfaces.Transaction{}, false, err
+	}
+	if tx.From, err = topicAddress(from); err != nil {
+		return interfaces.Transaction{}, false, fmt.Errorf("invalid sender in transfer log of transaction %s: %w", log.TransactionHash, err)
+	}
+	if tx.To, err = topicAddress(to); err != nil {
+		return interfaces.Transaction{}, false, fmt.Errorf("invalid recipient in transfer log of transaction %s: %w", log.TransactionHash, err)
+	}
+
+	tx.Kind = kind
+	tx.Value = new(big.Int) // No ether moves with a token transfer
+	tx.Token = token
+	return tx, true, nil
+}
+
+// DecodeABIUint decodes a single ABI encoded unsigned integer
+func DecodeABIUint(data string) (*big.Int, error) {
+	raw, err := decodeHexData(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("expected 32 bytes, got %d", len(raw))
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// DecodeABIString decodes a single ABI encoded string. Some early tokens return their symbol as
+// bytes32 instead, which is decoded up to the first zero byte.
+func DecodeABIString(data string) (string, error) {
+	raw, err := decodeHexData(data)
+	if err != nil {
+		return "", err
+	}
+
+	if len(raw) == 32 {
+		if end := strings.IndexByte(string(raw), 0); end >= 0 {
+			raw = raw[:end]
+		}
+		if !utf8.Valid(raw) {
+			return "", fmt.Errorf("bytes32 value is not valid UTF-8")
+		}
+		return string(raw), nil
+	}
+
+	if len(raw) < 64 {
+		return "", fmt.Errorf("expected at least 64 bytes, got %d", len(raw))
+	}
+	offset := new(big.Int).SetBytes(raw[:32])
+	if !offset.IsInt64() || offset.Int64()+32 > int64(len(raw)) {
+		return "", fmt.Errorf("string offset %s out of range", offset)
+	}
+	start := int(offset.Int64()) + 32
+	length := new(big.Int).SetBytes(raw[start-32 : start])
+	if !length.IsInt64() || int64(start)+length.Int64() > int64(len(raw)) {
+		return "", fmt.Errorf("string length %s out of range", length)
+	}
+	value := raw[start : start+int(length.Int64())]
+	if !utf8.Valid(value) {
+		return "", fmt.Errorf("string is not valid UTF-8")
+	}
+	return string(value), nil
+}
+
+// decodeABIUints decodes n consecutive ABI encoded unsigned integers
+func decodeABIUints(data string, n int) ([]*big.Int, error) {
+	raw, err := decodeHexData(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32*n {
+		return nil, fmt.Errorf("expected %d bytes, got %d", 32*n, len(raw))
+	}
+	values := make([]*big.Int, n)
+	for i := range values {
+		values[i] = new(big.Int).SetBytes(raw[32*i : 32*(i+1)])
+	}
+	return values, nil
+}
+
+// decodeABIUintArrays decodes two ABI encoded uint256[] of the same length, such as the ids and
+// values of an ERC-1155 TransferBatch
+func decodeABIUintArrays(data string) ([]*big.Int, []*big.Int, error) {
+	raw, err := decodeHexData(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) < 64 {
+		return nil, nil, fmt.Errorf("expected at least 64 bytes, got %d", len(raw))
+	}
+
+	arrays := make([][]*big.Int, 2)
+	for i := range arrays {
+		// The head holds the offset of each array, which starts with its length
+		start, err := abiInt(raw[32*i:32*(i+1)], len(raw)-32)
+		if err != nil {
+			return nil, nil, err
+		}
+		length, err := abiInt(raw[start:start+32], (len(raw)-start-32)/32)
+		if err != nil {
+			return nil, nil, err
+		}
+		for j := 0; j < length; j++ {
+			offset := start + 32 + 32*j
+			arrays[i] = append(arrays[i], new(big.Int).SetBytes(raw[offset:offset+32]))
+		}
+	}
+	if len(arrays[0]) != len(arrays[1]) {
+		return nil, nil, fmt.Errorf("%d ids but %d values", len(arrays[0]), len(arrays[1]))
+	}
+	return arrays[0], arrays[1], nil
+}
+
+// abiInt decodes a word used as an offset or length, which must not exceed max
+func abiInt(word []byte, max int) (int, error) {
+	value := new(big.Int).SetBytes(word)
+	if !value.IsInt64() || value.Int64() > int64(max) {
+		return 0, fmt.Errorf("offset or length %s out of range", value)
+	}
+	return int(value.Int64()), nil
+}
+
+// decodeHexData decodes 0x prefixed hex data into bytes
+func decodeHexData(data string) ([]byte, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data: %w", err)
+	}
+	return raw, nil
+}
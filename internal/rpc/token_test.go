@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"fmt"
+	"testing"
+	"tx-parser/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test decoding an ERC-20 transfer log
+func TestParseTokenTransfer_ERC20(t *testing.T) {
+	log := Log{
+		Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+		Topics: []string{
+			TransferTopic,
+			"0x000000000000000000000000ab5801a7d398351b8be11c439e05c5b3259aec9b",
+			"0x0000000000000000000000004bbeeb066ed09b7aed07bf39eee0460dfa261520",
+		},
+		Data:             "0x00000000000000000000000000000000000000000000000000000000000f4240",
+		BlockNumber:      "0x10",
+		BlockHash:        "0xb1",
+		TransactionHash:  "0x1",
+		TransactionIndex: "0x2",
+		LogIndex:         "0x5",
+	}
+
+	tx, ok, err := ParseTokenTransfer(log)
+	assert.Nil(t, err, "Expected no error when decoding a transfer")
+	assert.True(t, ok, "Log should be an ERC-20 transfer")
+	assert.Equal(t, interfaces.KindERC20, tx.Kind, "Kind should be erc20")
+	assert.Equal(t, "0xab5801a7d398351b8be11c439e05c5b3259aec9b", tx.From, "Sender should come from the first indexed topic")
+	assert.Equal(t, "0x4bbeeb066ed09b7aed07bf39eee0460dfa261520", tx.To, "Recipient should come from the second indexed topic")
+	assert.Equal(t, "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", tx.Token.Contract, "Contract should be normalized")
+	assert.Equal(t, "1000000", tx.Token.Amount.String(), "Amount should be decoded from the data")
+	assert.Equal(t, 5, tx.Token.LogIndex, "Log index should be decoded")
+	assert.Equal(t, 16, tx.BlockNumber, "Block number should be decoded")
+	assert.Equal(t, 0, tx.Value.Sign(), "No ether should be moved")
+}
+
+// Test decoding an ERC-721 transfer, which indexes the token id
+func TestParseTokenTransfer_ERC721(t *testing.T) {
+	log := Log{
+		Address: "0xcollection",
+		Topics:  []string{TransferTopic, fmt.Sprintf("0x%064x", 1), fmt.Sprintf("0x%064x", 2), fmt.Sprintf("0x%064x", 42)},
+		Data:    "0x",
+	}
+
+	tx, ok, err := ParseTokenTransfer(log)
+	assert.Nil(t, err, "Expected no error when decoding a transfer")
+	assert.True(t, ok, "Log should be a token transfer")
+	assert.Equal(t, interfaces.KindERC721, tx.Kind, "Kind should be erc721")
+	assert.Equal(t, fmt.Sprintf("0x%040x", 2), tx.To, "Recipient should come from the second indexed topic")
+	assert.Equal(t, "42", tx.Token.TokenIDs[0].String(), "Token id should come from the third indexed topic")
+	assert.Equal(t, "1", tx.Token.Quantities[0].String(), "An ERC-721 token is unique")
+	assert.Nil(t, tx.Token.Amount, "NFT transfers have no amount")
+}
+
+// Test decoding an ERC-1155 TransferSingle, which logs the id and value
+func TestParseTokenTransfer_ERC1155Single(t *testing.T) {
+	log := Log{
+		Address: "0xcollection",
+		Topics:  []string{TransferSingleTopic, fmt.Sprintf("0x%064x", 9), fmt.Sprintf("0x%064x", 1), fmt.Sprintf("0x%064x", 2)},
+		Data:    fmt.Sprintf("0x%064x%064x", 7, 3),
+	}
+
+	tx, ok, err := ParseTokenTransfer(log)
+	assert.Nil(t, err, "Expected no error when decoding a transfer")
+	assert.True(t, ok, "Log should be a token transfer")
+	assert.Equal(t, interfaces.KindERC1155, tx.Kind, "Kind should be erc1155")
+	assert.Equal(t, fmt.Sprintf("0x%040x", 9), tx.Token.Operator, "Operator should come from the first indexed topic")
+	assert.Equal(t, fmt.Sprintf("0x%040x", 1), tx.From, "Sender should come from the second indexed topic")
+	assert.Equal(t, fmt.Sprintf("0x%040x", 2), tx.To, "Recipient should come from the third indexed topic")
+	assert.Equal(t, "7", tx.Token.TokenIDs[0].String(), "Token id should be decoded")
+	assert.Equal(t, "3", tx.Token.Quantities[0].String(), "Quantity should be decoded")
+}
+
+// Test decoding an ERC-1155 TransferBatch, which logs arrays of ids and values
+func TestParseTokenTransfer_ERC1155Batch(t *testing.T) {
+	data := fmt.Sprintf("0x%064x%064x", 64, 160) + // Offsets of ids and values
+		fmt.Sprintf("%064x%064x%064x", 2, 7, 8) + // ids
+		fmt.Sprintf("%064x%064x%064x", 2, 3, 4) // values
+	log := Log{
+		Address: "0xcollection",
+		Topics:  []string{TransferBatchTopic, fmt.Sprintf("0x%064x", 9), fmt.Sprintf("0x%064x", 1), fmt.Sprintf("0x%064x", 2)},
+		Data:    data,
+	}
+
+	tx, ok, err := ParseTokenTransfer(log)
+	assert.Nil(t, err, "Expected no error when decoding a transfer")
+	assert.True(t, ok, "Log should be a token transfer")
+	assert.Equal(t, interfaces.KindERC1155, tx.Kind, "Kind should be erc1155")
+	assert.Len(t, tx.Token.TokenIDs, 2, "Every token id should be decoded")
+	assert.Equal(t, "8", tx.Token.TokenIDs[1].String(), "Token ids should be decoded in order")
+	assert.Equal(t, "4", tx.Token.Quantities[1].String(), "Quantities should be decoded in order")
+
+	log.Data = fmt.Sprintf("0x%064x%064x", 64, 4096)
+	_, _, err = ParseTokenTransfer(log)
+	assert.NotNil(t, err, "Expected an error for an out of range offset")
+}
+
+// Test that other events are not token transfers
+func TestParseTokenTransfer_Other(t *testing.T) {
+	log := Log{Topics: []string{"0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"}} // Approval
+	_, ok, err := ParseTokenTransfer(log)
+	assert.Nil(t, err, "Expected no error for another event")
+	assert.False(t, ok, "Approval should not be a token transfer")
+}
+
+// Test decoding symbols returned as a string or as bytes32
+func TestDecodeABIString(t *testing.T) {
+	symbol, err := DecodeABIString("0x" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"5553444300000000000000000000000000000000000000000000000000000000")
+	assert.Nil(t, err, "Expected no error when decoding a string")
+	assert.Equal(t, "USDC", symbol, "String should be decoded")
+
+	symbol, err = DecodeABIString("0x4d4b520000000000000000000000000000000000000000000000000000000000")
+	assert.Nil(t, err, "Expected no error when decoding bytes32")
+	assert.Equal(t, "MKR", symbol, "bytes32 should be decoded up to the first zero byte")
+
+	_, err = DecodeABIString("0x")
+	assert.NotNil(t, err, "Expected an error for an empty result")
+}
@@ -0,0 +1,234 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"tx-parser/utils"
+)
+
+// ErrTracingUnsupported is returned when the node does not implement the requested tracing API
+var ErrTracingUnsupported = errors.New("node does not support the tracing API")
+
+// TraceClient is implemented by clients that can trace the calls of every transaction in a block,
+// through geth's debug API or the trace API of Erigon and Nethermind
+type TraceClient interface {
+	DebugTraceBlock(ctx context.Context, blockNumber int) ([]CallTrace, error)
+	TraceBlock(ctx context.Context, blockNumber int) ([]ParityTrace, error)
+}
+
+// CallTrace is the callTracer result for one transaction of debug_traceBlockByNumber. Older nodes
+// omit the transaction hash, in which case traces are in block order.
+type CallTrace struct {
+	TxHash string     `json:"txHash"`
+	Result *CallFrame `json:"result"`
+	Error  string     `json:"error"`
+}
+
+// CallFrame is a call made during a transaction, with the calls it made in turn
+type CallFrame struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Value string      `json:"value"`
+	Error string      `json:"error"`
+	Calls []CallFrame `json:"calls"`
+}
+
+// ParityTrace is a single call of a transaction as returned by trace_block
+type ParityTrace struct {
+	Type   string `json:"type"` // call, create, suicide or reward
+	Action struct {
+		CallType      string `json:"callType"`
+		From          string `json:"from"`
+		To            string `json:"to"`
+		Value         string `json:"value"`
+		Address       string `json:"address"`       // Self-destructed contract
+		RefundAddress string `json:"refundAddress"` // Beneficiary of a self-destruct
+		Balance       string `json:"balance"`       // Amount sent by a self-destruct
+	} `json:"action"`
+	Result *struct {
+		Address string `json:"address"` // Created contract
+	} `json:"result"`
+	Error           string `json:"error"`
+	TraceAddress    []int  `json:"traceAddress"`
+	TransactionHash string `json:"transactionHash"`
+	BlockHash       string `json:"blockHash"`
+}
+
+// InternalCall is a value transfer made by a contract during a transaction. Path locates the call
+// in the transaction's call tree, the n-th call made by the call at the parent path.
+type InternalCall struct {
+	TxHash string
+	Path   []int
+	Type   string // call, create or selfdestruct
+	From   string
+	To     string
+	Value  *big.Int
+}
+
+// DebugTraceBlock traces every transaction of a block with geth's callTracer
+func (c *RpcClient) DebugTraceBlock(ctx context.Context, blockNumber int) ([]CallTrace, error) {
+	var traces []CallTrace
+	params := []interface{}{fmt.Sprintf("0x%x", blockNumber), map[string]string{"tracer": "callTracer"}}
+	if err := c.call(ctx, "debug_traceBlockByNumber", params, &traces); err != nil {
+		return nil, tracingError(err)
+	}
+	return traces, nil
+}
+
+// TraceBlock traces every transaction of a block with the trace API
+func (c *RpcClient) TraceBlock(ctx context.Context, blockNumber int) ([]ParityTrace, error) {
+	var traces []ParityTrace
+	if err := c.call(ctx, "trace_block", []interface{}{fmt.Sprintf("0x%x", blockNumber)}, &traces); err != nil {
+		return nil, tracingError(err)
+	}
+	return traces, nil
+}
+
+// tracingError reports a node without the tracing API as ErrTracingUnsupported
+func tracingError(err error) error {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == codeMethodNotFound {
+		return fmt.Errorf("%w: %v", ErrTracingUnsupported, err)
+	}
+	return err
+}
+
+// ParseCallTraces extracts the internal value transfers from callTracer results. Top-level calls
+// are the transactions themselves, and calls that were reverted, including by a reverted caller,
+// moved nothing.
+func ParseCallTraces(traces []CallTrace) ([]InternalCall, error) {
+	var calls []InternalCall
+	for _, trace := range traces {
+		if trace.Error != "" {
+			return nil, fmt.Errorf("failed to trace transaction %s: %s", trace.TxHash, trace.Error)
+		}
+		if trace.Result == nil || trace.Result.Error != "" {
+			continue
+		}
+		var err error
+		if calls, err = appendCallFrames(calls, trace.TxHash, nil, trace.Result.Calls); err != nil {
+			return nil, err
+		}
+	}
+	return calls, nil
+}
+
+// appendCallFrames appends the value transfers of frames made by the call at path and their descendants
+func appendCallFrames(calls []InternalCall, txHash string, path []int, frames []CallFrame) ([]InternalCall, error) {
+	for i, frame := range frames {
+		if frame.Error != "" {
+			continue
+		}
+		framePath := append(append([]int{}, path...), i)
+
+		callType, moves := internalCallType(frame.Type)
+		value, err := parseHexBig(frame.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in trace of transaction %s: %w", txHash, err)
+		}
+		if moves && value != nil && value.Sign() > 0 {
+			calls = append(calls, InternalCall{
+				TxHash: txHash,
+				Path:   framePath,
+				Type:   callType,
+				From:   utils.NormalizeAddress(frame.From),
+				To:     utils.NormalizeAddress(frame.To),
+				Value:  value,
+			})
+		}
+		if calls, err = appendCallFrames(calls, txHash, framePath, frame.Calls); err != nil {
+			return nil, err
+		}
+	}
+	return calls, nil
+}
+
+// ParseParityTraces extracts the internal value transfers from trace_block results, with the same
+// rules as ParseCallTraces
+func ParseParityTraces(traces []ParityTrace) ([]InternalCall, error) {
+	// Traces of a transaction are listed depth first, so a reverted call precedes its descendants
+	reverted := make(map[string][][]int)
+	var calls []InternalCall
+	for _, trace := range traces {
+		if trace.Type == "reward" || trace.TransactionHash == "" {
+			continue
+		}
+		if trace.Error != "" {
+			reverted[trace.TransactionHash] = append(reverted[trace.TransactionHash], trace.TraceAddress)
+			continue
+		}
+		if len(trace.TraceAddress) == 0 || hasRevertedAncestor(reverted[trace.TransactionHash], trace.TraceAddress) {
+			continue
+		}
+
+		call := InternalCall{TxHash: trace.TransactionHash, Path: trace.TraceAddress, From: utils.NormalizeAddress(trace.Action.From)}
+		amount := trace.Action.Value
+		switch trace.Type {
+		case "call":
+			if _, moves := internalCallType(trace.Action.CallType); !moves {
+				continue
+			}
+			call.Type, call.To = "call", utils.NormalizeAddress(trace.Action.To)
+		case "create":
+			call.Type = "create"
+			if trace.Result != nil {
+				call.To = utils.NormalizeAddress(trace.Result.Address)
+			}
+		case "suicide":
+			call.Type = "selfdestruct"
+			call.From, call.To, amount = utils.NormalizeAddress(trace.Action.Address), utils.NormalizeAddress(trace.Action.RefundAddress), trace.Action.Balance
+		default:
+			continue
+		}
+
+		value, err := parseHexBig(amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in trace of transaction %s: %w", trace.TransactionHash, err)
+		}
+		if value == nil || value.Sign() == 0 {
+			continue
+		}
+		call.Value = value
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+// hasRevertedAncestor reports whether path is, or descends from, one of the reverted paths
+func hasRevertedAncestor(reverted [][]int, path []int) bool {
+	for _, ancestor := range reverted {
+		if len(ancestor) <= len(path) && equalPaths(ancestor, path[:len(ancestor)]) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalPaths(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+// internalCallType normalizes a call type and reports whether such a call can move value.
+// Delegate calls report their caller's value without moving it, static calls cannot carry value
+// and callcode sends the value back to the calling contract.
+func internalCallType(frameType string) (string, bool) {
+	switch strings.ToLower(frameType) {
+	case "call":
+		return "call", true
+	case "create", "create2":
+		return "create", true
+	case "selfdestruct":
+		return "selfdestruct", true
+	default:
+		return strings.ToLower(frameType), false
+	}
+}
@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that only value moved by successful internal calls is extracted from callTracer results
+func TestParseCallTraces(t *testing.T) {
+	traces := []CallTrace{{
+		TxHash: "0x1",
+		Result: &CallFrame{Type: "CALL", From: "0xEOA", To: "0xc1", Value: "0x5", Calls: []CallFrame{
+			{Type: "CALL", From: "0xc1", To: "0xA", Value: "0x2"},
+			{Type: "DELEGATECALL", From: "0xc1", To: "0xlib", Value: "0x5", Calls: []CallFrame{
+				{Type: "CALL", From: "0xc1", To: "0xB", Value: "0x1"},
+			}},
+			{Type: "CALL", From: "0xc1", To: "0xC", Value: "0x3", Error: "execution reverted", Calls: []CallFrame{
+				{Type: "CALL", From: "0xC", To: "0xD", Value: "0x1"},
+			}},
+			{Type: "STATICCALL", From: "0xc1", To: "0xE"},
+			{Type: "CREATE2", From: "0xc1", To: "0xF", Value: "0x4"},
+		}},
+	}, {
+		TxHash: "0x2",
+		Result: &CallFrame{Type: "CALL", From: "0xEOA", To: "0xc1", Value: "0x1", Error: "out of gas", Calls: []CallFrame{
+			{Type: "CALL", From: "0xc1", To: "0xA", Value: "0x1"},
+		}},
+	}}
+
+	calls, err := ParseCallTraces(traces)
+	assert.Nil(t, err, "Expected no error when parsing call traces")
+	assert.Len(t, calls, 3, "Should keep the successful internal calls that moved value")
+	assert.Equal(t, InternalCall{TxHash: "0x1", Path: []int{0}, Type: "call", From: "0xc1", To: "0xa", Value: calls[0].Value}, calls[0], "First call should be recorded")
+	assert.Equal(t, "2", calls[0].Value.String(), "Value should be decoded")
+	assert.Equal(t, []int{1, 0}, calls[1].Path, "Calls made through a delegate call should keep their path")
+	assert.Equal(t, "create", calls[2].Type, "CREATE2 should be reported as a create")
+	assert.Equal(t, []int{4}, calls[2].Path, "Path should count skipped siblings")
+}
+
+// Test that trace_block results follow the same rules, including calls below a reverted call
+func TestParseParityTraces(t *testing.T) {
+	trace := func(typ string, path []int, err string) ParityTrace {
+		p := ParityTrace{Type: typ, TraceAddress: path, Error: err, TransactionHash: "0x1"}
+		p.Action.CallType = "call"
+		p.Action.From, p.Action.To, p.Action.Value = "0xc1", "0xA", "0x1"
+		return p
+	}
+	suicide := trace("suicide", []int{2}, "")
+	suicide.Action.Address, suicide.Action.RefundAddress, suicide.Action.Balance = "0xc2", "0xB", "0x7"
+	delegate := trace("call", []int{3}, "")
+	delegate.Action.CallType = "delegatecall"
+	reward := trace("reward", nil, "")
+	reward.TransactionHash = ""
+
+	calls, err := ParseParityTraces([]ParityTrace{
+		trace("call", []int{}, ""),
+		trace("call", []int{0}, ""),
+		trace("call", []int{1}, "Reverted"),
+		trace("call", []int{1, 0}, ""),
+		suicide,
+		delegate,
+		reward,
+	})
+	assert.Nil(t, err, "Expected no error when parsing traces")
+	assert.Len(t, calls, 2, "Should skip the transaction, reverted calls, delegate calls and rewards")
+	assert.Equal(t, []int{0}, calls[0].Path, "First call should be recorded")
+	assert.Equal(t, "selfdestruct", calls[1].Type, "Suicide should be reported as a self-destruct")
+	assert.Equal(t, "0xc2", calls[1].From, "Self-destruct should be sent by the destroyed contract")
+	assert.Equal(t, "0xb", calls[1].To, "Self-destruct should be received by the beneficiary")
+	assert.Equal(t, "7", calls[1].Value.String(), "Self-destruct should move the contract's balance")
+}
+
+// Test that a node without the debug API reports tracing as unsupported
+func TestDebugTraceBlock_Unsupported(t *testing.T) {
+	mockServer := newMockServer(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"the method debug_traceBlockByNumber does not exist/is not available"}}`)
+	defer mockServer.Close()
+	client := NewClient(mockServer.URL, logger.GetLogger("debug"))
+
+	_, err := client.DebugTraceBlock(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrTracingUnsupported, "Method not found should report tracing as unsupported")
+}
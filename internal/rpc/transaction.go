@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+)
+
+// Transaction is a transaction as returned by the node, with quantities hex encoded
+type Transaction struct {
+	Hash                 string `json:"hash"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Value                string `json:"value"`
+	BlockNumber          string `json:"blockNumber"`
+	BlockHash            string `json:"blockHash"`
+	TransactionIndex     string `json:"transactionIndex"`
+	Nonce                string `json:"nonce"`
+	Gas                  string `json:"gas"`
+	GasPrice             string `json:"gasPrice"`
+	MaxFeePerGas         string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+	Type                 string `json:"type"`
+	ChainID              string `json:"chainId"`
+	Input                string `json:"input"`
+}
+
+// ParseTransaction decodes a node transaction into its typed form. Quantities missing from the
+// node's response, such as fee caps of legacy transactions, are left nil or zero.
+func ParseTransaction(tx Transaction) (interfaces.Transaction, error) {
+	parsed := interfaces.Transaction{
+		Kind:      interfaces.KindNative,
+		Hash:      tx.Hash,
+		From:      utils.NormalizeAddress(tx.From),
+		To:        utils.NormalizeAddress(tx.To),
+		BlockHash: tx.BlockHash,
+		Input:     tx.Input,
+	}
+
+	var err error
+	decode := func(field string, fn func() error) {
+		if err == nil {
+			if fieldErr := fn(); fieldErr != nil {
+				err = fmt.Errorf("invalid %s of transaction %s: %w", field, tx.Hash, fieldErr)
+			}
+		}
+	}
+	decode("value", func() (err error) { parsed.Value, err = parseHexBig(tx.Value); return })
+	decode("blockNumber", func() (err error) { parsed.BlockNumber, err = parseOptionalHexInt(tx.BlockNumber); return })
+	decode("transactionIndex", func() (err error) { parsed.TransactionIndex, err = parseOptionalHexInt(tx.TransactionIndex); return })
+	decode("nonce", func() (err error) { parsed.Nonce, err = parseHexUint64(tx.Nonce); return })
+	decode("gas", func() (err error) { parsed.Gas, err = parseHexUint64(tx.Gas); return })
+	decode("gasPrice", func() (err error) { parsed.GasPrice, err = parseHexBig(tx.GasPrice); return })
+	decode("maxFeePerGas", func() (err error) { parsed.MaxFeePerGas, err = parseHexBig(tx.MaxFeePerGas); return })
+	decode("maxPriorityFeePerGas", func() (err error) { parsed.MaxPriorityFeePerGas, err = parseHexBig(tx.MaxPriorityFeePerGas); return })
+	decode("type", func() (err error) { parsed.Type, err = parseOptionalHexInt(tx.Type); return })
+	decode("chainId", func() (err error) { parsed.ChainID, err = parseHexBig(tx.ChainID); return })
+	if err != nil {
+		return interfaces.Transaction{}, err
+	}
+
+	// A transaction without value still transfers zero wei
+	if parsed.Value == nil {
+		parsed.Value = new(big.Int)
+	}
+	// Nodes report a null recipient for contract deployments, the address is only known from the receipt
+	if parsed.To == "" {
+		parsed.Kind = interfaces.KindDeployment
+	}
+	return parsed, nil
+}
+
+// parseHexBig decodes a hex quantity of any size, returning nil for an empty string
+func parseHexBig(hexStr string) (*big.Int, error) {
+	if hexStr == "" {
+		return nil, nil
+	}
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(hexStr, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse hex string %s", hexStr)
+	}
+	return value, nil
+}
+
+// parseHexUint64 decodes a hex quantity that fits 64 bits, returning zero for an empty string
+func parseHexUint64(hexStr string) (uint64, error) {
+	value, err := parseHexBig(hexStr)
+	if err != nil || value == nil {
+		return 0, err
+	}
+	if !value.IsUint64() {
+		return 0, fmt.Errorf("hex string %s does not fit 64 bits", hexStr)
+	}
+	return value.Uint64(), nil
+}
+
+// parseOptionalHexInt decodes a small hex quantity, returning zero for an empty string
+func parseOptionalHexInt(hexStr string) (int, error) {
+	if hexStr == "" {
+		return 0, nil
+	}
+	return parseHexToInt(strings.TrimPrefix(hexStr, "0x"))
+}
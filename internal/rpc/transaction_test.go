@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"tx-parser/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test decoding a dynamic fee transaction as returned by eth_getBlockByNumber
+func TestParseTransaction(t *testing.T) {
+	var raw Transaction
+	err := json.Unmarshal([]byte(`{
+		"hash": "0xabc",
+		"from": "0xFromAddress",
+		"to": "0xToAddress",
+		"value": "0xde0b6b3a7640000",
+		"blockNumber": "0x10",
+		"blockHash": "0xblock",
+		"transactionIndex": "0x3",
+		"nonce": "0x7",
+		"gas": "0x5208",
+		"gasPrice": "0x3b9aca00",
+		"maxFeePerGas": "0x77359400",
+		"maxPriorityFeePerGas": "0x3b9aca00",
+		"type": "0x2",
+		"chainId": "0x1",
+		"input": "0x"
+	}`), &raw)
+	assert.Nil(t, err, "Expected no error when unmarshalling the transaction")
+
+	tx, err := ParseTransaction(raw)
+	assert.Nil(t, err, "Expected no error when parsing the transaction")
+	assert.Equal(t, "0xfromaddress", tx.From, "From address should be normalized")
+	assert.Equal(t, "0xtoaddress", tx.To, "To address should be normalized")
+	assert.Equal(t, "1000000000000000000", tx.Value.String(), "Value should be 1 ether in wei")
+	assert.Equal(t, 16, tx.BlockNumber, "Block number should be decoded")
+	assert.Equal(t, "0xblock", tx.BlockHash, "Block hash should match")
+	assert.Equal(t, 3, tx.TransactionIndex, "Transaction index should be decoded")
+	assert.Equal(t, uint64(7), tx.Nonce, "Nonce should be decoded")
+	assert.Equal(t, uint64(21000), tx.Gas, "Gas should be decoded")
+	assert.Equal(t, big.NewInt(1000000000), tx.GasPrice, "Gas price should be decoded")
+	assert.Equal(t, big.NewInt(2000000000), tx.MaxFeePerGas, "Max fee should be decoded")
+	assert.Equal(t, big.NewInt(1000000000), tx.MaxPriorityFeePerGas, "Max priority fee should be decoded")
+	assert.Equal(t, 2, tx.Type, "Type should be decoded")
+	assert.Equal(t, big.NewInt(1), tx.ChainID, "Chain id should be decoded")
+	assert.Equal(t, "0x", tx.Input, "Input should match")
+}
+
+// Test decoding a legacy transaction without fee caps or chain id
+func TestParseTransaction_Legacy(t *testing.T) {
+	tx, err := ParseTransaction(Transaction{Hash: "0xabc", Value: "0x0", GasPrice: "0x1", Type: "0x0"})
+	assert.Nil(t, err, "Expected no error when parsing the transaction")
+	assert.Equal(t, 0, tx.Value.Sign(), "Value should be zero")
+	assert.Nil(t, tx.MaxFeePerGas, "Legacy transactions have no max fee")
+	assert.Nil(t, tx.MaxPriorityFeePerGas, "Legacy transactions have no max priority fee")
+	assert.Nil(t, tx.ChainID, "Chain id should be absent")
+}
+
+// Test that a transaction without a recipient is classified as a deployment
+func TestParseTransaction_Deployment(t *testing.T) {
+	var raw Transaction
+	err := json.Unmarshal([]byte(`{"hash":"0xabc","from":"0x1","to":null,"value":"0x0","input":"0x6080"}`), &raw)
+	assert.Nil(t, err, "Expected no error when unmarshalling the transaction")
+
+	tx, err := ParseTransaction(raw)
+	assert.Nil(t, err, "Expected no error when parsing the transaction")
+	assert.Equal(t, interfaces.KindDeployment, tx.Kind, "Transaction should be a deployment")
+	assert.Empty(t, tx.To, "Deployments have no recipient")
+}
+
+// Test that values beyond 64 bits keep their precision
+func TestParseTransaction_LargeValue(t *testing.T) {
+	tx, err := ParseTransaction(Transaction{Hash: "0xabc", Value: "0xffffffffffffffffffffffff"})
+	assert.Nil(t, err, "Expected no error when parsing the transaction")
+	assert.Equal(t, "79228162514264337593543950335", tx.Value.String(), "Value should not be truncated")
+
+	_, err = ParseTransaction(Transaction{Hash: "0xabc", Nonce: "0xffffffffffffffffffffffff"})
+	assert.NotNil(t, err, "Expected an error for a nonce beyond 64 bits")
+}
+
+// Test that malformed quantities are rejected
+func TestParseTransaction_Invalid(t *testing.T) {
+	_, err := ParseTransaction(Transaction{Hash: "0xabc", Value: "0xnothex"})
+	assert.NotNil(t, err, "Expected an error for an invalid value")
+	assert.Contains(t, err.Error(), "value", "Error should name the invalid field")
+}
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"fmt"
+	"math/big"
+	"tx-parser/internal/interfaces"
+	"tx-parser/utils"
+)
+
+// weiPerGwei converts the gwei amounts of withdrawals to wei
+var weiPerGwei = big.NewInt(1_000_000_000)
+
+// Withdrawal is a beacon chain withdrawal included in a block since Shanghai, with quantities hex encoded
+type Withdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"` // In gwei
+}
+
+// ParseWithdrawal decodes a block withdrawal into a withdrawal record paid to its address. The
+// withdrawal is not a transaction, so the record has no hash or sender.
+func ParseWithdrawal(w Withdrawal) (interfaces.Transaction, error) {
+	index, err := parseHexUint64(w.Index)
+	if err != nil {
+		return interfaces.Transaction{}, fmt.Errorf("invalid index of withdrawal: %w", err)
+	}
+	validatorIndex, err := parseHexUint64(w.ValidatorIndex)
+	if err != nil {
+		return interfaces.Transaction{}, fmt.Errorf("invalid validatorIndex of withdrawal %d: %w", index, err)
+	}
+	gwei, err := parseHexBig(w.Amount)
+	if err != nil {
+		return interfaces.Transaction{}, fmt.Errorf("invalid amount of withdrawal %d: %w", index, err)
+	}
+
+	value := new(big.Int)
+	if gwei != nil {
+		value.Mul(gwei, weiPerGwei)
+	}
+	return interfaces.Transaction{
+		Kind:       interfaces.KindWithdrawal,
+		To:         utils.NormalizeAddress(w.Address),
+		Value:      value,
+		Withdrawal: &interfaces.Withdrawal{Index: index, ValidatorIndex: validatorIndex},
+	}, nil
+}
@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+	"tx-parser/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test decoding a block withdrawal, converting its amount from gwei to wei
+func TestParseWithdrawal(t *testing.T) {
+	var block Block
+	err := json.Unmarshal([]byte(`{"number":"0x1","withdrawals":[{"index":"0x2a","validatorIndex":"0x3e8","address":"0xABC","amount":"0x1bc16d674"}]}`), &block)
+	assert.Nil(t, err, "Expected no error when unmarshalling the block")
+	assert.Len(t, block.Withdrawals, 1, "Withdrawals should be decoded with the block")
+
+	withdrawal, err := ParseWithdrawal(block.Withdrawals[0])
+	assert.Nil(t, err, "Expected no error when parsing the withdrawal")
+	assert.Equal(t, interfaces.KindWithdrawal, withdrawal.Kind, "Record should be a withdrawal")
+	assert.Equal(t, "0xabc", withdrawal.To, "Address should be normalized")
+	assert.Equal(t, "7450580596000000000", withdrawal.Value.String(), "Amount should be converted from gwei to wei")
+	assert.Equal(t, uint64(42), withdrawal.Withdrawal.Index, "Index should be decoded")
+	assert.Equal(t, uint64(1000), withdrawal.Withdrawal.ValidatorIndex, "Validator index should be decoded")
+	assert.Equal(t, "withdrawal:42", withdrawal.RecordID(), "Withdrawals should be identified by their index")
+
+	_, err = ParseWithdrawal(Withdrawal{Index: "0x1", Amount: "0xzz"})
+	assert.NotNil(t, err, "Expected an error for a malformed amount")
+}
@@ -0,0 +1,208 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/pkg/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsPingInterval is how often the connection is pinged to detect a dead node
+	wsPingInterval = 20 * time.Second
+	// wsReadTimeout is how long the connection may stay silent, pongs included, before it is dropped
+	wsReadTimeout = 2 * wsPingInterval
+	// wsWriteTimeout bounds every write to the connection
+	wsWriteTimeout = 10 * time.Second
+	// droppedLogEvery is how many dropped pending transactions are logged together
+	droppedLogEvery = 1000
+)
+
+// HeadSubscriber pushes new chain heads as the node sees them
+type HeadSubscriber interface {
+	// SubscribeNewHeads delivers every new head to heads until ctx is cancelled. Heads are
+	// blocks without transactions.
+	SubscribeNewHeads(ctx context.Context, heads chan<- *Block)
+}
+
+// WSClient subscribes to new heads or pending transactions over a WebSocket connection,
+// reconnecting with backoff whenever the connection or subscription fails
+type WSClient struct {
+	url       string
+	dialer    *websocket.Dialer
+	reconnect RetryPolicy // Only the backoff is used, reconnecting never gives up
+	connected atomic.Bool
+	dropped   atomic.Int64 // Pending transactions dropped because the consumer fell behind
+	log       *logger.Logger
+}
+
+// NewWSClient creates a client for the WebSocket endpoint of a node. The connect timeout bounds
+// dialing and the WebSocket handshake.
+func NewWSClient(url string, connectTimeout time.Duration, log *logger.Logger) *WSClient {
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	return &WSClient{
+		url:       url,
+		dialer:    &websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: connectTimeout},
+		reconnect: NewRetryPolicy(config.RetryConfig{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second}),
+		log:       log,
+	}
+}
+
+// Connected reports whether the client's subscription is currently established
+func (c *WSClient) Connected() bool {
+	return c.connected.Load()
+}
+
+// SubscribeNewHeads keeps a newHeads subscription open until ctx is cancelled. Heads missed while
+// the connection was down are not replayed; consumers detect the gap from the next head's number.
+func (c *WSClient) SubscribeNewHeads(ctx context.Context, heads chan<- *Block) {
+	c.keepSubscribed(ctx, "newHeads", []interface{}{"newHeads"}, func(result json.RawMessage) error {
+		var head *Block
+		if err := json.Unmarshal(result, &head); err != nil {
+			return fmt.Errorf("failed to unmarshal head: %w", err)
+		}
+		if head == nil {
+			return nil
+		}
+		select {
+		case heads <- head:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// SubscribePendingTransactions keeps a newPendingTransactions subscription open until ctx is
+// cancelled, asking for full transactions. Nodes that ignore the request announce hashes only.
+func (c *WSClient) SubscribePendingTransactions(ctx context.Context, txs chan<- PendingTransaction) {
+	params := []interface{}{"newPendingTransactions", true}
+	c.keepSubscribed(ctx, "newPendingTransactions", params, func(result json.RawMessage) error {
+		var pending PendingTransaction
+		if err := json.Unmarshal(result, &pending.Hash); err != nil {
+			if err := json.Unmarshal(result, &pending.Transaction); err != nil || pending.Transaction == nil {
+				return fmt.Errorf("failed to unmarshal pending transaction: %v", err)
+			}
+			pending.Hash = pending.Transaction.Hash
+		}
+		// Never wait for the consumer, a connection that is not read can be closed by the node
+		select {
+		case txs <- pending:
+		default:
+			if dropped := c.dropped.Add(1); dropped == 1 || dropped%droppedLogEvery == 0 {
+				c.log.Warn.Printf("Dropped %d pending transactions announced while the consumer was behind", dropped)
+			}
+		}
+		return nil
+	})
+}
+
+// DroppedPending returns the number of pending transactions dropped because txs was full
+func (c *WSClient) DroppedPending() int64 {
+	return c.dropped.Load()
+}
+
+// keepSubscribed keeps a subscription open until ctx is cancelled, passing every notification to
+// handle. An error from handle drops the connection, which is then reestablished.
+func (c *WSClient) keepSubscribed(ctx context.Context, name string, params []interface{}, handle func(json.RawMessage) error) {
+	failures := 0
+	for ctx.Err() == nil {
+		subscribed, err := c.subscribe(ctx, name, params, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			// The connection worked for a while, so start the backoff over
+			failures = 0
+		}
+		failures++
+
+		delay := c.reconnect.Backoff(failures)
+		c.log.Warn.Printf("%s subscription to %s lost, reconnecting in %s: %v", name, redactURL(c.url), delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// subscribe runs a single connection until it fails, reporting whether the subscription was established
+func (c *WSClient) subscribe(ctx context.Context, name string, params []interface{}, handle func(json.RawMessage) error) (bool, error) {
+	conn, _, err := c.dialer.DialContext(ctx, c.url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock the read loop once the subscription is no longer wanted
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			}
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	})
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	request := RequestPayload{Jsonrpc: "2.0", Method: "eth_subscribe", Params: params, Id: 1}
+	if err := conn.WriteJSON(request); err != nil {
+		return false, fmt.Errorf("failed to send subscription request: %w", err)
+	}
+
+	var subscription string
+	for {
+		var message struct {
+			Id     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *RPCError       `json:"error,omitempty"`
+			Method string          `json:"method"`
+			Params struct {
+				Subscription string          `json:"subscription"`
+				Result       json.RawMessage `json:"result"`
+			} `json:"params"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			return subscription != "", fmt.Errorf("failed to read message: %w", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		switch {
+		case message.Id == request.Id && message.Error != nil:
+			return false, message.Error
+		case message.Id == request.Id:
+			if err := json.Unmarshal(message.Result, &subscription); err != nil {
+				return false, fmt.Errorf("failed to unmarshal subscription id: %v", err)
+			}
+			c.connected.Store(true)
+			defer c.connected.Store(false)
+			c.log.Info.Printf("Subscribed to %s on %s", name, redactURL(c.url))
+		case message.Method == "eth_subscription" && message.Params.Subscription == subscription && len(message.Params.Result) > 0:
+			if err := handle(message.Params.Result); err != nil {
+				return true, err
+			}
+		}
+	}
+}
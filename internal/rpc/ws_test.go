@@ -0,0 +1,216 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/pkg/logger"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// wsNode is an in-process stand-in for a node's WebSocket endpoint supporting subscriptions
+type wsNode struct {
+	*httptest.Server
+	mu          sync.Mutex
+	conn        *websocket.Conn
+	connections int
+	reject      bool // Answer subscription requests with an error
+}
+
+func newWSNode(reject bool) *wsNode {
+	n := &wsNode{reject: reject}
+	upgrader := websocket.Upgrader{}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var req RequestPayload
+		if err := conn.ReadJSON(&req); err != nil || req.Method != "eth_subscribe" {
+			return
+		}
+
+		n.mu.Lock()
+		n.connections++
+		if n.reject {
+			n.mu.Unlock()
+			conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "error": map[string]interface{}{"code": -32000, "message": "subscriptions disabled"}})
+			return
+		}
+		n.conn = conn
+		conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": "0xsub"})
+		n.mu.Unlock()
+
+		// Keep the connection open until the client or the test closes it
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	return n
+}
+
+func (n *wsNode) wsURL() string {
+	return "ws" + strings.TrimPrefix(n.URL, "http")
+}
+
+// push sends a new head notification on the current connection
+func (n *wsNode) push(number int) {
+	n.notify(map[string]interface{}{"number": fmt.Sprintf("0x%x", number), "hash": fmt.Sprintf("0x%d", number)})
+}
+
+// notify sends a subscription notification with the given result on the current connection
+func (n *wsNode) notify(result interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscription",
+		"params":  map[string]interface{}{"subscription": "0xsub", "result": result},
+	})
+}
+
+// drop closes the current connection as if the node went away
+func (n *wsNode) drop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.conn.Close()
+	n.conn = nil
+}
+
+func (n *wsNode) getConnections() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.connections
+}
+
+// newTestWSClient creates a client that reconnects quickly so tests stay fast
+func newTestWSClient(url string) *WSClient {
+	client := NewWSClient(url, time.Second, logger.GetLogger("debug"))
+	client.reconnect = NewRetryPolicy(config.RetryConfig{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	return client
+}
+
+// receiveHead waits for the next pushed head and returns its number
+func receiveHead(t *testing.T, heads <-chan *Block) int {
+	select {
+	case head := <-heads:
+		number, err := ParseBlockNumber(head)
+		assert.Nil(t, err, "Expected a valid head number")
+		return number
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a new head")
+		return 0
+	}
+}
+
+// Test that pushed heads are delivered and the subscription survives a dropped connection
+func TestWSClient_SubscribeNewHeads(t *testing.T) {
+	node := newWSNode(false)
+	defer node.Close()
+	client := newTestWSClient(node.wsURL())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	heads := make(chan *Block, 10)
+	go client.SubscribeNewHeads(ctx, heads)
+
+	assert.Eventually(t, client.Connected, 2*time.Second, time.Millisecond, "Client should subscribe")
+	node.push(1)
+	node.push(2)
+	assert.Equal(t, 1, receiveHead(t, heads), "First head should be delivered")
+	assert.Equal(t, 2, receiveHead(t, heads), "Second head should be delivered")
+
+	// The client reconnects after the node drops the connection
+	node.drop()
+	assert.Eventually(t, func() bool { return node.getConnections() == 2 && client.Connected() }, 2*time.Second, time.Millisecond, "Client should reconnect")
+	node.push(5)
+	assert.Equal(t, 5, receiveHead(t, heads), "Heads should be delivered after reconnecting")
+
+	// Cancelling the context closes the subscription
+	cancel()
+	assert.Eventually(t, func() bool { return !client.Connected() }, 2*time.Second, time.Millisecond, "Client should disconnect")
+}
+
+// Test that a rejected subscription is retried
+func TestWSClient_SubscriptionRejected(t *testing.T) {
+	node := newWSNode(true)
+	defer node.Close()
+	client := newTestWSClient(node.wsURL())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.SubscribeNewHeads(ctx, make(chan *Block))
+
+	assert.Eventually(t, func() bool { return node.getConnections() >= 3 }, 2*time.Second, time.Millisecond, "Client should keep retrying")
+	assert.False(t, client.Connected(), "Client should not report a rejected subscription as connected")
+}
+
+// Test that pending transactions are delivered whether the node announces full transactions or hashes
+func TestWSClient_SubscribePendingTransactions(t *testing.T) {
+	node := newWSNode(false)
+	defer node.Close()
+	client := newTestWSClient(node.wsURL())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	txs := make(chan PendingTransaction, 10)
+	go client.SubscribePendingTransactions(ctx, txs)
+
+	assert.Eventually(t, client.Connected, 2*time.Second, time.Millisecond, "Client should subscribe")
+	node.notify(map[string]interface{}{"hash": "0x1", "from": "0xa", "nonce": "0x2"})
+	node.notify("0x2")
+
+	for _, want := range []PendingTransaction{
+		{Hash: "0x1", Transaction: &Transaction{Hash: "0x1", From: "0xa", Nonce: "0x2"}},
+		{Hash: "0x2"},
+	} {
+		select {
+		case pending := <-txs:
+			assert.Equal(t, want, pending, "Pending transaction should be delivered")
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for a pending transaction")
+		}
+	}
+}
+
+// Test that announcements are dropped rather than waited for while the consumer is behind, so the
+// connection keeps being read
+func TestWSClient_SubscribePendingTransactions_Full(t *testing.T) {
+	node := newWSNode(false)
+	defer node.Close()
+	client := newTestWSClient(node.wsURL())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	txs := make(chan PendingTransaction, 1)
+	go client.SubscribePendingTransactions(ctx, txs)
+
+	assert.Eventually(t, client.Connected, 2*time.Second, time.Millisecond, "Client should subscribe")
+	for _, hash := range []string{"0x1", "0x2", "0x3"} {
+		node.notify(hash)
+	}
+	assert.Eventually(t, func() bool { return client.DroppedPending() == 2 }, 2*time.Second, time.Millisecond, "Announcements should be dropped while the consumer is behind")
+	assert.Equal(t, "0x1", (<-txs).Hash, "The first announcement should be delivered")
+
+	// Once the consumer catches up, announcements are delivered again
+	node.notify("0x4")
+	select {
+	case pending := <-txs:
+		assert.Equal(t, "0x4", pending.Hash, "New announcement should be delivered")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a pending transaction")
+	}
+	assert.Equal(t, 1, node.getConnections(), "Connection should be kept")
+}
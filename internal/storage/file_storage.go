@@ -0,0 +1,452 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"tx-parser/internal/interfaces"
+	"tx-parser/pkg/logger"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	logFile      = "wal.log"
+
+	// DefaultSnapshotEvery is the number of log entries written between snapshots when not configured
+	DefaultSnapshotEvery = 1000
+)
+
+// Log entry operations
+const (
+	opAddAddress        = "add_address"
+	opRemoveAddress     = "remove_address"
+	opAddTransaction    = "add_transaction"
+	opRemoveTransaction = "remove_transaction"
+	opRemoveFromBlock   = "remove_from_block"
+	opSaveCheckpoint    = "save_checkpoint"
+	opSaveBackfill      = "save_backfill"
+	opSaveWebhook       = "save_webhook"
+	opSaveDelivery      = "save_delivery"
+	opRemoveDelivery    = "remove_delivery"
+)
+
+// logEntry is a single mutation appended to the write-ahead log
+type logEntry struct {
+	Seq        uint64                      `json:"seq"`
+	Op         string                      `json:"op"`
+	Address    string                      `json:"address,omitempty"`
+	Hash       string                      `json:"hash,omitempty"`
+	ID         string                      `json:"id,omitempty"`    // Id of a removed webhook delivery
+	Block      int                         `json:"block,omitempty"` // First block whose records are removed
+	Tx         *interfaces.Transaction     `json:"tx,omitempty"`
+	Checkpoint *interfaces.Checkpoint      `json:"checkpoint,omitempty"`
+	Backfill   *interfaces.BackfillJob     `json:"backfill,omitempty"`
+	Webhook    *interfaces.Webhook         `json:"webhook,omitempty"`
+	Delivery   *interfaces.WebhookDelivery `json:"delivery,omitempty"`
+}
+
+// snapshot is the full storage state as of the log entry with sequence LastSeq
+type snapshot struct {
+	LastSeq      uint64                              `json:"last_seq"`
+	Checkpoint   *interfaces.Checkpoint              `json:"checkpoint,omitempty"`
+	Subscribed   []string                            `json:"subscribed"`
+	Transactions map[string][]interfaces.Transaction `json:"transactions"`
+	Backfills    []interfaces.BackfillJob            `json:"backfills"`
+	Webhooks     []interfaces.Webhook                `json:"webhooks,omitempty"`
+	Deliveries   []interfaces.WebhookDelivery        `json:"deliveries,omitempty"`
+}
+
+// walFile is the file the write-ahead log is appended to
+type walFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// FileStorage is a file-backed Storage. Every mutation is appended to a write-ahead log and
+// fsynced before it is applied in memory; the log is periodically compacted into a snapshot.
+// Once writing to the log fails, every later mutation is refused, see Err.
+type FileStorage struct {
+	*MemoryStorage
+	mu            sync.Mutex // Serializes mutations so the log order matches the in-memory order
+	dir           string
+	wal           walFile
+	err           error  // Sticky log write failure
+	seq           uint64 // Sequence number of the last log entry
+	entries       int    // Log entries written since the last snapshot
+	snapshotEvery int
+	log           *logger.Logger
+}
+
+// NewFileStorage opens (or creates) a file storage in dir and recovers its state from disk
+func NewFileStorage(dir string, snapshotEvery int, log *logger.Logger) (*FileStorage, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	s := &FileStorage{
+		MemoryStorage: NewMemoryStorage(),
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+		log:           log,
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	s.wal = wal
+
+	log.Info.Printf("Recovered file storage from %s at sequence %d", dir, s.seq)
+	return s, nil
+}
+
+func (s *FileStorage) AddAddress(address string) bool {
+	address = normalizeAddress(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.MemoryStorage.IsSubscribed(address) {
+		return false
+	}
+	if s.append(logEntry{Op: opAddAddress, Address: address}) != nil {
+		return false
+	}
+	added := s.MemoryStorage.AddAddress(address)
+	s.maybeCompact()
+	return added
+}
+
+func (s *FileStorage) RemoveAddress(address string) bool {
+	address = normalizeAddress(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.MemoryStorage.IsSubscribed(address) {
+		return false
+	}
+	if s.append(logEntry{Op: opRemoveAddress, Address: address}) != nil {
+		return false
+	}
+	removed := s.MemoryStorage.RemoveAddress(address)
+	s.maybeCompact()
+	return removed
+}
+
+func (s *FileStorage) AddTransaction(address string, tx interfaces.Transaction) {
+	address = normalizeAddress(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opAddTransaction, Address: address, Tx: &tx}) != nil {
+		return
+	}
+	s.MemoryStorage.AddTransaction(address, tx)
+	s.maybeCompact()
+}
+
+func (s *FileStorage) RemoveTransaction(address string, txHash string) bool {
+	address = normalizeAddress(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opRemoveTransaction, Address: address, Hash: txHash}) != nil {
+		return false
+	}
+	removed := s.MemoryStorage.RemoveTransaction(address, txHash)
+	s.maybeCompact()
+	return removed
+}
+
+func (s *FileStorage) RemoveTransactionsFrom(blockNumber int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opRemoveFromBlock, Block: blockNumber}) != nil {
+		return nil
+	}
+	addresses := s.MemoryStorage.RemoveTransactionsFrom(blockNumber)
+	s.maybeCompact()
+	return addresses
+}
+
+func (s *FileStorage) SaveCheckpoint(checkpoint interfaces.Checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opSaveCheckpoint, Checkpoint: &checkpoint}) != nil {
+		return
+	}
+	s.MemoryStorage.SaveCheckpoint(checkpoint)
+	s.maybeCompact()
+}
+
+func (s *FileStorage) SaveBackfill(job interfaces.BackfillJob) {
+	job.Address = normalizeAddress(job.Address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opSaveBackfill, Backfill: &job}) != nil {
+		return
+	}
+	s.MemoryStorage.SaveBackfill(job)
+	s.maybeCompact()
+}
+
+func (s *FileStorage) SaveWebhook(webhook interfaces.Webhook) {
+	webhook.Address = normalizeAddress(webhook.Address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opSaveWebhook, Webhook: &webhook}) != nil {
+		return
+	}
+	s.MemoryStorage.SaveWebhook(webhook)
+	s.maybeCompact()
+}
+
+func (s *FileStorage) SaveDelivery(delivery interfaces.WebhookDelivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opSaveDelivery, Delivery: &delivery}) != nil {
+		return
+	}
+	s.MemoryStorage.SaveDelivery(delivery)
+	s.maybeCompact()
+}
+
+func (s *FileStorage) RemoveDelivery(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.append(logEntry{Op: opRemoveDelivery, ID: id}) != nil {
+		return
+	}
+	s.MemoryStorage.RemoveDelivery(id)
+	s.maybeCompact()
+}
+
+// Compact writes a snapshot of the current state and truncates the log
+func (s *FileStorage) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// Close compacts the log and releases the underlying files
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.wal.Close()
+}
+
+// Err returns the error that made the storage refuse mutations, or nil while it accepts them
+func (s *FileStorage) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// append writes a log entry and fsyncs it. Callers apply the entry in memory afterwards, and only
+// when it returns no error, so the in-memory state never gets ahead of the log.
+func (s *FileStorage) append(entry logEntry) error {
+	if s.err != nil {
+		return s.err
+	}
+	entry.Seq = s.seq + 1
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// Nothing was written, so later entries can still be appended
+		s.log.Error.Printf("Failed to encode log entry %d: %v", entry.Seq, err)
+		return err
+	}
+	if _, err := s.wal.Write(append(data, '\n')); err != nil {
+		return s.fail(fmt.Errorf("failed to write log entry %d: %w", entry.Seq, err))
+	}
+	if err := s.wal.Sync(); err != nil {
+		return s.fail(fmt.Errorf("failed to sync log entry %d: %w", entry.Seq, err))
+	}
+
+	s.seq = entry.Seq
+	s.entries++
+	return nil
+}
+
+// fail refuses every later mutation. The log may end in a partial entry, so appending after it
+// could make the entries written since unrecoverable.
+func (s *FileStorage) fail(err error) error {
+	s.err = err
+	s.log.Error.Printf("File storage failed, refusing further changes: %v", err)
+	return err
+}
+
+// maybeCompact compacts the log once enough entries have accumulated since the last snapshot
+func (s *FileStorage) maybeCompact() {
+	if s.entries < s.snapshotEvery {
+		return
+	}
+	if err := s.compact(); err != nil {
+		s.log.Error.Printf("Failed to compact storage: %v", err)
+	}
+}
+
+// compact atomically replaces the snapshot with the current state and then truncates the log.
+// Entries are only skipped on recovery by sequence number, so a crash between the two steps is safe.
+func (s *FileStorage) compact() error {
+	data, err := json.Marshal(s.MemoryStorage.snapshot(s.seq))
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmpPath := filepath.Join(s.dir, snapshotFile+".tmp")
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("failed to sync storage directory: %w", err)
+	}
+
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate log: %w", err)
+	}
+	s.entries = 0
+	s.log.Debug.Printf("Compacted storage at sequence %d", s.seq)
+	return nil
+}
+
+// recover loads the latest snapshot and replays the log entries written after it
+func (s *FileStorage) recover() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	default:
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("failed to decode snapshot: %w", err)
+		}
+		s.MemoryStorage.restore(snap)
+		s.seq = snap.LastSeq
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, logFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// A torn write from a crash, drop it so new entries start on a clean line
+				s.log.Warn.Printf("Discarding incomplete log entry at offset %d", offset)
+				if err := file.Truncate(offset); err != nil {
+					return fmt.Errorf("failed to truncate incomplete log entry: %w", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+		offset += int64(len(line))
+
+		var entry logEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return fmt.Errorf("failed to decode log entry at offset %d: %w", offset-int64(len(line)), err)
+		}
+		if entry.Seq <= s.seq {
+			// Already included in the snapshot
+			continue
+		}
+		s.apply(entry)
+		s.seq = entry.Seq
+		s.entries++
+	}
+}
+
+// apply replays a log entry against the in-memory state
+func (s *FileStorage) apply(entry logEntry) {
+	switch entry.Op {
+	case opAddAddress:
+		s.MemoryStorage.AddAddress(entry.Address)
+	case opRemoveAddress:
+		s.MemoryStorage.RemoveAddress(entry.Address)
+	case opAddTransaction:
+		s.MemoryStorage.AddTransaction(entry.Address, *entry.Tx)
+	case opRemoveTransaction:
+		s.MemoryStorage.RemoveTransaction(entry.Address, entry.Hash)
+	case opRemoveFromBlock:
+		s.MemoryStorage.RemoveTransactionsFrom(entry.Block)
+	case opSaveCheckpoint:
+		s.MemoryStorage.SaveCheckpoint(*entry.Checkpoint)
+	case opSaveBackfill:
+		s.MemoryStorage.SaveBackfill(*entry.Backfill)
+	case opSaveWebhook:
+		s.MemoryStorage.SaveWebhook(*entry.Webhook)
+	case opSaveDelivery:
+		s.MemoryStorage.SaveDelivery(*entry.Delivery)
+	case opRemoveDelivery:
+		s.MemoryStorage.RemoveDelivery(entry.ID)
+	default:
+		s.log.Warn.Printf("Skipping unknown log entry %d with op %q", entry.Seq, entry.Op)
+	}
+}
+
+// writeFileSync writes data to path and fsyncs it before returning
+func writeFileSync(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir fsyncs a directory so a rename inside it is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"tx-parser/internal/interfaces"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestFileStorage opens a file storage in dir and closes it when the test ends
+func newTestFileStorage(t *testing.T, dir string, snapshotEvery int) *FileStorage {
+	s, err := NewFileStorage(dir, snapshotEvery, logger.GetLogger("debug"))
+	if err != nil {
+		t.Fatal("Error opening file storage:", err)
+	}
+	t.Cleanup(func() { s.wal.Close() })
+	return s
+}
+
+func TestFileStorage(t *testing.T) {
+	runStorageSuite(t, func(t *testing.T) interfaces.Storage {
+		return newTestFileStorage(t, t.TempDir(), 0)
+	})
+}
+
+func TestFileStorage_RecoverFromLog(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestFileStorage(t, dir, 0)
+	s.AddAddress("0xTestAddress")
+	s.AddAddress("0xOther")
+	s.RemoveAddress("0xOther")
+	s.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x1", From: "0xFrom1", To: "0xtestaddress", Value: big.NewInt(100)})
+	s.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xTo1", Value: big.NewInt(200)})
+	s.RemoveTransaction("0xTestAddress", "0x1")
+	s.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x3", BlockNumber: 11, From: "0xtestaddress", To: "0xTo1", Value: big.NewInt(300)})
+	s.RemoveTransactionsFrom(11)
+	s.SaveCheckpoint(interfaces.Checkpoint{BlockNumber: 10, BlockHash: "0xa"})
+
+	// Reopen without closing, as after a crash
+	recovered := newTestFileStorage(t, dir, 0)
+	checkpoint, ok := recovered.GetCheckpoint()
+	assert.True(t, ok, "Checkpoint should be recovered from the log")
+	assert.Equal(t, 10, checkpoint.BlockNumber, "The recovered checkpoint's block number should match")
+	assert.True(t, recovered.IsSubscribed("0xtestaddress"), "Subscription should be recovered from the log")
+	assert.False(t, recovered.IsSubscribed("0xother"), "Removed subscription should stay removed")
+	transactions := recovered.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "There should be 1 transaction after recovery")
+	assert.Equal(t, "0x2", transactions[0].Hash, "The recovered transaction's hash should match")
+}
+
+func TestFileStorage_Compaction(t *testing.T) {
+	dir := t.TempDir()
+
+	// Snapshot after every 2 log entries
+	s := newTestFileStorage(t, dir, 2)
+	s.AddAddress("0xTestAddress")
+	s.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x1", From: "0xFrom1", To: "0xtestaddress", Value: big.NewInt(100)})
+	s.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x2", From: "0xtestaddress", To: "0xTo1", Value: big.NewInt(200)})
+
+	_, err := os.Stat(filepath.Join(dir, snapshotFile))
+	assert.Nil(t, err, "Snapshot should be written once the threshold is reached")
+
+	// Recovery combines the snapshot with the entries logged after it
+	recovered := newTestFileStorage(t, dir, 2)
+	assert.True(t, recovered.IsSubscribed("0xtestaddress"), "Subscription should be recovered from the snapshot")
+	assert.Len(t, recovered.GetTransactions("0xtestaddress"), 2, "There should be 2 transactions after recovery")
+}
+
+func TestFileStorage_SnapshotWithStaleLog(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestFileStorage(t, dir, 0)
+	s.AddAddress("0xTestAddress")
+	s.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x1", From: "0xFrom1", To: "0xtestaddress", Value: big.NewInt(100)})
+	logData, _ := os.ReadFile(filepath.Join(dir, logFile))
+
+	// Simulate a crash after the snapshot was written but before the log was truncated
+	assert.Nil(t, s.Compact(), "Compaction should succeed")
+	os.WriteFile(filepath.Join(dir, logFile), logData, 0644)
+
+	recovered := newTestFileStorage(t, dir, 0)
+	assert.Len(t, recovered.GetTransactions("0xtestaddress"), 1, "Entries already in the snapshot should not be replayed")
+}
+
+func TestFileStorage_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestFileStorage(t, dir, 0)
+	s.AddAddress("0xTestAddress")
+
+	// Simulate a crash in the middle of writing a log entry
+	file, _ := os.OpenFile(filepath.Join(dir, logFile), os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString(`{"seq":2,"op":"add_transaction","address":"0xtesta`)
+	file.Close()
+
+	recovered := newTestFileStorage(t, dir, 0)
+	assert.True(t, recovered.IsSubscribed("0xtestaddress"), "Complete entries should be recovered")
+	assert.Len(t, recovered.GetTransactions("0xtestaddress"), 0, "Incomplete entry should be discarded")
+
+	// New entries are appended on a clean line after the discarded one
+	recovered.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x1", From: "0xFrom1", To: "0xtestaddress", Value: big.NewInt(100)})
+	reopened := newTestFileStorage(t, dir, 0)
+	assert.Len(t, reopened.GetTransactions("0xtestaddress"), 1, "Entry written after recovery should be readable")
+}
+
+func TestFileStorage_Close(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewFileStorage(dir, 0, logger.GetLogger("debug"))
+	assert.Nil(t, err, "Expected no error when opening file storage")
+	s.AddAddress("0xTestAddress")
+	s.SaveCheckpoint(interfaces.Checkpoint{BlockNumber: 10, BlockHash: "0xa"})
+	s.SaveBackfill(interfaces.BackfillJob{Address: "0xTestAddress", FromBlock: 1, ToBlock: 10, NextBlock: 4, Status: interfaces.BackfillRunning})
+	assert.Nil(t, s.Close(), "Expected no error when closing file storage")
+
+	// Closing compacts everything into the snapshot
+	info, _ := os.Stat(filepath.Join(dir, logFile))
+	assert.Equal(t, int64(0), info.Size(), "Log should be empty after closing")
+
+	recovered := newTestFileStorage(t, dir, 0)
+	assert.True(t, recovered.IsSubscribed("0xtestaddress"), "Subscription should be recovered from the snapshot")
+	checkpoint, ok := recovered.GetCheckpoint()
+	assert.True(t, ok, "Checkpoint should be recovered from the snapshot")
+	assert.Equal(t, "0xa", checkpoint.BlockHash, "The recovered checkpoint's block hash should match")
+	job, ok := recovered.GetBackfill("0xtestaddress")
+	assert.True(t, ok, "Backfill job should be recovered from the snapshot")
+	assert.Equal(t, 4, job.NextBlock, "The recovered job's progress should match")
+}
+
+// failingWAL is a log file whose syncs fail while failing is set
+type failingWAL struct {
+	*os.File
+	failing bool
+}
+
+func (f *failingWAL) Sync() error {
+	if f.failing {
+		return errors.New("disk failure")
+	}
+	return f.File.Sync()
+}
+
+func TestFileStorage_WriteFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestFileStorage(t, dir, 0)
+	s.AddAddress("0xTestAddress")
+	wal := &failingWAL{File: s.wal.(*os.File), failing: true}
+	s.wal = wal
+
+	// A mutation that cannot be made durable is not applied
+	s.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x1", Value: big.NewInt(100)})
+	assert.Len(t, s.GetTransactions("0xtestaddress"), 0, "Transaction should not be stored when the log cannot be synced")
+	assert.False(t, s.AddAddress("0xOther"), "Address should not be added when the log cannot be synced")
+	assert.Error(t, s.Err(), "Storage should report the failure")
+
+	// The failure is sticky, as the log may end in a partial entry
+	wal.failing = false
+	assert.False(t, s.AddAddress("0xOther"), "Mutations should be refused after a failure")
+	assert.Error(t, s.Err(), "Storage should keep reporting the failure")
+
+	recovered := newTestFileStorage(t, dir, 0)
+	assert.True(t, recovered.IsSubscribed("0xtestaddress"), "Mutations before the failure should be recovered")
+	assert.False(t, recovered.IsSubscribed("0xother"), "Refused mutations should not be recovered")
+	assert.Nil(t, recovered.Err(), "Recovered storage should accept mutations")
+}
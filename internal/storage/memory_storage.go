@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"sort"
 	"strings"
 	"sync"
 	"tx-parser/internal/interfaces"
@@ -15,12 +16,21 @@ type MemoryStorage struct {
 	mu           sync.RWMutex
 	subscribed   map[string]bool
 	transactions map[string][]interfaces.Transaction
+	positions    map[string]map[string]int // Position of each address's records in transactions by record id
+	checkpoint   *interfaces.Checkpoint
+	backfills    map[string]interfaces.BackfillJob
+	webhooks     map[string]interfaces.Webhook
+	deliveries   map[string]interfaces.WebhookDelivery
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
 		subscribed:   make(map[string]bool),
 		transactions: make(map[string][]interfaces.Transaction),
+		positions:    make(map[string]map[string]int),
+		backfills:    make(map[string]interfaces.BackfillJob),
+		webhooks:     make(map[string]interfaces.Webhook),
+		deliveries:   make(map[string]interfaces.WebhookDelivery),
 	}
 }
 
@@ -38,20 +48,267 @@ func (s *MemoryStorage) AddAddress(address string) bool {
 	return true
 }
 
+// RemoveAddress stops tracking an address. The records already stored for it are kept.
+func (s *MemoryStorage) RemoveAddress(address string) bool {
+	address = normalizeAddress(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.subscribed[address] {
+		return false
+	}
+	delete(s.subscribed, address)
+	return true
+}
+
+func (s *MemoryStorage) IsSubscribed(address string) bool {
+	address = normalizeAddress(address)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.subscribed[address]
+}
+
 func (s *MemoryStorage) GetTransactions(address string) []interfaces.Transaction {
 	address = normalizeAddress(address)
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.transactions[address]
+
+	// Return a copy, as stored records may be replaced in place
+	transactions := s.transactions[address]
+	if transactions == nil {
+		return nil
+	}
+	return append([]interfaces.Transaction(nil), transactions...)
 }
 
+// AddTransaction stores a record for an address. A record is stored once per address, so adding
+// it again, such as when its block is indexed twice, replaces the stored copy.
 func (s *MemoryStorage) AddTransaction(address string, tx interfaces.Transaction) {
 	address = normalizeAddress(address)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	positions := s.positions[address]
+	if positions == nil {
+		positions = make(map[string]int)
+		s.positions[address] = positions
+	}
+	id := tx.RecordID()
+	if i, ok := positions[id]; ok {
+		s.transactions[address][i] = tx
+		return
+	}
+
 	// Append the transaction to the address's transaction history
+	positions[id] = len(s.transactions[address])
 	s.transactions[address] = append(s.transactions[address], tx)
 }
+
+// RemoveTransaction removes every record of a transaction for an address. Records without a
+// transaction hash, such as withdrawals, are removed by their record id instead.
+func (s *MemoryStorage) RemoveTransaction(address string, txHash string) bool {
+	address = normalizeAddress(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transactions := s.transactions[address]
+	kept := transactions[:0]
+	for _, tx := range transactions {
+		if tx.Hash != txHash && tx.RecordID() != txHash {
+			kept = append(kept, tx)
+		}
+	}
+	s.transactions[address] = kept
+	s.positions[address] = indexRecords(kept)
+	return len(kept) != len(transactions)
+}
+
+// RemoveTransactionsFrom removes the records of every address mined in blockNumber or later,
+// returning the addresses that had any. Records that are not mined, such as pending ones, are kept.
+func (s *MemoryStorage) RemoveTransactionsFrom(blockNumber int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var addresses []string
+	for address, transactions := range s.transactions {
+		kept := transactions[:0]
+		for _, tx := range transactions {
+			if tx.BlockNumber < blockNumber || tx.BlockNumber == 0 {
+				kept = append(kept, tx)
+			}
+		}
+		if len(kept) == len(transactions) {
+			continue
+		}
+		s.transactions[address] = kept
+		s.positions[address] = indexRecords(kept)
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// indexRecords maps the record id of each transaction to its position
+func indexRecords(transactions []interfaces.Transaction) map[string]int {
+	positions := make(map[string]int, len(transactions))
+	for i, tx := range transactions {
+		positions[tx.RecordID()] = i
+	}
+	return positions
+}
+
+func (s *MemoryStorage) SaveCheckpoint(checkpoint interfaces.Checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoint = &checkpoint
+}
+
+func (s *MemoryStorage) GetCheckpoint() (interfaces.Checkpoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.checkpoint == nil {
+		return interfaces.Checkpoint{}, false
+	}
+	return *s.checkpoint, true
+}
+
+func (s *MemoryStorage) SaveBackfill(job interfaces.BackfillJob) {
+	job.Address = normalizeAddress(job.Address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backfills[job.Address] = job
+}
+
+func (s *MemoryStorage) GetBackfill(address string) (interfaces.BackfillJob, bool) {
+	address = normalizeAddress(address)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.backfills[address]
+	return job, ok
+}
+
+func (s *MemoryStorage) GetBackfills() []interfaces.BackfillJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]interfaces.BackfillJob, 0, len(s.backfills))
+	for _, job := range s.backfills {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func (s *MemoryStorage) SaveWebhook(webhook interfaces.Webhook) {
+	webhook.Address = normalizeAddress(webhook.Address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[webhook.Address] = webhook
+}
+
+func (s *MemoryStorage) GetWebhook(address string) (interfaces.Webhook, bool) {
+	address = normalizeAddress(address)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	webhook, ok := s.webhooks[address]
+	return webhook, ok
+}
+
+// SaveDelivery adds a webhook delivery, or replaces the stored one with the same id
+func (s *MemoryStorage) SaveDelivery(delivery interfaces.WebhookDelivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[delivery.ID] = delivery
+}
+
+func (s *MemoryStorage) RemoveDelivery(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.deliveries, id)
+}
+
+// GetDeliveries returns the stored webhook deliveries, oldest first
+func (s *MemoryStorage) GetDeliveries() []interfaces.WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]interfaces.WebhookDelivery, 0, len(s.deliveries))
+	for _, delivery := range s.deliveries {
+		deliveries = append(deliveries, delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+	return deliveries
+}
+
+// snapshot copies the full state so it can be persisted
+func (s *MemoryStorage) snapshot(lastSeq uint64) snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := snapshot{
+		LastSeq:      lastSeq,
+		Checkpoint:   s.checkpoint,
+		Subscribed:   make([]string, 0, len(s.subscribed)),
+		Transactions: make(map[string][]interfaces.Transaction, len(s.transactions)),
+		Backfills:    make([]interfaces.BackfillJob, 0, len(s.backfills)),
+		Webhooks:     make([]interfaces.Webhook, 0, len(s.webhooks)),
+		Deliveries:   make([]interfaces.WebhookDelivery, 0, len(s.deliveries)),
+	}
+	for address := range s.subscribed {
+		snap.Subscribed = append(snap.Subscribed, address)
+	}
+	for address, transactions := range s.transactions {
+		snap.Transactions[address] = append([]interfaces.Transaction(nil), transactions...)
+	}
+	for _, job := range s.backfills {
+		snap.Backfills = append(snap.Backfills, job)
+	}
+	for _, webhook := range s.webhooks {
+		snap.Webhooks = append(snap.Webhooks, webhook)
+	}
+	for _, delivery := range s.deliveries {
+		snap.Deliveries = append(snap.Deliveries, delivery)
+	}
+	return snap
+}
+
+// restore replaces the state with a persisted snapshot
+func (s *MemoryStorage) restore(snap snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoint = snap.Checkpoint
+	s.subscribed = make(map[string]bool, len(snap.Subscribed))
+	for _, address := range snap.Subscribed {
+		s.subscribed[address] = true
+	}
+	s.transactions = make(map[string][]interfaces.Transaction, len(snap.Transactions))
+	s.positions = make(map[string]map[string]int, len(snap.Transactions))
+	for address, transactions := range snap.Transactions {
+		s.transactions[address] = transactions
+		s.positions[address] = indexRecords(transactions)
+	}
+	s.backfills = make(map[string]interfaces.BackfillJob, len(snap.Backfills))
+	for _, job := range snap.Backfills {
+		s.backfills[job.Address] = job
+	}
+	s.webhooks = make(map[string]interfaces.Webhook, len(snap.Webhooks))
+	for _, webhook := range snap.Webhooks {
+		s.webhooks[webhook.Address] = webhook
+	}
+	s.deliveries = make(map[string]interfaces.WebhookDelivery, len(snap.Deliveries))
+	for _, delivery := range snap.Deliveries {
+		s.deliveries[delivery.ID] = delivery
+	}
+}
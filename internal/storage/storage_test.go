@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"math/big"
+	"testing"
+	"time"
+	"tx-parser/internal/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// storageFactory creates a fresh, empty Storage for a single test
+type storageFactory func(t *testing.T) interfaces.Storage
+
+// runStorageSuite runs the shared behaviour tests against any Storage implementation
+func runStorageSuite(t *testing.T, newStorage storageFactory) {
+	t.Run("AddAddress", func(t *testing.T) { testAddAddress(t, newStorage) })
+	t.Run("RemoveAddress", func(t *testing.T) { testRemoveAddress(t, newStorage) })
+	t.Run("IsSubscribed", func(t *testing.T) { testIsSubscribed(t, newStorage) })
+	t.Run("GetTransactions", func(t *testing.T) { testGetTransactions(t, newStorage) })
+	t.Run("AddTransaction_NormalizedAddress", func(t *testing.T) { testAddTransaction_NormalizedAddress(t, newStorage) })
+	t.Run("AddTransaction_Duplicate", func(t *testing.T) { testAddTransaction_Duplicate(t, newStorage) })
+	t.Run("RemoveTransaction", func(t *testing.T) { testRemoveTransaction(t, newStorage) })
+	t.Run("RemoveTransactionsFrom", func(t *testing.T) { testRemoveTransactionsFrom(t, newStorage) })
+	t.Run("Checkpoint", func(t *testing.T) { testCheckpoint(t, newStorage) })
+	t.Run("Backfill", func(t *testing.T) { testBackfill(t, newStorage) })
+	t.Run("Webhooks", func(t *testing.T) { testWebhooks(t, newStorage) })
+}
+
+func testAddAddress(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	// Test adding a new address
+	address := "0xTestAddress"
+	success := storage.AddAddress(address)
+	assert.True(t, success, "Address should be added successfully")
+
+	// Test adding the same address again
+	success = storage.AddAddress(address)
+	assert.False(t, success, "Adding the same address again should fail")
+
+	// Test adding the same address with different case and whitespace
+	addressWithDifferentFormat := "  0xTESTADDRESS "
+	success = storage.AddAddress(addressWithDifferentFormat)
+	assert.False(t, success, "Adding the same address with different format should fail")
+}
+
+func testRemoveAddress(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	assert.False(t, storage.RemoveAddress("0xTestAddress"), "Removing an address that is not subscribed should fail")
+
+	storage.AddAddress("0xTestAddress")
+	storage.AddTransaction("0xTestAddress", interfaces.Transaction{Hash: "0x1", Value: big.NewInt(100)})
+	assert.True(t, storage.RemoveAddress(" 0xTESTADDRESS "), "Address should be removed successfully")
+	assert.False(t, storage.IsSubscribed("0xtestaddress"), "Address should no longer be subscribed")
+	assert.Len(t, storage.GetTransactions("0xtestaddress"), 1, "Stored transactions should be kept")
+	assert.True(t, storage.AddAddress("0xTestAddress"), "Address should be subscribed again")
+}
+
+func testIsSubscribed(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	assert.False(t, storage.IsSubscribed("0xTestAddress"), "Address should not be subscribed initially")
+
+	storage.AddAddress("0xTestAddress")
+	assert.True(t, storage.IsSubscribed("0xtestaddress"), "Address should be subscribed after adding it")
+	assert.True(t, storage.IsSubscribed(" 0xTESTADDRESS "), "Subscription check should normalize the address")
+}
+
+func testGetTransactions(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	// Add a few transactions for an address
+	address := "0xTestAddress"
+	tx1 := interfaces.Transaction{Hash: "0x1", From: "0xFrom1", To: "0xTestAddress", Value: big.NewInt(100)}
+	tx2 := interfaces.Transaction{Hash: "0x2", From: "0xTestAddress", To: "0xTo1", Value: big.NewInt(200)}
+
+	// Initially, there should be no transactions
+	transactions := storage.GetTransactions(address)
+	assert.Len(t, transactions, 0, "There should be no transactions initially")
+
+	// Add transactions to the address
+	storage.AddTransaction(address, tx1)
+	storage.AddTransaction(address, tx2)
+
+	// Get the transactions and check their content
+	transactions = storage.GetTransactions(address)
+	assert.Len(t, transactions, 2, "There should be 2 transactions for the address")
+
+	// Check the content of the first transaction
+	assert.Equal(t, "0x1", transactions[0].Hash, "The first transaction's hash should match")
+	assert.Equal(t, "0xTestAddress", transactions[0].To, "The first transaction's 'To' field should match")
+	assert.Equal(t, big.NewInt(100), transactions[0].Value, "The first transaction's value should match")
+
+	// Check the content of the second transaction
+	assert.Equal(t, "0x2", transactions[1].Hash, "The second transaction's hash should match")
+	assert.Equal(t, "0xTestAddress", transactions[1].From, "The second transaction's 'From' field should match")
+	assert.Equal(t, big.NewInt(200), transactions[1].Value, "The second transaction's value should match")
+}
+
+func testAddTransaction_NormalizedAddress(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	// Add a transaction to an address with mixed case and extra whitespace
+	address := "  0xTestAddress  "
+	tx := interfaces.Transaction{Hash: "0x1", From: "0xFrom1", To: "0xTestAddress", Value: big.NewInt(100)}
+
+	// Add the transaction
+	storage.AddTransaction(address, tx)
+
+	// Retrieve the transactions using the normalized address
+	transactions := storage.GetTransactions("0xtestaddress")
+	assert.Len(t, transactions, 1, "There should be 1 transaction after normalization")
+
+	// Check the content of the transaction
+	assert.Equal(t, "0x1", transactions[0].Hash, "The transaction's hash should match")
+	assert.Equal(t, "0xTestAddress", transactions[0].To, "The transaction's 'To' field should match")
+	assert.Equal(t, big.NewInt(100), transactions[0].Value, "The transaction's value should match")
+}
+
+func testAddTransaction_Duplicate(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	// A transaction and the token transfer it made share a hash but are separate records
+	address := "0xTestAddress"
+	storage.AddTransaction(address, interfaces.Transaction{Hash: "0x1", Value: big.NewInt(100)})
+	storage.AddTransaction(address, interfaces.Transaction{Hash: "0x1", Kind: interfaces.KindERC20, Token: &interfaces.TokenTransfer{LogIndex: 3}})
+
+	// Adding a record again replaces it
+	storage.AddTransaction(address, interfaces.Transaction{Hash: "0x1", Value: big.NewInt(200)})
+
+	transactions := storage.GetTransactions(address)
+	assert.Len(t, transactions, 2, "Each record should be stored once")
+	assert.Equal(t, big.NewInt(200), transactions[0].Value, "The record should be replaced in place")
+
+	// Removing by hash drops every record of the transaction and they can be added again
+	storage.RemoveTransaction(address, "0x1")
+	storage.AddTransaction(address, interfaces.Transaction{Hash: "0x1", Value: big.NewInt(300)})
+	assert.Len(t, storage.GetTransactions(address), 1, "The record should be added again after removal")
+}
+
+func testRemoveTransaction(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	address := "0xTestAddress"
+	storage.AddTransaction(address, interfaces.Transaction{Hash: "0x1", From: "0xFrom1", To: "0xTestAddress", Value: big.NewInt(100)})
+	storage.AddTransaction(address, interfaces.Transaction{Hash: "0x2", From: "0xTestAddress", To: "0xTo1", Value: big.NewInt(200)})
+
+	// Remove an existing transaction
+	removed := storage.RemoveTransaction("0xtestaddress", "0x1")
+	assert.True(t, removed, "Existing transaction should be removed")
+
+	transactions := storage.GetTransactions(address)
+	assert.Len(t, transactions, 1, "There should be 1 transaction left")
+	assert.Equal(t, "0x2", transactions[0].Hash, "The remaining transaction's hash should match")
+
+	// Removing an unknown transaction is a no-op
+	removed = storage.RemoveTransaction(address, "0x3")
+	assert.False(t, removed, "Unknown transaction should not be removed")
+}
+
+func testRemoveTransactionsFrom(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	storage.AddTransaction("0xalice", interfaces.Transaction{Hash: "0x1", BlockNumber: 9, Value: big.NewInt(100)})
+	storage.AddTransaction("0xalice", interfaces.Transaction{Hash: "0x2", BlockNumber: 10, Value: big.NewInt(200)})
+	storage.AddTransaction("0xalice", interfaces.Transaction{Hash: "0x3", Status: interfaces.StatusPending, Value: big.NewInt(300)})
+	storage.AddTransaction("0xbob", interfaces.Transaction{Hash: "0x2", BlockNumber: 10, Value: big.NewInt(200)})
+	storage.AddTransaction("0xcarol", interfaces.Transaction{Hash: "0x1", BlockNumber: 9, Value: big.NewInt(100)})
+
+	addresses := storage.RemoveTransactionsFrom(10)
+	assert.Equal(t, []string{"0xalice", "0xbob"}, addresses, "Should return the addresses with removed records")
+
+	transactions := storage.GetTransactions("0xalice")
+	assert.Len(t, transactions, 2, "Earlier and pending records should be kept")
+	assert.Equal(t, "0x1", transactions[0].Hash, "Record of an earlier block should be kept")
+	assert.Equal(t, "0x3", transactions[1].Hash, "Pending record should be kept")
+	assert.Empty(t, storage.GetTransactions("0xbob"), "Records of later blocks should be removed")
+	assert.Len(t, storage.GetTransactions("0xcarol"), 1, "Other addresses should keep their earlier records")
+	assert.Empty(t, storage.RemoveTransactionsFrom(10), "Nothing should be left to remove")
+}
+
+func testCheckpoint(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	// Initially, there is no checkpoint
+	_, ok := storage.GetCheckpoint()
+	assert.False(t, ok, "There should be no checkpoint initially")
+
+	// The latest saved checkpoint is returned
+	storage.SaveCheckpoint(interfaces.Checkpoint{BlockNumber: 10, BlockHash: "0xa"})
+	storage.SaveCheckpoint(interfaces.Checkpoint{BlockNumber: 11, BlockHash: "0xb"})
+	checkpoint, ok := storage.GetCheckpoint()
+	assert.True(t, ok, "Checkpoint should be saved")
+	assert.Equal(t, 11, checkpoint.BlockNumber, "The checkpoint's block number should match")
+	assert.Equal(t, "0xb", checkpoint.BlockHash, "The checkpoint's block hash should match")
+}
+
+func testBackfill(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	// Initially, there are no backfill jobs
+	_, ok := storage.GetBackfill("0xTestAddress")
+	assert.False(t, ok, "There should be no backfill job initially")
+	assert.Len(t, storage.GetBackfills(), 0, "There should be no backfill jobs initially")
+
+	// Saving a job again updates its progress
+	job := interfaces.BackfillJob{Address: "0xTestAddress", FromBlock: 1, ToBlock: 10, NextBlock: 1, Status: interfaces.BackfillQueued}
+	storage.SaveBackfill(job)
+	job.NextBlock = 5
+	job.Status = interfaces.BackfillRunning
+	storage.SaveBackfill(job)
+
+	saved, ok := storage.GetBackfill("0xtestaddress")
+	assert.True(t, ok, "Backfill job should be saved")
+	assert.Equal(t, "0xtestaddress", saved.Address, "The job's address should be normalized")
+	assert.Equal(t, 5, saved.NextBlock, "The job's progress should match")
+	assert.Equal(t, interfaces.BackfillRunning, saved.Status, "The job's status should match")
+	assert.Len(t, storage.GetBackfills(), 1, "There should be 1 backfill job")
+}
+
+func testWebhooks(t *testing.T, newStorage storageFactory) {
+	storage := newStorage(t)
+
+	// Initially, there are no webhooks or deliveries
+	_, ok := storage.GetWebhook("0xTestAddress")
+	assert.False(t, ok, "There should be no webhook initially")
+	assert.Len(t, storage.GetDeliveries(), 0, "There should be no deliveries initially")
+
+	storage.SaveWebhook(interfaces.Webhook{Address: "0xTestAddress", URL: "http://localhost/hook", Secret: "secret"})
+	webhook, ok := storage.GetWebhook("0xtestaddress")
+	assert.True(t, ok, "Webhook should be saved")
+	assert.Equal(t, "http://localhost/hook", webhook.URL, "The webhook's URL should match")
+
+	// Deliveries are returned oldest first, and saving one again updates it
+	now := time.Now()
+	storage.SaveDelivery(interfaces.WebhookDelivery{ID: "b", Address: "0xtestaddress", Status: interfaces.DeliveryQueued, CreatedAt: now.Add(time.Second)})
+	storage.SaveDelivery(interfaces.WebhookDelivery{ID: "a", Address: "0xtestaddress", Status: interfaces.DeliveryQueued, CreatedAt: now})
+	storage.SaveDelivery(interfaces.WebhookDelivery{ID: "a", Address: "0xtestaddress", Status: interfaces.DeliveryDead, Attempts: 3, CreatedAt: now})
+	deliveries := storage.GetDeliveries()
+	assert.Len(t, deliveries, 2, "There should be 2 deliveries")
+	assert.Equal(t, "a", deliveries[0].ID, "The oldest delivery should come first")
+	assert.Equal(t, interfaces.DeliveryDead, deliveries[0].Status, "The delivery should be updated")
+
+	storage.RemoveDelivery("a")
+	deliveries = storage.GetDeliveries()
+	assert.Len(t, deliveries, 1, "There should be 1 delivery left")
+	assert.Equal(t, "b", deliveries[0].ID, "The remaining delivery's id should match")
+}
@@ -0,0 +1,398 @@
+package webhook
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/internal/interfaces"
+	"tx-parser/pkg/logger"
+	"tx-parser/utils"
+)
+
+// Defaults used for webhook settings that are not configured
+const (
+	DefaultMaxAttempts    = 10
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+	DefaultTimeout        = 10 * time.Second
+	DefaultWorkers        = 4
+)
+
+// Headers sent with every delivery
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix seconds of the attempt, covered by the signature
+	HeaderSignature = "X-Webhook-Signature" // "sha256=" followed by the hex encoded HMAC-SHA256
+)
+
+// payload is the body of a delivery: the indexer event with the delivery's id
+type payload struct {
+	ID string `json:"id"`
+	interfaces.Event
+}
+
+// Dispatcher queues a delivery for every record stored for an address with a webhook, and posts
+// the queued deliveries with exponential backoff. The queue lives in storage, so deliveries
+// survive restarts; a delivery interrupted by a restart is sent again, so receivers should
+// deduplicate by id. Deliveries to the same webhook may arrive out of order.
+//
+// Notify only hands the event over, the run loop queues its delivery in storage, so the indexer
+// never waits for the queue to be written. Events handed over shortly before a crash may be lost.
+type Dispatcher struct {
+	storage        interfaces.Storage
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	workers        int
+	skipBackfill   bool
+	skipPending    bool
+	log            *logger.Logger
+
+	mu       sync.Mutex
+	notified []interfaces.Event // Events handed over by Notify that are not queued yet
+	queue    dueQueue           // Queued deliveries that are not being sent, loaded from storage once
+	wake     chan struct{}      // Signalled when an event is handed over, or a delivery is queued or finishes
+}
+
+// dueQueue is a min-heap of queued deliveries ordered by when their next attempt is due
+type dueQueue []interfaces.WebhookDelivery
+
+func (q dueQueue) Len() int           { return len(q) }
+func (q dueQueue) Less(i, j int) bool { return q[i].NextAttempt.Before(q[j].NextAttempt) }
+func (q dueQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *dueQueue) Push(x interface{}) {
+	*q = append(*q, x.(interfaces.WebhookDelivery))
+}
+
+func (q *dueQueue) Pop() interface{} {
+	old := *q
+	delivery := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return delivery
+}
+
+// NewDispatcher creates a dispatcher from configuration, applying defaults for unset values
+func NewDispatcher(storage interfaces.Storage, cfg config.WebhookConfig, log *logger.Logger) *Dispatcher {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	d := &Dispatcher{
+		storage:        storage,
+		client:         &http.Client{Timeout: cfg.Timeout},
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+		workers:        cfg.Workers,
+		skipBackfill:   cfg.SkipBackfill,
+		skipPending:    cfg.SkipPending,
+		log:            log,
+		wake:           make(chan struct{}, 1),
+	}
+
+	// Storage is only read here, the queue is kept in memory from then on
+	for _, delivery := range storage.GetDeliveries() {
+		if delivery.Status == interfaces.DeliveryQueued {
+			d.queue = append(d.queue, delivery)
+		}
+	}
+	heap.Init(&d.queue)
+	return d
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp and body, joined by a dot, keyed
+// with the webhook's secret. Receivers recompute it to authenticate a delivery.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Register sets the webhook of an address, generating a secret when none is given
+func (d *Dispatcher) Register(address, url, secret string) interfaces.Webhook {
+	if secret == "" {
+		secret = randomHex(32)
+	}
+	webhook := interfaces.Webhook{Address: utils.NormalizeAddress(address), URL: url, Secret: secret}
+	d.storage.SaveWebhook(webhook)
+	return webhook
+}
+
+// Notify hands over a transaction event to be delivered when its address has a webhook. It never
+// blocks on storage; the delivery is queued by Run.
+func (d *Dispatcher) Notify(event interfaces.Event) {
+	if event.Transaction == nil {
+		return
+	}
+	if d.skipBackfill && event.Transaction.Backfill {
+		return
+	}
+	switch event.Transaction.Transaction.Status {
+	case interfaces.StatusPending, interfaces.StatusReplaced, interfaces.StatusDropped:
+		if d.skipPending {
+			return
+		}
+	}
+
+	d.mu.Lock()
+	d.notified = append(d.notified, event)
+	d.mu.Unlock()
+	d.signal()
+}
+
+// queueNotified queues a delivery for every event handed over by Notify whose address has a webhook
+func (d *Dispatcher) queueNotified() {
+	d.mu.Lock()
+	events := d.notified
+	d.notified = nil
+	d.mu.Unlock()
+
+	for _, event := range events {
+		address := event.Transaction.Address
+		if _, ok := d.storage.GetWebhook(address); !ok {
+			continue
+		}
+
+		id := randomHex(16)
+		body, err := json.Marshal(payload{ID: id, Event: event})
+		if err != nil {
+			d.log.Error.Printf("Failed to encode webhook payload for %s: %v", address, err)
+			continue
+		}
+		now := time.Now()
+		delivery := interfaces.WebhookDelivery{
+			ID:          id,
+			Address:     address,
+			Payload:     body,
+			Status:      interfaces.DeliveryQueued,
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+		d.storage.SaveDelivery(delivery)
+		d.enqueue(delivery)
+	}
+}
+
+// DeadLetters returns the deliveries whose attempts ran out, of a single address when one is given
+func (d *Dispatcher) DeadLetters(address string) []interfaces.WebhookDelivery {
+	address = utils.NormalizeAddress(address)
+	deadLetters := []interfaces.WebhookDelivery{}
+	for _, delivery := range d.storage.GetDeliveries() {
+		if delivery.Status == interfaces.DeliveryDead && (address == "" || delivery.Address == address) {
+			deadLetters = append(deadLetters, delivery)
+		}
+	}
+	return deadLetters
+}
+
+// Replay queues dead letters again with a fresh set of attempts. Only the dead letter with the
+// given id, or those of the given address, are replayed when set. It returns the number replayed.
+func (d *Dispatcher) Replay(address, id string) int {
+	address = utils.NormalizeAddress(address)
+	replayed := 0
+	for _, delivery := range d.DeadLetters(address) {
+		if id != "" && delivery.ID != id {
+			continue
+		}
+		delivery.Status = interfaces.DeliveryQueued
+		delivery.Attempts = 0
+		delivery.NextAttempt = time.Now()
+		d.storage.SaveDelivery(delivery)
+		d.enqueue(delivery)
+		replayed++
+	}
+	if replayed > 0 {
+		d.log.Info.Printf("Replaying %d webhook dead letters", replayed)
+	}
+	return replayed
+}
+
+// Run queues the deliveries of notified events and sends them as they become due until ctx is
+// cancelled. Events notified before it returns are queued in storage, to be sent by the next run.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		d.queueNotified()
+	}()
+	slots := make(chan struct{}, d.workers)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		d.queueNotified()
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Start every due delivery a worker is free for, and sleep until the next one is due
+		next := time.Time{}
+		d.mu.Lock()
+		for len(d.queue) > 0 {
+			if due := d.queue[0].NextAttempt; due.After(time.Now()) {
+				next = due
+				break
+			}
+			if len(slots) == cap(slots) {
+				// Every worker is busy, one finishing wakes the loop
+				break
+			}
+			slots <- struct{}{}
+			delivery := heap.Pop(&d.queue).(interfaces.WebhookDelivery)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+				<-slots
+				d.signal()
+			}()
+		}
+		d.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-due:
+		}
+	}
+}
+
+// deliver makes one attempt to post a delivery, removing it on success and scheduling the next
+// attempt, or giving up on it, on failure
+func (d *Dispatcher) deliver(ctx context.Context, delivery interfaces.WebhookDelivery) {
+	webhook, ok := d.storage.GetWebhook(delivery.Address)
+	if !ok {
+		d.log.Warn.Printf("Discarding webhook delivery %s, %s has no webhook", delivery.ID, delivery.Address)
+		d.storage.RemoveDelivery(delivery.ID)
+		return
+	}
+
+	err := d.post(ctx, webhook, delivery)
+	if err == nil {
+		d.log.Debug.Printf("Delivered webhook %s to %s", delivery.ID, webhook.URL)
+		d.storage.RemoveDelivery(delivery.ID)
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down, the delivery stays queued for the next run
+		d.enqueue(delivery)
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status = interfaces.DeliveryDead
+		d.log.Warn.Printf("Webhook delivery %s to %s failed %d times, moved to dead letters: %v", delivery.ID, webhook.URL, delivery.Attempts, err)
+	} else {
+		delay := d.backoff(delivery.Attempts)
+		delivery.NextAttempt = time.Now().Add(delay)
+		d.log.Warn.Printf("Webhook delivery %s to %s failed (attempt %d/%d), retrying in %s: %v", delivery.ID, webhook.URL, delivery.Attempts, d.maxAttempts, delay, err)
+	}
+	d.storage.SaveDelivery(delivery)
+	if delivery.Status == interfaces.DeliveryQueued {
+		d.enqueue(delivery)
+	}
+}
+
+// post sends a delivery signed with the webhook's secret; any status other than 2xx is a failure
+func (d *Dispatcher) post(ctx context.Context, webhook interfaces.Webhook, delivery interfaces.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, "sha256="+Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // Drain the body so the connection can be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff returns the delay after the given failed attempt, doubling from the initial backoff
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.initialBackoff
+	for i := 1; i < attempt && backoff < d.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.maxBackoff {
+		backoff = d.maxBackoff
+	}
+	return backoff
+}
+
+// enqueue adds a queued delivery to the in-memory queue and wakes the run loop
+func (d *Dispatcher) enqueue(delivery interfaces.WebhookDelivery) {
+	d.mu.Lock()
+	heap.Push(&d.queue, delivery)
+	d.mu.Unlock()
+	d.signal()
+}
+
+// signal wakes the run loop without blocking; a pending wake-up already covers this one
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// The system's randomness source failing leaves nothing sensible to fall back to
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,281 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tx-parser/internal/config"
+	"tx-parser/internal/interfaces"
+	"tx-parser/internal/storage"
+	"tx-parser/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// received is a delivery as seen by the test receiver
+type received struct {
+	body      []byte
+	id        string
+	timestamp string
+	signature string
+}
+
+// newReceiver starts a webhook receiver that answers with the status returned by status and
+// records every delivery
+func newReceiver(t *testing.T, status func() int) (*httptest.Server, chan received) {
+	deliveries := make(chan received, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- received{
+			body:      body,
+			id:        r.Header.Get(HeaderID),
+			timestamp: r.Header.Get(HeaderTimestamp),
+			signature: r.Header.Get(HeaderSignature),
+		}
+		w.WriteHeader(status())
+	}))
+	t.Cleanup(server.Close)
+	return server, deliveries
+}
+
+// transactionEvent returns the event of a record stored for address
+func transactionEvent(address, hash string) interfaces.Event {
+	return interfaces.Event{
+		Type: interfaces.EventTransaction,
+		Transaction: &interfaces.TransactionEvent{
+			Address:     address,
+			Transaction: interfaces.Transaction{Hash: hash, From: "0xfrom", To: address, Value: big.NewInt(100)},
+		},
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Test that a record of an address with a webhook is posted with a valid signature and removed from the queue
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	receiver, deliveries := newReceiver(t, func() int { return http.StatusOK })
+	s := storage.NewMemoryStorage()
+	dispatcher := NewDispatcher(s, config.WebhookConfig{}, logger.GetLogger("debug"))
+	webhook := dispatcher.Register("0xTestAddress", receiver.URL, "")
+	assert.Len(t, webhook.Secret, 64, "A secret should be generated when none is given")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	// Records of addresses without a webhook are not delivered
+	dispatcher.Notify(transactionEvent("0xother", "0x1"))
+	dispatcher.Notify(transactionEvent("0xtestaddress", "0x2"))
+
+	var delivery received
+	select {
+	case delivery = <-deliveries:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a webhook delivery")
+	}
+	timestamp, err := strconv.ParseInt(delivery.timestamp, 10, 64)
+	assert.Nil(t, err, "Expected a Unix timestamp header")
+	assert.Equal(t, "sha256="+Sign(webhook.Secret, timestamp, delivery.body), delivery.signature, "Signature should cover the timestamp and body")
+	assert.NotEqual(t, "sha256="+Sign("wrong", timestamp, delivery.body), delivery.signature, "Signature should depend on the secret")
+
+	var body struct {
+		ID string `json:"id"`
+		interfaces.Event
+	}
+	assert.Nil(t, json.Unmarshal(delivery.body, &body), "Expected a JSON payload")
+	assert.Equal(t, delivery.id, body.ID, "Payload and header should carry the same delivery id")
+	assert.Equal(t, interfaces.EventTransaction, body.Type, "Payload should be a transaction event")
+	assert.Equal(t, "0x2", body.Transaction.Transaction.Hash, "Payload should carry the stored record")
+
+	waitFor(t, func() bool { return len(s.GetDeliveries()) == 0 }, "Delivered webhook should be removed from the queue")
+	select {
+	case delivery := <-deliveries:
+		t.Fatalf("Unexpected delivery %s", delivery.body)
+	default:
+	}
+}
+
+// Test that failed deliveries are retried with backoff, dead-lettered once attempts run out and can be replayed
+func TestDispatcher_RetryDeadLetterAndReplay(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	receiver, deliveries := newReceiver(t, func() int { return int(status.Load()) })
+	s := storage.NewMemoryStorage()
+	dispatcher := NewDispatcher(s, config.WebhookConfig{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}, logger.GetLogger("debug"))
+	dispatcher.Register("0xtestaddress", receiver.URL, "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+	dispatcher.Notify(transactionEvent("0xtestaddress", "0x1"))
+
+	// Every attempt posts the same delivery
+	var first received
+	for i := 0; i < 3; i++ {
+		select {
+		case delivery := <-deliveries:
+			if i == 0 {
+				first = delivery
+			}
+			assert.Equal(t, first.id, delivery.id, "Retries should keep the delivery id")
+			assert.Equal(t, first.body, delivery.body, "Retries should post the same body")
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected attempt %d", i+1)
+		}
+	}
+	waitFor(t, func() bool { return len(dispatcher.DeadLetters("")) == 1 }, "Delivery should become a dead letter after 3 attempts")
+	deadLetter := dispatcher.DeadLetters("0xTestAddress")[0]
+	assert.Equal(t, 3, deadLetter.Attempts, "Dead letter should record its attempts")
+	assert.Equal(t, "unexpected status code 500", deadLetter.LastError, "Dead letter should record the last error")
+	assert.Len(t, dispatcher.DeadLetters("0xother"), 0, "Dead letters should be filtered by address")
+
+	// Replaying a dead letter that does not exist changes nothing
+	assert.Equal(t, 0, dispatcher.Replay("", "unknown"), "No dead letter should be replayed for an unknown id")
+
+	// Once the receiver recovers, a replayed dead letter is delivered
+	status.Store(http.StatusNoContent)
+	assert.Equal(t, 1, dispatcher.Replay("", deadLetter.ID), "Dead letter should be replayed")
+	select {
+	case delivery := <-deliveries:
+		assert.Equal(t, first.id, delivery.id, "Replay should post the dead letter")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the replayed delivery")
+	}
+	waitFor(t, func() bool { return len(s.GetDeliveries()) == 0 }, "Replayed delivery should be removed from the queue")
+}
+
+// Test that queued deliveries are kept in storage and sent after a restart
+func TestDispatcher_DurableQueue(t *testing.T) {
+	receiver, deliveries := newReceiver(t, func() int { return http.StatusOK })
+	dir := t.TempDir()
+	log := logger.GetLogger("debug")
+
+	// Queue a delivery without running the dispatcher, as if it stopped before sending it
+	s, err := storage.NewFileStorage(dir, 0, log)
+	assert.Nil(t, err, "Expected no error opening file storage")
+	dispatcher := NewDispatcher(s, config.WebhookConfig{}, log)
+	dispatcher.Register("0xtestaddress", receiver.URL, "secret")
+	dispatcher.Notify(transactionEvent("0xtestaddress", "0x1"))
+	assert.Len(t, s.GetDeliveries(), 0, "Notify should not write to storage")
+
+	// A stopping dispatcher queues the events it was notified of
+	stopped, stop := context.WithCancel(context.Background())
+	stop()
+	dispatcher.Run(stopped)
+	assert.Nil(t, s.Close(), "Expected no error closing file storage")
+
+	recovered, err := storage.NewFileStorage(dir, 0, log)
+	assert.Nil(t, err, "Expected no error reopening file storage")
+	defer recovered.Close()
+	assert.Len(t, recovered.GetDeliveries(), 1, "Queued delivery should survive a restart")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewDispatcher(recovered, config.WebhookConfig{}, log).Run(ctx)
+	select {
+	case delivery := <-deliveries:
+		assert.Contains(t, string(delivery.body), `"hash":"0x1"`, "Recovered delivery should be sent")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the recovered delivery")
+	}
+}
+
+// Test that backfilled and mempool records are delivered unless configured otherwise
+func TestDispatcher_Skip(t *testing.T) {
+	backfilled := transactionEvent("0xtestaddress", "0x1")
+	backfilled.Transaction.Backfill = true
+	pending := transactionEvent("0xtestaddress", "0x2")
+	pending.Transaction.Transaction.Status = interfaces.StatusPending
+	dropped := transactionEvent("0xtestaddress", "0x3")
+	dropped.Transaction.Transaction.Status = interfaces.StatusDropped
+	mined := transactionEvent("0xtestaddress", "0x4")
+
+	tests := []struct {
+		name   string
+		config config.WebhookConfig
+		want   int
+	}{
+		{"all", config.WebhookConfig{}, 4},
+		{"skip backfill", config.WebhookConfig{SkipBackfill: true}, 3},
+		{"skip pending", config.WebhookConfig{SkipPending: true}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storage.NewMemoryStorage()
+			dispatcher := NewDispatcher(s, tt.config, logger.GetLogger("debug"))
+			dispatcher.Register("0xtestaddress", "http://localhost", "secret")
+			for _, event := range []interfaces.Event{backfilled, pending, dropped, mined} {
+				dispatcher.Notify(event)
+			}
+			dispatcher.queueNotified()
+			assert.Len(t, s.GetDeliveries(), tt.want, "Unexpected number of queued deliveries")
+		})
+	}
+}
+
+// countingStorage counts how often the queued deliveries are read from storage
+type countingStorage struct {
+	interfaces.Storage
+	reads atomic.Int32
+}
+
+func (s *countingStorage) GetDeliveries() []interfaces.WebhookDelivery {
+	s.reads.Add(1)
+	return s.Storage.GetDeliveries()
+}
+
+// Test that deliveries are scheduled from memory, reading storage only when the dispatcher is created
+func TestDispatcher_ReadsStorageOnce(t *testing.T) {
+	// The first attempts fail and are retried, the retries succeed
+	var attempts atomic.Int32
+	receiver, deliveries := newReceiver(t, func() int {
+		if attempts.Add(1) <= 5 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	})
+	s := &countingStorage{Storage: storage.NewMemoryStorage()}
+	dispatcher := NewDispatcher(s, config.WebhookConfig{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond, Workers: 2}, logger.GetLogger("debug"))
+	dispatcher.Register("0xtestaddress", receiver.URL, "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	for i := 0; i < 5; i++ {
+		dispatcher.Notify(transactionEvent("0xtestaddress", fmt.Sprintf("0x%d", i)))
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case <-deliveries:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected attempt %d", i+1)
+		}
+	}
+	waitFor(t, func() bool { return len(s.Storage.GetDeliveries()) == 0 }, "Delivered webhooks should be removed from the queue")
+	assert.Equal(t, int32(1), s.reads.Load(), "Queued deliveries should only be read from storage at startup")
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := NewDispatcher(storage.NewMemoryStorage(), config.WebhookConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}, logger.GetLogger("debug"))
+	assert.Equal(t, time.Second, dispatcher.backoff(1), "First retry should wait the initial backoff")
+	assert.Equal(t, 4*time.Second, dispatcher.backoff(3), "Backoff should double on every retry")
+	assert.Equal(t, 5*time.Second, dispatcher.backoff(10), "Backoff should be capped")
+}
@@ -1,8 +1,41 @@
 package utils
 
-import "strings"
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// etherDecimals is the number of decimals of ether amounts expressed in wei
+const etherDecimals = 18
 
 // NormalizeAddress trims and converts an Ethereum address to lowercase
 func NormalizeAddress(address string) string {
 	return strings.ToLower(strings.TrimSpace(address))
 }
+
+// FormatEther renders an amount of wei as a decimal number of ether without trailing zeros
+func FormatEther(wei *big.Int) string {
+	return FormatUnits(wei, etherDecimals)
+}
+
+// FormatUnits renders an amount in base units as a decimal number with the given number of
+// decimals, without trailing zeros
+func FormatUnits(amount *big.Int, decimals int) string {
+	if amount == nil {
+		return ""
+	}
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(new(big.Int).Abs(amount), unit, new(big.Int))
+	result := whole.String()
+	if frac.Sign() != 0 {
+		// Pad the fraction to the number of decimals so leading zeros are kept
+		digits := strings.TrimRight(fmt.Sprintf("%0*s", decimals, frac.String()), "0")
+		result += "." + digits
+	}
+	if amount.Sign() < 0 {
+		result = "-" + result
+	}
+	return result
+}